@@ -35,15 +35,15 @@ func (c ConstNumber) ToVerilogLiteral() string {
 }
 
 // RandomConstNumber generates a random ConstNumber with 1–34 bit width and non-zero value
-func RandomConstNumber() ConstNumber {
-	bitWidth := rand.Intn(34) + 1 // 1 to 34 bits
-	signed := false               // true for signed, false for unsigned
+func RandomConstNumber(rng *rand.Rand) ConstNumber {
+	bitWidth := rng.Intn(34) + 1 // 1 to 34 bits
+	signed := false              // true for signed, false for unsigned
 
 	var value uint64
 	if signed {
 		max := int64(1) << (bitWidth - 1)
 		for {
-			rangeVal := rand.Int63n(2 * max)
+			rangeVal := rng.Int63n(2 * max)
 			v := int64(rangeVal - max)
 			if v != 0 {
 				value = uint64(v)
@@ -53,7 +53,7 @@ func RandomConstNumber() ConstNumber {
 	} else {
 		max := uint64(1) << bitWidth
 		for {
-			v := rand.Uint64() % max
+			v := rng.Uint64() % max
 			if v != 0 {
 				value = v
 				break
@@ -69,7 +69,7 @@ func RandomConstNumber() ConstNumber {
 }
 
 // RandomConstNumberWithBitWidth generates a random ConstNumber with specific bit width and non-zero value
-func RandomConstNumberWithBitWidth(bitWidth int, signed bool) ConstNumber {
+func RandomConstNumberWithBitWidth(rng *rand.Rand, bitWidth int, signed bool) ConstNumber {
 	if bitWidth <= 0 || bitWidth > 34 {
 		panic("bitWidth must be between 1 and 34")
 	}
@@ -78,7 +78,7 @@ func RandomConstNumberWithBitWidth(bitWidth int, signed bool) ConstNumber {
 	if signed {
 		max := int64(1) << (bitWidth - 1)
 		for {
-			rangeVal := rand.Int63n(2 * max)
+			rangeVal := rng.Int63n(2 * max)
 			v := int64(rangeVal - max)
 			if v != 0 {
 				value = uint64(v)
@@ -88,7 +88,7 @@ func RandomConstNumberWithBitWidth(bitWidth int, signed bool) ConstNumber {
 	} else {
 		maxv := uint64(1) << bitWidth
 		for {
-			v := rand.Uint64() % maxv
+			v := rng.Uint64() % maxv
 			if v != 0 {
 				value = v
 				break
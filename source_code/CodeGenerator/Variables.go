@@ -38,8 +38,8 @@ type Variable struct {
 	isSigned   bool
 }
 
-func NewVar(varType VerilogVarType) *Variable {
-	name := GenerateIdentifier(varType)
+func (g *ExpressionGenerator) NewVar(varType VerilogVarType) *Variable {
+	name := g.GenerateIdentifier(varType)
 	return &Variable{
 		Name:       name,
 		Type:       varType,
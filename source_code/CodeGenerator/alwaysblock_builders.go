@@ -2,10 +2,11 @@ package CodeGenerator
 
 import "math/rand"
 
-func NewAlwaysBlock(blockType AlwaysBlockType) *AlwaysBlock {
+func NewAlwaysBlock(blockType AlwaysBlockType, rng *rand.Rand) *AlwaysBlock {
 	return &AlwaysBlock{
 		Type:       blockType,
 		Statements: make([]Statement, 0),
+		rng:        rng,
 	}
 }
 
@@ -72,7 +73,7 @@ func (a *AlwaysBlock) pickClockEdge() bool {
 	if a.ForcePosedge {
 		return true
 	}
-	return rand.Float32() < 0.5
+	return a.rng.Float32() < 0.5
 }
 
 func NewIfStatement(condition Expression) *IfStatement {
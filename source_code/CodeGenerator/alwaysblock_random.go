@@ -1,13 +1,10 @@
 package CodeGenerator
 
-import (
-	"math/rand"
-	"strconv"
-)
+import "strconv"
 
 func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variable, maxDepth int, maxWidth int) *AlwaysBlock {
 
-	block := NewAlwaysBlock(AlwaysFF)
+	block := NewAlwaysBlock(AlwaysFF, gen.Rand)
 
 	definedVars := make([]*Variable, 0)
 	resetVar := clockVars[len(clockVars)-1]
@@ -16,11 +13,11 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 		block.SetClocks(clockVars)
 	}
 
-	block.SetReset(resetVar, strconv.Itoa(rand.Intn(1000)))
+	block.SetReset(resetVar, strconv.Itoa(gen.Rand.Intn(1000)))
 
 	numExtraStatements := maxWidth
 	for i := 0; i < numExtraStatements; i++ {
-		stmtType := rand.Intn(3)
+		stmtType := gen.Rand.Intn(3)
 		switch stmtType {
 		case 0: // 非阻塞赋值
 			target := gen.AddRegVariable("")
@@ -28,14 +25,14 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 			expr := gen.GenerateExpression(maxDepth)
 			var ran *BitRange
 			if target.hasRange {
-				ran = GetRandomRangeFromVar(target)
+				ran = GetRandomRangeFromVar(gen.Rand, target)
 			}
 			block.AddStatement(NewNonBlockingAssignment(target, expr, ran))
 		case 1:
 			condition := gen.GenerateExpression(maxDepth)
 			ifStmt := NewIfStatement(condition)
 
-			numTrueStmts := rand.Intn(3) + 1
+			numTrueStmts := gen.Rand.Intn(3) + 1
 			for j := 0; j < numTrueStmts; j++ {
 				var target *Variable
 				target = gen.AddRegVariable("")
@@ -43,13 +40,13 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 				expr := gen.GenerateExpression(maxDepth)
 				var ran *BitRange
 				if target.hasRange {
-					ran = GetRandomRangeFromVar(target)
+					ran = GetRandomRangeFromVar(gen.Rand, target)
 				}
 				ifStmt.AddTrueStatement(NewNonBlockingAssignment(target, expr, ran))
 			}
 
-			if rand.Float32() < 0.5 {
-				numElseStmts := rand.Intn(3) + 1
+			if gen.Rand.Float32() < 0.5 {
+				numElseStmts := gen.Rand.Intn(3) + 1
 				for j := 0; j < numElseStmts; j++ {
 					var target *Variable
 					target = gen.AddRegVariable("")
@@ -57,7 +54,7 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 					expr := gen.GenerateExpression(maxDepth)
 					var ran *BitRange
 					if target.hasRange {
-						ran = GetRandomRangeFromVar(target)
+						ran = GetRandomRangeFromVar(gen.Rand, target)
 					}
 					ifStmt.AddElseStatement(NewNonBlockingAssignment(target, expr, ran))
 				}
@@ -68,10 +65,10 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 			expr := gen.GenerateExpression(maxDepth)
 			caseStmt := NewCaseStatement(expr)
 
-			numCases := rand.Intn(3) + 2
+			numCases := gen.Rand.Intn(3) + 2
 			for j := 0; j < numCases; j++ {
-				caseValue := GenerateRandomNumber()
-				numCaseStmts := rand.Intn(3) + 1
+				caseValue := GenerateRandomNumber(gen.Rand)
+				numCaseStmts := gen.Rand.Intn(3) + 1
 				caseStatements := make([]Statement, 0, numCaseStmts)
 
 				for k := 0; k < numCaseStmts; k++ {
@@ -82,7 +79,7 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 					expr := gen.GenerateExpression(maxDepth)
 					var ran *BitRange
 					if target.hasRange {
-						ran = GetRandomRangeFromVar(target)
+						ran = GetRandomRangeFromVar(gen.Rand, target)
 					}
 					caseStatements = append(caseStatements, NewNonBlockingAssignment(target, expr, ran))
 				}
@@ -91,7 +88,7 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 			}
 
 			if true {
-				numDefaultStmts := rand.Intn(3) + 1
+				numDefaultStmts := gen.Rand.Intn(3) + 1
 				defaultStatements := make([]Statement, 0, numDefaultStmts)
 
 				for j := 0; j < numDefaultStmts; j++ {
@@ -101,7 +98,7 @@ func RandomAlwaysBlockWithTargets(gen *ExpressionGenerator, clockVars []*Variabl
 					expr := gen.GenerateExpression(maxDepth)
 					var ran *BitRange
 					if target.hasRange {
-						ran = GetRandomRangeFromVar(target)
+						ran = GetRandomRangeFromVar(gen.Rand, target)
 					}
 					defaultStatements = append(defaultStatements, NewNonBlockingAssignment(target, expr, ran))
 				}
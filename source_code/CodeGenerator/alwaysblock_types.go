@@ -1,5 +1,7 @@
 package CodeGenerator
 
+import "math/rand"
+
 type AlwaysBlockType int
 
 const (
@@ -17,6 +19,8 @@ type AlwaysBlock struct {
 	Statements   []Statement
 	UsedVars     []*Variable
 	ForcePosedge bool
+
+	rng *rand.Rand
 }
 
 type Statement interface {
@@ -1,7 +1,6 @@
 package CodeGenerator
 
 import (
-	"math/rand"
 	"strconv"
 	"strings"
 )
@@ -15,13 +14,20 @@ func (g *ExpressionGenerator) ApplyControlFlowTransforms(block *AlwaysBlock) *Al
 	if block == nil {
 		return nil
 	}
+	t := g.newRewriter(blockSite(0))
+	out := t.block(block)
+	g.pendingRewrites = append(g.pendingRewrites, t.rewrites(nil)...)
+	return out
+}
+
+func (t *rewriter) block(block *AlwaysBlock) *AlwaysBlock {
 	return &AlwaysBlock{
 		Type:         block.Type,
 		ClockVars:    append([]*Variable(nil), block.ClockVars...),
 		ClockPosedge: append([]bool(nil), block.ClockPosedge...),
 		ResetVar:     block.ResetVar,
 		ResetValue:   block.ResetValue,
-		Statements:   g.transformStatements(block.Statements),
+		Statements:   t.statements("", block.Statements),
 		UsedVars:     append([]*Variable(nil), block.UsedVars...),
 		ForcePosedge: block.ForcePosedge,
 	}
@@ -56,74 +62,107 @@ func (g *ExpressionGenerator) buildAlwaysBlocksString(blocks []*AlwaysBlock, tra
 	return sb.String()
 }
 
-func (g *ExpressionGenerator) transformStatements(stmts []Statement) []Statement {
+func (g *ExpressionGenerator) transformAlwaysBlocks(blocks []*AlwaysBlock) []*AlwaysBlock {
+	out := make([]*AlwaysBlock, 0, len(blocks))
+	for _, block := range blocks {
+		if block != nil {
+			t := g.newRewriter(blockSite(len(out)))
+			out = append(out, t.block(block))
+			g.pendingRewrites = append(g.pendingRewrites, t.rewrites(nil)...)
+		}
+	}
+	return out
+}
+
+// statements transforms the statements found at name below the current
+// site.
+func (t *rewriter) statements(name string, stmts []Statement) []Statement {
 	if len(stmts) == 0 {
 		return nil
 	}
+	saved := t.site
+	if name != "" {
+		t.site += "/" + name
+	}
 	out := make([]Statement, 0, len(stmts))
-	for _, stmt := range stmts {
-		out = append(out, g.transformStatement(stmt))
+	for i, stmt := range stmts {
+		site := t.site
+		t.site += "/" + strconv.Itoa(i)
+		out = append(out, t.statement(stmt))
+		t.site = site
 	}
+	t.site = saved
 	return out
 }
 
-func (g *ExpressionGenerator) transformStatement(stmt Statement) Statement {
+func (t *rewriter) statement(stmt Statement) Statement {
 	switch s := stmt.(type) {
 	case *IfStatement:
-		trueBody := g.transformStatements(s.TrueBody)
-		elseBody := g.transformStatements(s.ElseBody)
+		trueBody := t.statements("then", s.TrueBody)
+		elseBody := t.statements("else", s.ElseBody)
 		baseIf := &IfStatement{
 			Condition: cloneExpression(s.Condition),
 			TrueBody:  trueBody,
 			ElseBody:  elseBody,
 		}
-		if !g.EnableControlFlowEquiv || rand.Float64() >= controlFlowTransformProbability {
+		if t.replay != nil {
+			if r := t.recorded(); r != nil {
+				return t.rewriteStatement(baseIf, r.Rule)
+			}
+			return baseIf
+		}
+		if !t.controlFlow || t.rng.Float64() >= controlFlowTransformProbability {
 			return baseIf
 		}
 		if len(baseIf.ElseBody) == 0 {
 			return baseIf
 		}
+		var rules []string
 		var candidates []Statement
 		if candidate, ok := ifToCaseB1(baseIf); ok {
+			rules = append(rules, "ifToCaseB1")
 			candidates = append(candidates, candidate)
 		}
 		if candidate, ok := ifToCaseB2(baseIf); ok {
+			rules = append(rules, "ifToCaseB2")
 			candidates = append(candidates, candidate)
 		}
 		if len(candidates) == 0 {
 			return baseIf
 		}
-		return candidates[rand.Intn(len(candidates))]
+		i := t.rng.Intn(len(candidates))
+		t.record(rules[i], 0, 0, baseIf, candidates[i])
+		return candidates[i]
 	case *CaseStatement:
 		cases := make([]CaseItem, 0, len(s.Cases))
-		for _, c := range s.Cases {
+		for i, c := range s.Cases {
 			cases = append(cases, CaseItem{
 				Value:      c.Value,
-				Statements: g.transformStatements(c.Statements),
+				Statements: t.statements("item"+strconv.Itoa(i), c.Statements),
 			})
 		}
-		defaultBody := g.transformStatements(s.Default)
+		defaultBody := t.statements("default", s.Default)
 		baseCase := &CaseStatement{
 			Expression: cloneExpression(s.Expression),
 			Cases:      cases,
 			Default:    defaultBody,
 		}
-		if !g.EnableControlFlowEquiv || rand.Float64() >= controlFlowTransformProbability {
+		if t.replay != nil {
+			if r := t.recorded(); r != nil {
+				return t.rewriteStatement(baseCase, r.Rule)
+			}
 			return baseCase
 		}
-		if rand.Intn(2) == 0 {
-			if candidate, ok := g.caseToIfChainB4(baseCase); ok {
-				return candidate
-			}
-			if candidate, ok := g.caseAddDeadBranchB3(baseCase); ok {
-				return candidate
-			}
-		} else {
-			if candidate, ok := g.caseAddDeadBranchB3(baseCase); ok {
-				return candidate
-			}
-			if candidate, ok := g.caseToIfChainB4(baseCase); ok {
-				return candidate
+		if !t.controlFlow || t.rng.Float64() >= controlFlowTransformProbability {
+			return baseCase
+		}
+		rules := []string{"caseToIfChainB4", "caseAddDeadBranchB3"}
+		if t.rng.Intn(2) != 0 {
+			rules[0], rules[1] = rules[1], rules[0]
+		}
+		for _, rule := range rules {
+			if out := t.rewriteStatement(baseCase, rule); out != Statement(baseCase) {
+				return out
 			}
 		}
 		return baseCase
@@ -144,6 +183,34 @@ func (g *ExpressionGenerator) transformStatement(stmt Statement) Statement {
 	}
 }
 
+// rewriteStatement applies a control-flow rule to stmt and records it, or
+// returns stmt when the rule does not apply.
+func (t *rewriter) rewriteStatement(stmt Statement, rule string) Statement {
+	var out Statement
+	ok := false
+	switch s := stmt.(type) {
+	case *IfStatement:
+		switch rule {
+		case "ifToCaseB1":
+			out, ok = ifToCaseB1(s)
+		case "ifToCaseB2":
+			out, ok = ifToCaseB2(s)
+		}
+	case *CaseStatement:
+		switch rule {
+		case "caseAddDeadBranchB3":
+			out, ok = caseAddDeadBranchB3(s)
+		case "caseToIfChainB4":
+			out, ok = caseToIfChainB4(s)
+		}
+	}
+	if !ok {
+		return stmt
+	}
+	t.record(rule, 0, 0, stmt, out)
+	return out
+}
+
 func ifToCaseB1(stmt *IfStatement) (Statement, bool) {
 	if stmt == nil || len(stmt.ElseBody) == 0 {
 		return nil, false
@@ -180,7 +247,7 @@ func ifToCaseB2(stmt *IfStatement) (Statement, bool) {
 	}, true
 }
 
-func (g *ExpressionGenerator) caseAddDeadBranchB3(stmt *CaseStatement) (Statement, bool) {
+func caseAddDeadBranchB3(stmt *CaseStatement) (Statement, bool) {
 	if stmt == nil || len(stmt.Cases) == 0 {
 		return nil, false
 	}
@@ -216,7 +283,7 @@ func (g *ExpressionGenerator) caseAddDeadBranchB3(stmt *CaseStatement) (Statemen
 	}, true
 }
 
-func (g *ExpressionGenerator) caseToIfChainB4(stmt *CaseStatement) (Statement, bool) {
+func caseToIfChainB4(stmt *CaseStatement) (Statement, bool) {
 	if stmt == nil || len(stmt.Cases) == 0 {
 		return nil, false
 	}
@@ -0,0 +1,236 @@
+package CodeGenerator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Design is the last generated module, or set of equivalent modules, kept
+// as AST together with its stimulus, so that it can be edited and printed
+// again. The variants share the signals; each has its own assignments and
+// always blocks.
+type Design struct {
+	Name    string
+	Single  bool
+	Inputs  []*Variable
+	Clocks  []*Variable
+	Outputs []*Variable
+	// Vars are the internal wires and regs in declaration order.
+	Vars []*Variable
+	// OutputTerms are the signals summed into the first output.
+	OutputTerms []*Variable
+	Variants    []*Variant
+	// XInputs are the inputs the testbenches drive with X.
+	XInputs []*Variable
+	// Stimulus holds one row per vector: the inputs, then the clocks.
+	Stimulus [][]uint64
+}
+
+type Variant struct {
+	Assigns []*AssignExpression
+	Blocks  []*AlwaysBlock
+	// Rewrites made the variant from the first one.
+	Rewrites []*Rewrite
+}
+
+// newDesign records the signals of the current module. single designs print
+// as one module named after the generator, others as <name>_eq<i>.
+func (g *ExpressionGenerator) newDesign(outputTerms []*Variable, single bool) *Design {
+	d := &Design{
+		Name:        g.Name,
+		Single:      single,
+		Inputs:      append([]*Variable(nil), g.InputPortVars...),
+		Clocks:      append([]*Variable(nil), g.ClockVars...),
+		Outputs:     append([]*Variable(nil), g.OutputVars...),
+		OutputTerms: append([]*Variable(nil), outputTerms...),
+	}
+	g.pendingRewrites = nil
+	for _, v := range g.CurrentDefinedVars {
+		if !containsVar(g.InputVars, v) && !containsVar(g.OutputVars, v) {
+			d.Vars = append(d.Vars, v)
+		}
+	}
+	return d
+}
+
+func (d *Design) addVariant(rewrites []*Rewrite, assigns []*AssignExpression, blocks ...*AlwaysBlock) {
+	describe(rewrites)
+	vr := &Variant{Assigns: assigns, Rewrites: rewrites}
+	for _, b := range blocks {
+		if b != nil {
+			vr.Blocks = append(vr.Blocks, b)
+		}
+	}
+	d.Variants = append(d.Variants, vr)
+}
+
+// String prints the design the way the generator printed it.
+func (d *Design) String() string {
+	var sb strings.Builder
+	sb.WriteString("`timescale 1ns/1ps\n")
+	for i, vr := range d.Variants {
+		if d.Single {
+			sb.WriteString(d.module(d.Name, vr))
+			continue
+		}
+		sb.WriteString(d.module(fmt.Sprintf("%s_eq%d", d.Name, i), vr))
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+func (d *Design) module(name string, vr *Variant) string {
+	var ports []string
+	for _, group := range [][]*Variable{d.Inputs, d.Clocks, d.Outputs} {
+		for _, v := range group {
+			ports = append(ports, v.Name)
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "module %s (%s);\n\n", name, strings.Join(ports, ", "))
+	for _, v := range d.Inputs {
+		sb.WriteString(declString("input ", v))
+	}
+	for _, v := range d.Clocks {
+		sb.WriteString(declString("input ", v))
+	}
+	for _, v := range d.Vars {
+		sb.WriteString(declString("", v))
+	}
+	for _, v := range d.Outputs {
+		sb.WriteString(declString("output ", v))
+	}
+	sb.WriteString("\n")
+	for _, a := range vr.Assigns {
+		sb.WriteString(a.GenerateString() + "\n")
+	}
+	if len(d.Outputs) > 0 {
+		sb.WriteString(buildOutputAssign(d.Outputs[0], d.OutputTerms))
+	}
+	for _, b := range vr.Blocks {
+		sb.WriteString(b.GenerateString() + "\n")
+	}
+	sb.WriteString("endmodule\n")
+	return sb.String()
+}
+
+// Size is what reducing a design makes smaller: the length of its text plus
+// the bits of its signals, so that narrowing a signal counts even when its
+// declaration gets no shorter, plus the vectors of its stimulus and how far
+// each value is from 0.
+func (d *Design) Size() int {
+	size := len(d.String())
+	for _, group := range [][]*Variable{d.Inputs, d.Clocks, d.Vars, d.Outputs} {
+		for _, v := range group {
+			size += v.GetWidth()
+		}
+	}
+	columns := d.columns()
+	for _, row := range d.Stimulus {
+		size++
+		for c, value := range row {
+			if c < len(columns) {
+				size += stimulusCost(value, columns[c])
+			}
+		}
+	}
+	return size
+}
+
+func declString(dir string, v *Variable) string {
+	signedStr := ""
+	if v.isSigned {
+		signedStr = "signed"
+	}
+	kind := "wire"
+	if v.Type == VarTypeReg {
+		kind = "reg"
+	}
+	if v.hasRange {
+		return fmt.Sprintf("%s%s %s [%d:%d] %s;\n", dir, kind, signedStr, v.Range.r, v.Range.l, v.Name)
+	}
+	return fmt.Sprintf("%s%s %s %s;\n", dir, kind, signedStr, v.Name)
+}
+
+// SetInput reads the stimulus from the text of an input file.
+func (d *Design) SetInput(input string) error {
+	columns := len(d.Inputs) + len(d.Clocks)
+	var rows [][]uint64
+	for _, line := range strings.Split(input, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != columns {
+			return fmt.Errorf("input line %d: %d values, want %d", len(rows)+1, len(fields), columns)
+		}
+		row := make([]uint64, columns)
+		for i, field := range fields {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return fmt.Errorf("input line %d: %w", len(rows)+1, err)
+			}
+			row[i] = value
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return errors.New("input: no vectors")
+	}
+	d.Stimulus = rows
+	return nil
+}
+
+// Input prints the stimulus like GenerateInputFile.
+func (d *Design) Input() string {
+	var sb strings.Builder
+	for _, row := range d.Stimulus {
+		for i, value := range row {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			sb.WriteString(strconv.FormatUint(value, 10))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// LoadDesign makes d the current module of g, so that the testbench,
+// reference and CXXRTL generators describe it. The testbenches print its
+// internal signals if g observes them, and drive d.XInputs with X.
+func (g *ExpressionGenerator) LoadDesign(d *Design) {
+	g.Name = d.Name
+	g.InputPortVars = d.Inputs
+	g.ClockVars = d.Clocks
+	g.InputVars = append(append([]*Variable(nil), d.Inputs...), d.Clocks...)
+	g.OutputVars = d.Outputs
+	g.CurrentDefinedVars = append(append(append([]*Variable(nil), g.InputVars...), d.Vars...), d.Outputs...)
+	g.TestBenchTestTime = len(d.Stimulus)
+	g.fixedXInputs = make(map[*Variable]struct{})
+	for _, v := range d.XInputs {
+		g.fixedXInputs[v] = struct{}{}
+	}
+	g.Model = g.newModel(d.Variants[0].Assigns, d.Variants[0].Blocks, d.OutputTerms)
+	g.Design = d
+}
+
+// undefinedInputs picks the inputs a testbench drives with X. A loaded
+// design keeps the ones it had; otherwise the pick is recorded in g.Design.
+func (g *ExpressionGenerator) undefinedInputs() map[*Variable]struct{} {
+	if g.fixedXInputs != nil {
+		return g.fixedXInputs
+	}
+	picked := pickUndefinedInputs(g.Rand, g.InputPortVars, g.EnableXInputs)
+	if g.Design != nil && len(picked) > 0 {
+		g.Design.XInputs = nil
+		for _, v := range g.InputPortVars {
+			if _, ok := picked[v]; ok {
+				g.Design.XInputs = append(g.Design.XInputs, v)
+			}
+		}
+	}
+	return picked
+}
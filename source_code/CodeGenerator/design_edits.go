@@ -0,0 +1,641 @@
+package CodeGenerator
+
+import "fmt"
+
+// Edit is one candidate simplification of a Design. Apply makes it and
+// returns the function that takes it back, or nil when it does not apply
+// any more, e.g. because an earlier edit removed its site.
+type Edit struct {
+	Desc  string
+	Apply func() (undo func())
+}
+
+// ReducePasses are the kinds of edits Edits offers, coarsest first.
+var ReducePasses = []string{"variants", "signals", "statements", "expressions", "widths", "inputs", "cycles", "stimulus"}
+
+// Edits lists the edits of one pass over the current design.
+func (d *Design) Edits(pass string) []Edit {
+	switch pass {
+	case "variants":
+		return d.variantEdits()
+	case "signals":
+		return d.signalEdits()
+	case "statements":
+		return d.statementEdits()
+	case "expressions":
+		return d.expressionEdits()
+	case "widths":
+		return d.widthEdits()
+	case "inputs":
+		return d.inputEdits()
+	case "cycles":
+		return d.cycleEdits()
+	case "stimulus":
+		return d.stimulusEdits()
+	}
+	return nil
+}
+
+// undoLog collects how to take back the changes of one edit.
+type undoLog []func()
+
+func setUndo[T any](u *undoLog, p *T, v T) {
+	old := *p
+	*p = v
+	*u = append(*u, func() { *p = old })
+}
+
+func (u undoLog) undo() {
+	for i := len(u) - 1; i >= 0; i-- {
+		u[i]()
+	}
+}
+
+func (u undoLog) result() func() {
+	if len(u) == 0 {
+		return nil
+	}
+	return u.undo
+}
+
+func indexOf[T comparable](list []T, x T) int {
+	for i, item := range list {
+		if item == x {
+			return i
+		}
+	}
+	return -1
+}
+
+// without returns a copy of list without its i-th element.
+func without[T any](list []T, i int) []T {
+	return append(append([]T(nil), list[:i]...), list[i+1:]...)
+}
+
+func (d *Design) variantEdits() []Edit {
+	var edits []Edit
+	for i, vr := range d.Variants {
+		vr := vr
+		edits = append(edits, Edit{Desc: fmt.Sprintf("drop variant eq%d", i), Apply: func() func() {
+			i := indexOf(d.Variants, vr)
+			if i < 0 || len(d.Variants) == 1 {
+				return nil
+			}
+			var u undoLog
+			setUndo(&u, &d.Variants, without(d.Variants, i))
+			return u.result()
+		}})
+	}
+	return edits
+}
+
+// signalEdits delete an internal signal: its assignments go and every read
+// of it becomes a zero of the same size.
+func (d *Design) signalEdits() []Edit {
+	var edits []Edit
+	for _, v := range d.Vars {
+		v := v
+		edits = append(edits, Edit{Desc: "delete " + v.Name, Apply: func() func() {
+			i := indexOf(d.Vars, v)
+			if i < 0 {
+				return nil
+			}
+			var u undoLog
+			d.replaceUses(&u, v)
+			for _, vr := range d.Variants {
+				var assigns []*AssignExpression
+				for _, a := range vr.Assigns {
+					if a.Operand1 != v {
+						assigns = append(assigns, a)
+					}
+				}
+				if len(assigns) != len(vr.Assigns) {
+					setUndo(&u, &vr.Assigns, assigns)
+				}
+				for _, b := range vr.Blocks {
+					removeAssignmentsTo(&u, &b.Statements, v)
+					if j := indexOf(b.UsedVars, v); j >= 0 {
+						setUndo(&u, &b.UsedVars, without(b.UsedVars, j))
+					}
+				}
+			}
+			if j := indexOf(d.OutputTerms, v); j >= 0 {
+				setUndo(&u, &d.OutputTerms, without(d.OutputTerms, j))
+			}
+			setUndo(&u, &d.Vars, without(d.Vars, i))
+			return u.result()
+		}})
+	}
+	return edits
+}
+
+// replaceUses puts a zero of the same size in place of every read of v.
+func (d *Design) replaceUses(u *undoLog, v *Variable) {
+	for _, p := range d.exprSlots() {
+		if x, ok := (*p).(*VariableExpression); ok && x.Var == v {
+			w, s := exprSize(x)
+			setUndo(u, p, newZero(w, s))
+		}
+	}
+}
+
+func removeAssignmentsTo(u *undoLog, stmts *[]Statement, v *Variable) {
+	kept := make([]Statement, 0, len(*stmts))
+	for _, stmt := range *stmts {
+		switch s := stmt.(type) {
+		case *NonBlockingAssignment:
+			if s.Target == v {
+				continue
+			}
+		case *BlockingAssignment:
+			if s.Target == v {
+				continue
+			}
+		case *IfStatement:
+			removeAssignmentsTo(u, &s.TrueBody, v)
+			removeAssignmentsTo(u, &s.ElseBody, v)
+		case *CaseStatement:
+			for i := range s.Cases {
+				removeAssignmentsTo(u, &s.Cases[i].Statements, v)
+			}
+			removeAssignmentsTo(u, &s.Default, v)
+		}
+		kept = append(kept, stmt)
+	}
+	if len(kept) != len(*stmts) {
+		setUndo(u, stmts, kept)
+	}
+}
+
+// statementEdits drop always blocks, their reset and extra clocks, and
+// replace an if or case by one of its branches.
+func (d *Design) statementEdits() []Edit {
+	var edits []Edit
+	for _, b := range d.blocks() {
+		b := b
+		edits = append(edits, Edit{Desc: "drop always block", Apply: func() func() {
+			var u undoLog
+			for _, vr := range d.Variants {
+				if i := indexOf(vr.Blocks, b); i >= 0 {
+					setUndo(&u, &vr.Blocks, without(vr.Blocks, i))
+				}
+			}
+			return u.result()
+		}})
+		edits = append(edits, Edit{Desc: "drop reset", Apply: func() func() {
+			if b.ResetVar == nil {
+				return nil
+			}
+			var u undoLog
+			setUndo(&u, &b.ResetVar, nil)
+			return u.result()
+		}})
+		for _, clock := range b.ClockVars {
+			clock := clock
+			edits = append(edits, Edit{Desc: "drop clock " + clock.Name, Apply: func() func() {
+				i := indexOf(b.ClockVars, clock)
+				if i < 0 || len(b.ClockVars) == 1 {
+					return nil
+				}
+				var u undoLog
+				if len(b.ClockPosedge) == len(b.ClockVars) {
+					setUndo(&u, &b.ClockPosedge, without(b.ClockPosedge, i))
+				}
+				setUndo(&u, &b.ClockVars, without(b.ClockVars, i))
+				return u.result()
+			}})
+		}
+		eachStatementList(&b.Statements, func(list *[]Statement, stmt Statement) {
+			switch s := stmt.(type) {
+			case *IfStatement:
+				edits = append(edits,
+					spliceEdit("if: keep then", list, stmt, func() []Statement { return s.TrueBody }),
+					spliceEdit("if: keep else", list, stmt, func() []Statement { return s.ElseBody }))
+			case *CaseStatement:
+				for i := range s.Cases {
+					i := i
+					edits = append(edits, spliceEdit(fmt.Sprintf("case: keep item %d", i), list, stmt, func() []Statement {
+						if i >= len(s.Cases) {
+							return nil
+						}
+						return s.Cases[i].Statements
+					}))
+				}
+				edits = append(edits, spliceEdit("case: keep default", list, stmt, func() []Statement { return s.Default }))
+			}
+		})
+	}
+	return edits
+}
+
+// blocks returns the always blocks of all variants, each once.
+func (d *Design) blocks() []*AlwaysBlock {
+	var blocks []*AlwaysBlock
+	for _, vr := range d.Variants {
+		for _, b := range vr.Blocks {
+			if indexOf(blocks, b) < 0 {
+				blocks = append(blocks, b)
+			}
+		}
+	}
+	return blocks
+}
+
+func eachStatementList(list *[]Statement, fn func(list *[]Statement, stmt Statement)) {
+	for _, stmt := range *list {
+		fn(list, stmt)
+		switch s := stmt.(type) {
+		case *IfStatement:
+			eachStatementList(&s.TrueBody, fn)
+			eachStatementList(&s.ElseBody, fn)
+		case *CaseStatement:
+			for i := range s.Cases {
+				eachStatementList(&s.Cases[i].Statements, fn)
+			}
+			eachStatementList(&s.Default, fn)
+		}
+	}
+}
+
+// spliceEdit replaces stmt in list by the statements body returns.
+func spliceEdit(desc string, list *[]Statement, stmt Statement, body func() []Statement) Edit {
+	return Edit{Desc: desc, Apply: func() func() {
+		i := indexOf(*list, stmt)
+		if i < 0 {
+			return nil
+		}
+		spliced := append(append(append([]Statement(nil), (*list)[:i]...), body()...), (*list)[i+1:]...)
+		var u undoLog
+		setUndo(&u, list, spliced)
+		return u.result()
+	}}
+}
+
+// expressionEdits replace each subexpression, outermost first, by a zero
+// of its size, by one of its operands or by a one.
+func (d *Design) expressionEdits() []Edit {
+	var edits []Edit
+	for _, p := range d.exprSlots() {
+		p := p
+		edits = append(edits, d.replaceEdit("zero", p, func(e Expression) Expression {
+			if isZero(e) {
+				return nil
+			}
+			w, s := exprSize(e)
+			return newZero(w, s)
+		}))
+		for i := range operands(*p) {
+			i := i
+			edits = append(edits, d.replaceEdit(fmt.Sprintf("operand %d", i), p, func(e Expression) Expression {
+				if ops := operands(e); i < len(ops) {
+					return ops[i]
+				}
+				return nil
+			}))
+		}
+		edits = append(edits, d.replaceEdit("one", p, func(e Expression) Expression {
+			if _, ok := e.(*NumberExpression); ok {
+				return nil
+			}
+			w, s := exprSize(e)
+			return newConst(1, max(w, 1), s)
+		}))
+	}
+	return edits
+}
+
+// replaceEdit replaces the expression at p by what with returns for it,
+// if p is still part of the design.
+func (d *Design) replaceEdit(desc string, p *Expression, with func(Expression) Expression) Edit {
+	return Edit{Desc: "replace by " + desc, Apply: func() func() {
+		if indexOf(d.exprSlots(), p) < 0 {
+			return nil
+		}
+		e := with(*p)
+		if e == nil {
+			return nil
+		}
+		var u undoLog
+		setUndo(&u, p, e)
+		return u.result()
+	}}
+}
+
+func operands(e Expression) []Expression {
+	switch x := e.(type) {
+	case *BinaryExpression:
+		return []Expression{x.Left, x.Right}
+	case *UnaryExpression:
+		return []Expression{x.Operand}
+	case *TernaryExpression:
+		return []Expression{x.TrueExpr, x.FalseExpr, x.Condition}
+	case *ConcatenationExpression:
+		return x.Expressions
+	case *ReplicationExpression:
+		return []Expression{x.Expression}
+	}
+	return nil
+}
+
+// exprSlots returns every place of the design that holds an expression,
+// outermost first and each once. The divisor of / and % is left out but
+// for the x of its {1'b1, x}, so that it never becomes zero, and so is the
+// count of a replication.
+func (d *Design) exprSlots() []*Expression {
+	var slots []*Expression
+	seen := make(map[*Expression]bool)
+	var walk func(p *Expression)
+	walk = func(p *Expression) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		slots = append(slots, p)
+		switch x := (*p).(type) {
+		case *BinaryExpression:
+			walk(&x.Left)
+			if x.Operator != "/" && x.Operator != "%" {
+				walk(&x.Right)
+			} else if c, ok := x.Right.(*ConcatenationExpression); ok {
+				for i := 1; i < len(c.Expressions); i++ {
+					walk(&c.Expressions[i])
+				}
+			}
+		case *UnaryExpression:
+			walk(&x.Operand)
+		case *TernaryExpression:
+			walk(&x.Condition)
+			walk(&x.TrueExpr)
+			walk(&x.FalseExpr)
+		case *ConcatenationExpression:
+			for i := range x.Expressions {
+				walk(&x.Expressions[i])
+			}
+		case *ReplicationExpression:
+			walk(&x.Expression)
+		}
+	}
+	for _, vr := range d.Variants {
+		for _, a := range vr.Assigns {
+			walk(&a.Right)
+		}
+	}
+	for _, b := range d.blocks() {
+		eachStatementList(&b.Statements, func(_ *[]Statement, stmt Statement) {
+			switch s := stmt.(type) {
+			case *IfStatement:
+				walk(&s.Condition)
+			case *CaseStatement:
+				walk(&s.Expression)
+			case *NonBlockingAssignment:
+				walk(&s.Expression)
+			case *BlockingAssignment:
+				walk(&s.Expression)
+			}
+		})
+	}
+	return slots
+}
+
+// widthEdits narrow a signal to one bit or to half its width.
+func (d *Design) widthEdits() []Edit {
+	var edits []Edit
+	for _, group := range [][]*Variable{d.Inputs, d.Vars, d.Outputs} {
+		for _, v := range group {
+			if v.GetWidth() == 1 {
+				continue
+			}
+			edits = append(edits,
+				d.narrowEdit(v, func(int) int { return 1 }),
+				d.narrowEdit(v, func(w int) int { return (w + 1) / 2 }))
+		}
+	}
+	return edits
+}
+
+// narrowEdit gives v the width to returns for its current one, keeping its
+// lowest index and every bit a part-select of it uses.
+func (d *Design) narrowEdit(v *Variable, to func(int) int) Edit {
+	return Edit{Desc: "narrow " + v.Name, Apply: func() func() {
+		if !v.hasRange {
+			return nil
+		}
+		high := v.Range.l + to(v.GetWidth()) - 1
+		selected := d.highestSelected(v)
+		high = max(high, selected)
+		if high >= v.Range.r {
+			return nil
+		}
+		var u undoLog
+		if high == v.Range.l && selected < 0 && v.Range.l == 0 {
+			setUndo(&u, &v.hasRange, false)
+			setUndo(&u, &v.Range, nil)
+		} else {
+			setUndo(&u, &v.Range, &BitRange{l: v.Range.l, r: high})
+		}
+		return u.result()
+	}}
+}
+
+// highestSelected returns the highest index of v a part-select reads or
+// writes, or -1.
+func (d *Design) highestSelected(v *Variable) int {
+	high := -1
+	for _, p := range d.exprSlots() {
+		if x, ok := (*p).(*VariableExpression); ok && x.Var == v && x.hasRange {
+			high = max(high, x.Range.r)
+		}
+	}
+	for _, vr := range d.Variants {
+		for _, a := range vr.Assigns {
+			if a.Operand1 == v && a.UsedRange != nil {
+				high = max(high, a.UsedRange.r)
+			}
+		}
+	}
+	for _, b := range d.blocks() {
+		eachStatementList(&b.Statements, func(_ *[]Statement, stmt Statement) {
+			switch s := stmt.(type) {
+			case *NonBlockingAssignment:
+				if s.Target == v && s.Range != nil {
+					high = max(high, s.Range.r)
+				}
+			case *BlockingAssignment:
+				if s.Target == v && s.Range != nil {
+					high = max(high, s.Range.r)
+				}
+			}
+		})
+	}
+	return high
+}
+
+// inputEdits drop a data input: its reads become zeros and its column
+// leaves the stimulus.
+func (d *Design) inputEdits() []Edit {
+	var edits []Edit
+	for _, v := range d.Inputs {
+		v := v
+		edits = append(edits, Edit{Desc: "drop input " + v.Name, Apply: func() func() {
+			i := indexOf(d.Inputs, v)
+			if i < 0 {
+				return nil
+			}
+			for _, b := range d.blocks() {
+				if b.ResetVar == v || indexOf(b.ClockVars, v) >= 0 {
+					return nil
+				}
+			}
+			var u undoLog
+			d.replaceUses(&u, v)
+			stimulus := make([][]uint64, len(d.Stimulus))
+			for r, row := range d.Stimulus {
+				stimulus[r] = without(row, i)
+			}
+			setUndo(&u, &d.Stimulus, stimulus)
+			if j := indexOf(d.XInputs, v); j >= 0 {
+				setUndo(&u, &d.XInputs, without(d.XInputs, j))
+			}
+			setUndo(&u, &d.Inputs, without(d.Inputs, i))
+			return u.result()
+		}})
+	}
+	// a clock no block is triggered by can go too, but the testbenches
+	// need one
+	for _, v := range d.Clocks {
+		v := v
+		edits = append(edits, Edit{Desc: "drop clock input " + v.Name, Apply: func() func() {
+			i := indexOf(d.Clocks, v)
+			if i < 0 || len(d.Clocks) == 1 {
+				return nil
+			}
+			for _, b := range d.blocks() {
+				if b.ResetVar == v || indexOf(b.ClockVars, v) >= 0 {
+					return nil
+				}
+			}
+			var u undoLog
+			d.replaceUses(&u, v)
+			stimulus := make([][]uint64, len(d.Stimulus))
+			for r, row := range d.Stimulus {
+				stimulus[r] = without(row, len(d.Inputs)+i)
+			}
+			setUndo(&u, &d.Stimulus, stimulus)
+			setUndo(&u, &d.Clocks, without(d.Clocks, i))
+			return u.result()
+		}})
+	}
+	return edits
+}
+
+// cycleEdits drop one vector of the stimulus, keeping at least one.
+func (d *Design) cycleEdits() []Edit {
+	var edits []Edit
+	for _, row := range d.Stimulus {
+		row := row
+		edits = append(edits, Edit{Desc: fmt.Sprintf("drop cycle %d", len(edits)), Apply: func() func() {
+			i := rowIndex(d.Stimulus, row)
+			if i < 0 || len(d.Stimulus) == 1 {
+				return nil
+			}
+			var u undoLog
+			setUndo(&u, &d.Stimulus, without(d.Stimulus, i))
+			return u.result()
+		}})
+	}
+	return edits
+}
+
+// rowIndex finds row in rows by identity: edits keep the rows they leave.
+func rowIndex(rows [][]uint64, row []uint64) int {
+	for i, r := range rows {
+		if len(r) == 0 || len(row) == 0 {
+			if len(r) == len(row) {
+				return i
+			}
+			continue
+		}
+		if &r[0] == &row[0] {
+			return i
+		}
+	}
+	return -1
+}
+
+// stimulusEdits zero an input in every vector, then set single values to
+// 0, 1 or all ones, the last only for inputs that allOnes can fill.
+func (d *Design) stimulusEdits() []Edit {
+	columns := d.columns()
+	var edits []Edit
+	for _, v := range columns {
+		v := v
+		edits = append(edits, Edit{Desc: "zero input " + v.Name, Apply: func() func() {
+			c := indexOf(d.columns(), v)
+			if c < 0 {
+				return nil
+			}
+			var u undoLog
+			for _, row := range d.Stimulus {
+				if row[c] != 0 {
+					setUndo(&u, &row[c], 0)
+				}
+			}
+			return u.result()
+		}})
+	}
+	for r, row := range d.Stimulus {
+		row := row
+		for _, v := range columns {
+			v := v
+			values := []uint64{0, 1}
+			if ones, ok := allOnes(v); ok {
+				values = append(values, ones)
+			}
+			for _, to := range values {
+				to := to
+				edits = append(edits, Edit{Desc: fmt.Sprintf("set %s in cycle %d to %d", v.Name, r, to), Apply: func() func() {
+					c := indexOf(d.columns(), v)
+					if c < 0 || rowIndex(d.Stimulus, row) < 0 || stimulusCost(row[c], v) <= stimulusCost(to, v) {
+						return nil
+					}
+					var u undoLog
+					setUndo(&u, &row[c], to)
+					return u.result()
+				}})
+			}
+		}
+	}
+	return edits
+}
+
+// columns are the signals of the stimulus columns: the inputs, then the
+// clocks.
+func (d *Design) columns() []*Variable {
+	return append(append([]*Variable(nil), d.Inputs...), d.Clocks...)
+}
+
+// allOnes is v with every bit set. It is not there for inputs wider than
+// maxInputRange draws values for.
+func allOnes(v *Variable) (uint64, bool) {
+	width := v.GetWidth()
+	r := uint64(maxInputRange(width))
+	if width >= 64 || width > 0 && r != 1<<uint(width) {
+		return 0, false
+	}
+	return r - 1, true
+}
+
+// stimulusCost orders the values a stimulus edit may set: 0, 1, all ones,
+// then anything else.
+func stimulusCost(value uint64, v *Variable) int {
+	switch value {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	}
+	if ones, ok := allOnes(v); ok && value == ones {
+		return 2
+	}
+	return 3
+}
@@ -0,0 +1,81 @@
+package CodeGenerator
+
+import (
+	"strings"
+	"testing"
+)
+
+// reduceStimulus runs the cycles and stimulus passes one edit at a time,
+// taking an edit back when holds stops holding.
+func reduceStimulus(d *Design, holds func() bool) {
+	for _, pass := range []string{"cycles", "stimulus"} {
+		for _, e := range d.Edits(pass) {
+			if undo := e.Apply(); undo != nil && !holds() {
+				undo()
+			}
+		}
+	}
+}
+
+// The stub oracle holds while some vector drives in0 with a nonzero value.
+func TestStimulusPasses(t *testing.T) {
+	in0, in1, wide := signal("in0", 8, false), signal("in1", 4, false), signal("wide", 64, false)
+	clk := signal("clock_0", 1, false)
+	d := &Design{Inputs: []*Variable{in0, in1, wide}, Clocks: []*Variable{clk}, Stimulus: [][]uint64{
+		{0, 3, 1 << 40, 1},
+		{17, 9, 5, 0},
+		{0, 0, 7, 1},
+		{200, 15, 1<<62 - 1, 1},
+	}}
+	holds := func() bool {
+		for _, row := range d.Stimulus {
+			if row[0] != 0 {
+				return true
+			}
+		}
+		return false
+	}
+	reduceStimulus(d, holds)
+	if len(d.Stimulus) != 1 {
+		t.Fatalf("%d vectors left, want 1: %v", len(d.Stimulus), d.Stimulus)
+	}
+	if got := d.Stimulus[0]; got[0] != 1 || got[1] != 0 || got[2] != 0 || got[3] != 0 {
+		t.Errorf("vector %v, want [1 0 0 0]", got)
+	}
+
+	// the stimulus cannot fill a 64-bit input, so it gets no all-ones edit
+	d.Stimulus = [][]uint64{{5, 5, 5, 0}}
+	var descs []string
+	for _, e := range d.Edits("stimulus") {
+		descs = append(descs, e.Desc)
+	}
+	all := strings.Join(descs, "\n")
+	for _, want := range []string{"set in0 in cycle 0 to 255", "set in1 in cycle 0 to 15", "set clock_0 in cycle 0 to 1", "set wide in cycle 0 to 1"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("no edit %q in\n%s", want, all)
+		}
+	}
+	if n := strings.Count(all, "set wide in cycle 0"); n != 2 {
+		t.Errorf("%d edits set wide, want 0 and 1 only:\n%s", n, all)
+	}
+}
+
+func TestAllOnes(t *testing.T) {
+	tests := []struct {
+		width int
+		want  uint64
+		ok    bool
+	}{
+		{1, 1, true},
+		{8, 255, true},
+		{62, 1<<62 - 1, true},
+		{63, 0, false},
+		{64, 0, false},
+		{100, 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := allOnes(signal("v", tt.width, false)); got != tt.want || ok != tt.ok {
+			t.Errorf("width %d: allOnes = %d, %v; want %d, %v", tt.width, got, ok, tt.want, tt.ok)
+		}
+	}
+}
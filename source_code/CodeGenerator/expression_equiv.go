@@ -1,6 +1,6 @@
 package CodeGenerator
 
-import "math/rand"
+import "strconv"
 
 func (b *BinaryExpression) clone(left, right Expression, op string) *BinaryExpression {
 	return &BinaryExpression{
@@ -16,105 +16,117 @@ func (b *BinaryExpression) clone(left, right Expression, op string) *BinaryExpre
 	}
 }
 
-func (b *BinaryExpression) EquivalentTrans() Expression {
-	left := b.Left.EquivalentTrans()
-	right := b.Right.EquivalentTrans()
+func (b *BinaryExpression) EquivalentTrans(t *rewriter) Expression {
+	left := t.child("l", b.Left)
+	right := t.child("r", b.Right)
+	rewrite := func(rule string, e Expression) Expression {
+		r := t.record(rule, 0, 0, b.clone(left, right, b.Operator), e)
+		if e == left || e == right {
+			// e is not new: the rewrite holds where b is gone
+			r.replaced = b
+		}
+		return e
+	}
 
 	switch b.Operator {
 	case "+", "*", "&", "|", "^":
-		if rand.Float64() < 0.5 {
-			return b.clone(right, left, b.Operator)
+		if t.maybe("commute") {
+			return rewrite("commute", b.clone(right, left, b.Operator))
 		}
 	}
 
-	if b.Operator == ">=" {
-		return b.clone(right, left, "<=")
+	if b.Operator == ">=" && t.fire("swap-compare") {
+		return rewrite("swap-compare", b.clone(right, left, "<="))
 	}
-	if b.Operator == "<=" {
-		return b.clone(right, left, ">=")
+	if b.Operator == "<=" && t.fire("swap-compare") {
+		return rewrite("swap-compare", b.clone(right, left, ">="))
 	}
 
 	if b.Operator == ">>" {
-		if n, ok := right.(*NumberExpression); ok && n.Value.Value >= uint64(effectiveWidth(b)) {
-			return newZero(effectiveWidth(b), effectiveSignedness(b))
+		if n, ok := right.(*NumberExpression); ok && n.Value.Value >= uint64(effectiveWidth(b)) && t.fire("shift-out") {
+			return rewrite("shift-out", newZero(effectiveWidth(b), effectiveSignedness(b)))
 		}
 	}
 
 	if b.Operator == ">>>" {
 		if n, ok := right.(*NumberExpression); ok &&
 			n.Value.Value >= uint64(effectiveWidth(b)) &&
-			!effectiveSignedness(b) {
+			!effectiveSignedness(b) && t.fire("shift-out") {
 			//if left.GetRealBitWidth() == 0 {
 			//	fmt.Println(left.GenerateString()+"fuck !!!!!!!!!!! ")
 			//}
-			return newZero(effectiveWidth(b), false)
+			return rewrite("shift-out", newZero(effectiveWidth(b), false))
 		}
 	}
 
 	if b.Operator == "<<" {
-		if n, ok := right.(*NumberExpression); ok && n.Value.Value >= uint64(effectiveWidth(b)) {
-			return newZero(effectiveWidth(b), effectiveSignedness(b))
+		if n, ok := right.(*NumberExpression); ok && n.Value.Value >= uint64(effectiveWidth(b)) && t.fire("shift-out") {
+			return rewrite("shift-out", newZero(effectiveWidth(b), effectiveSignedness(b)))
 		}
 	}
 
 	if b.Operator == "<<<" {
-		if n, ok := right.(*NumberExpression); ok && n.Value.Value >= uint64(effectiveWidth(b)) {
-			return newZero(effectiveWidth(b), effectiveSignedness(b))
+		if n, ok := right.(*NumberExpression); ok && n.Value.Value >= uint64(effectiveWidth(b)) && t.fire("shift-out") {
+			return rewrite("shift-out", newZero(effectiveWidth(b), effectiveSignedness(b)))
 		}
 	}
 
 	switch b.Operator {
 	case "+":
 		if isZero(right) && right.GetBitWidth() == left.GetBitWidth() &&
-			right.GetSignedness() == left.GetSignedness() {
-			return left
+			right.GetSignedness() == left.GetSignedness() && t.fire("drop-add-zero") {
+			return rewrite("drop-add-zero", left)
 		}
 		if isZero(left) && left.GetBitWidth() == right.GetBitWidth() &&
-			left.GetSignedness() == right.GetSignedness() {
-			return right
+			left.GetSignedness() == right.GetSignedness() && t.fire("drop-add-zero") {
+			return rewrite("drop-add-zero", right)
 		}
 	case "*":
 		if isOne(right) && right.GetBitWidth() == left.GetBitWidth() &&
-			right.GetSignedness() == left.GetSignedness() {
-			return left
+			right.GetSignedness() == left.GetSignedness() && t.fire("drop-mul-one") {
+			return rewrite("drop-mul-one", left)
 		}
 		if isOne(left) && left.GetBitWidth() == right.GetBitWidth() &&
-			left.GetSignedness() == right.GetSignedness() {
-			return right
+			left.GetSignedness() == right.GetSignedness() && t.fire("drop-mul-one") {
+			return rewrite("drop-mul-one", right)
 		}
 
-		if isZero(left) || isZero(right) {
+		if (isZero(left) || isZero(right)) && t.fire("mul-zero") {
 			w := maxWidth(left, right)
-			return newZero(w, left.GetRealSignedness() && right.GetRealSignedness())
+			return rewrite("mul-zero", newZero(w, left.GetRealSignedness() && right.GetRealSignedness()))
 		}
 	case "/":
 		if isOne(right) && left.GetBitWidth() == right.GetBitWidth() &&
-			left.GetSignedness() == right.GetSignedness() {
-			return left
+			left.GetSignedness() == right.GetSignedness() && t.fire("drop-div-one") {
+			return rewrite("drop-div-one", left)
 		}
 	case "&":
-		if u, ok := right.(*UnaryExpression); ok && u.Operator == "~" && u.Operand.GenerateString() == left.GenerateString() {
+		if u, ok := right.(*UnaryExpression); ok && u.Operator == "~" && u.Operand.GenerateString() == left.GenerateString() && t.fire("and-not-self") {
 			w := effectiveWidth(left)
-			return newZero(w, effectiveSignedness(left))
+			return rewrite("and-not-self", newZero(w, effectiveSignedness(left)))
 		}
 	}
 
 	return b
 }
 
-func (u *UnaryExpression) EquivalentTrans() Expression {
-	if rand.Float64() > 0.5 {
-		u.Operand = u.Operand.EquivalentTrans()
+func (u *UnaryExpression) EquivalentTrans(t *rewriter) Expression {
+	if t.descend() {
+		u.Operand = t.child("op", u.Operand)
 	}
 	return u
 }
 
-func (n *NumberExpression) EquivalentTrans() Expression {
+func (n *NumberExpression) EquivalentTrans(t *rewriter) Expression {
 	width := n.Value.BitWidth
 	signed := n.Value.Signedness
 	if width <= 0 {
 		return n
 	}
+	r := t.recorded()
+	if t.replay != nil && r == nil {
+		return n
+	}
 	ctxWidth := effectiveWidth(n)
 	ctxSigned := effectiveSignedness(n)
 	allowWidthSensitive := ctxWidth == width && ctxSigned == signed
@@ -123,117 +135,135 @@ func (n *NumberExpression) EquivalentTrans() Expression {
 	value := n.Value.Value & mask
 
 	candidates := []Expression{n}
+	names := []string{"keep"}
+	add := func(name string, e Expression) {
+		candidates = append(candidates, e)
+		names = append(names, name)
+	}
 	zero := newConst(0, width, signed)
 	one := newConst(1, width, signed)
 
-	candidates = append(candidates, &BinaryExpression{Left: n, Right: zero, Operator: "+"})
-	candidates = append(candidates, &BinaryExpression{Left: zero, Right: n, Operator: "+"})
+	add("add-zero", &BinaryExpression{Left: n, Right: zero, Operator: "+"})
+	add("zero-add", &BinaryExpression{Left: zero, Right: n, Operator: "+"})
 	if !(signed && width == 1) {
-		candidates = append(candidates, &BinaryExpression{Left: n, Right: one, Operator: "*"})
-		candidates = append(candidates, &BinaryExpression{Left: one, Right: n, Operator: "*"})
-		candidates = append(candidates, &BinaryExpression{Left: n, Right: one, Operator: "/"})
+		add("mul-one", &BinaryExpression{Left: n, Right: one, Operator: "*"})
+		add("one-mul", &BinaryExpression{Left: one, Right: n, Operator: "*"})
+		add("div-one", &BinaryExpression{Left: n, Right: one, Operator: "/"})
 	}
 
 	if !signed {
 		unsignedZero := newConst(0, width, false)
 		unsignedOnes := newConst(allOnesValue(width), width, false)
-		candidates = append(candidates, &BinaryExpression{Left: n, Right: unsignedZero, Operator: "|"})
+		add("or-zero", &BinaryExpression{Left: n, Right: unsignedZero, Operator: "|"})
 		if allowWidthSensitive {
-			candidates = append(candidates, &BinaryExpression{Left: n, Right: unsignedOnes, Operator: "&"})
+			add("and-ones", &BinaryExpression{Left: n, Right: unsignedOnes, Operator: "&"})
 		}
 	}
 
+	shift := 0
 	if value == 0 {
 		left := newConst(0, width, signed)
-		candidates = append(candidates, &BinaryExpression{
+		add("zero-and-not-zero", &BinaryExpression{
 			Left:     left,
 			Right:    &UnaryExpression{Operator: "~", Operand: newConst(0, width, signed)},
 			Operator: "&",
 		})
 
-		shift := width + rand.Intn(3)
+		if r != nil {
+			shift = r.shift
+		} else {
+			shift = width + t.rng.Intn(3)
+		}
 		shiftVal := uint64(shift)
 		shiftExpr := newConst(shiftVal, bitWidthForValue(shiftVal), false)
 		shiftLeft := newConst(1, width, signed)
-		candidates = append(candidates, &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: "<<"})
-		candidates = append(candidates, &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: ">>"})
-		candidates = append(candidates, &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: "<<<"})
+		add("one-shl-out", &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: "<<"})
+		add("one-shr-out", &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: ">>"})
+		add("one-ashl-out", &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: "<<<"})
 		if !signed {
-			candidates = append(candidates, &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: ">>>"})
+			add("one-ashr-out", &BinaryExpression{Left: shiftLeft, Right: shiftExpr, Operator: ">>>"})
 		}
 	}
 
-	return candidates[rand.Intn(len(candidates))]
+	return t.pick(n, candidates, names, shift)
 }
 
-func (v *VariableExpression) EquivalentTrans() Expression {
+func (v *VariableExpression) EquivalentTrans(t *rewriter) Expression {
 	width := v.GetBitWidth()
 	signed := v.GetSignedness()
 	if width <= 0 {
 		return v
 	}
+	if t.replay != nil && t.recorded() == nil {
+		return v
+	}
 	ctxWidth := effectiveWidth(v)
 	ctxSigned := effectiveSignedness(v)
 	allowWidthSensitive := ctxWidth == width && ctxSigned == signed
 
 	candidates := []Expression{v}
+	names := []string{"keep"}
+	add := func(name string, e Expression) {
+		candidates = append(candidates, e)
+		names = append(names, name)
+	}
 	zero := newConst(0, width, signed)
 	one := newConst(1, width, signed)
 
-	candidates = append(candidates, &BinaryExpression{Left: v, Right: zero, Operator: "+"})
-	candidates = append(candidates, &BinaryExpression{Left: zero, Right: v, Operator: "+"})
+	add("add-zero", &BinaryExpression{Left: v, Right: zero, Operator: "+"})
+	add("zero-add", &BinaryExpression{Left: zero, Right: v, Operator: "+"})
 	if !(signed && width == 1) {
-		candidates = append(candidates, &BinaryExpression{Left: v, Right: one, Operator: "*"})
-		candidates = append(candidates, &BinaryExpression{Left: one, Right: v, Operator: "*"})
-		candidates = append(candidates, &BinaryExpression{Left: v, Right: one, Operator: "/"})
+		add("mul-one", &BinaryExpression{Left: v, Right: one, Operator: "*"})
+		add("one-mul", &BinaryExpression{Left: one, Right: v, Operator: "*"})
+		add("div-one", &BinaryExpression{Left: v, Right: one, Operator: "/"})
 	}
 
 	if !signed {
 		unsignedZero := newConst(0, width, false)
-		candidates = append(candidates, &BinaryExpression{Left: v, Right: unsignedZero, Operator: "|"})
+		add("or-zero", &BinaryExpression{Left: v, Right: unsignedZero, Operator: "|"})
 		if allowWidthSensitive {
 			unsignedOnes := newConst(allOnesValue(width), width, false)
-			candidates = append(candidates, &BinaryExpression{Left: v, Right: unsignedOnes, Operator: "&"})
+			add("and-ones", &BinaryExpression{Left: v, Right: unsignedOnes, Operator: "&"})
 		}
 	}
 
-	return candidates[rand.Intn(len(candidates))]
+	return t.pick(v, candidates, names, 0)
 }
 
-func (t *TernaryExpression) EquivalentTrans() Expression {
-	if rand.Float64() > 0.5 {
-		t.Condition = t.Condition.EquivalentTrans()
+func (t *TernaryExpression) EquivalentTrans(w *rewriter) Expression {
+	if w.descend() {
+		t.Condition = w.child("c", t.Condition)
 	}
-	if rand.Float64() > 0.5 {
-		t.TrueExpr = t.TrueExpr.EquivalentTrans()
+	if w.descend() {
+		t.TrueExpr = w.child("t", t.TrueExpr)
 	}
-	if rand.Float64() > 0.5 {
-		t.FalseExpr = t.FalseExpr.EquivalentTrans()
+	if w.descend() {
+		t.FalseExpr = w.child("f", t.FalseExpr)
 	}
 
 	return t
 }
 
-func (c *ConcatenationExpression) EquivalentTrans() Expression {
+func (c *ConcatenationExpression) EquivalentTrans(t *rewriter) Expression {
 	for i, e := range c.Expressions {
-		if rand.Float64() > 0.5 {
-			c.Expressions[i] = e.EquivalentTrans()
+		if t.descend() {
+			c.Expressions[i] = t.child(strconv.Itoa(i), e)
 		}
 	}
 	return c
 }
 
-func (r *ReplicationExpression) EquivalentTrans() Expression {
-	if rand.Float64() > 0.5 {
-		r.Expression = r.Expression.EquivalentTrans()
+func (r *ReplicationExpression) EquivalentTrans(t *rewriter) Expression {
+	if t.descend() {
+		r.Expression = t.child("e", r.Expression)
 	}
 
 	return r
 }
 
-func (e *AssignExpression) EquivalentTrans() Expression {
+func (e *AssignExpression) EquivalentTrans(t *rewriter) Expression {
 
-	right := e.Right.EquivalentTrans()
+	right := e.Right.EquivalentTrans(t)
 	return &AssignExpression{
 		Operand1:  e.Operand1,
 		Right:     right,
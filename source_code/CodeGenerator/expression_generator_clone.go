@@ -115,7 +115,9 @@ func (g *ExpressionGenerator) ApplyEquivalenceTransforms(assigns []*AssignExpres
 	base := cloneAssignExpressions(assigns)
 	transformed := make([]*AssignExpression, len(base))
 	for i, a := range base {
-		transformed[i] = a.EquivalentTrans().(*AssignExpression)
+		t := g.newRewriter(assignSite(i, a))
+		transformed[i] = a.EquivalentTrans(t).(*AssignExpression)
+		g.pendingRewrites = append(g.pendingRewrites, t.rewrites(transformed[i].Right)...)
 	}
 	return transformed
 }
@@ -2,19 +2,78 @@ package CodeGenerator
 
 import (
 	"fmt"
-	"math/big"
 	"strings"
 )
 
-func genAllOnesHex(n int) string {
-	if n <= 0 {
-		return "0x0"
+// cxxHexValue prints a value as %h does: ceil(N/4) lowercase hex digits.
+const cxxHexValue = `template <std::size_t N>
+std::string hex_value(const cxxrtl::value<N> &val) {
+	std::string s;
+	for (std::size_t i = 0; i < (N + 3) / 4; i++) {
+		uint32_t nibble = (val.data[i / 8] >> (i % 8 * 4)) & 0xf;
+		s.insert(s.begin(), "0123456789abcdef"[nibble]);
 	}
+	return s;
+}`
+
+// cxxRecords writes the outputs of mod to ofs in the record format of the
+// Verilog testbenches, each signal named with suffix.
+func (g *ExpressionGenerator) cxxRecords(mod, suffix string) string {
+	s := ""
+	for i, v := range g.OutputVars {
+		s += fmt.Sprintf("\t\tofs << \"cycle=\" << line_num - 1 << \" signal=%s%s width=%d signed=%d value=\" << hex_value(%s->p_out%d) << \"\\n\";\n",
+			v.Name, suffix, v.GetWidth(), boolFlag(v.isSigned), mod, i)
+	}
+	return s
+}
 
-	ones := new(big.Int).Lsh(big.NewInt(1), uint(n))
-	ones.Sub(ones, big.NewInt(1))
+// cxxVCD dumps the design with vcd_writer when built with -DVEQ_VCD. The
+// samples are stamped with the times at which the Verilog testbench from
+// GenerateTb applies the same values, so the dumps can be compared.
+const cxxVCD = `#ifdef VEQ_VCD
+#include <cxxrtl/cxxrtl_vcd.h>
+#define VEQ_SAMPLE(t) do { vcd.sample(t); vcd_file << vcd.buffer; vcd.buffer.clear(); } while (0)
+#else
+#define VEQ_SAMPLE(t) do {} while (0)
+#endif`
+
+const cxxVCDSetup = `#ifdef VEQ_VCD
+	cxxrtl::debug_items vcd_items;
+	mod->debug_info(vcd_items, "");
+	cxxrtl::vcd_writer vcd;
+	vcd.timescale(1, "ns");
+	vcd.add(vcd_items);
+	std::ofstream vcd_file("waves.vcd");
+#endif`
+
+// cxxWriteObserved prints an internal signal from the debug items. Signals
+// write_cxxrtl optimised away have no item and are skipped.
+const cxxWriteObserved = `void write_observed(std::ofstream &ofs, cxxrtl::debug_items &items, int cycle, const std::string &name, const char *meta) {
+	auto it = items.table.find(name);
+	if (it == items.table.end() || it->second.empty() || it->second.front().curr == nullptr)
+		return;
+	cxxrtl::debug_item &item = it->second.front();
+	if (item.outline)
+		item.outline->eval();
+	std::string s;
+	for (std::size_t i = 0; i < (item.width + 3) / 4; i++) {
+		uint32_t nibble = (item.curr[i / 8] >> (i % 8 * 4)) & 0xf;
+		s.insert(s.begin(), "0123456789abcdef"[nibble]);
+	}
+	ofs << "cycle=" << cycle << " signal=" << meta << " value=" << s << "\n";
+}`
 
-	return fmt.Sprintf("0x%x", ones)
+// cxxObserved writes the internal signals of mod in observability mode.
+func (g *ExpressionGenerator) cxxObserved() string {
+	if g.Model == nil {
+		return ""
+	}
+	s := ""
+	for _, v := range g.Model.Observed {
+		s += fmt.Sprintf("\t\twrite_observed(ofs, items, line_num - 1, \"%s\", \"%s%s width=%d signed=%d\");\n",
+			v.Name, ObservePrefix, v.Name, v.GetWidth(), boolFlag(v.isSigned))
+	}
+	return s
 }
 
 func (g *ExpressionGenerator) GenerateCXXRTLMultiModuleTestBench(equalNumber int) string {
@@ -55,51 +114,9 @@ func (g *ExpressionGenerator) GenerateCXXRTLMultiModuleTestBench(equalNumber int
 		valueIdx++
 	}
 
-	compareStr := ""
-	if len(g.OutputVars) > 0 {
-		out := g.OutputVars[0]
-		width := 1
-		if out.hasRange {
-			width = out.Range.GetWidth()
-		}
-		if out.isSigned {
-			for i := 1; i < equalNumber; i++ {
-				compareStr += fmt.Sprintf("if (truncate_signed(mod0->p_out0) != truncate_signed(mod%d->p_out0)) {\n", i)
-				compareStr += "    std::cerr << \"Mismatch at line \" << line_num << std::endl;\n"
-				compareStr += "    return 1;\n}\n"
-			}
-		} else {
-			mask := genAllOnesHex(width)
-			for i := 1; i < equalNumber; i++ {
-				compareStr += fmt.Sprintf("if ((mod0->p_out0.get<uint32_t>() & %s) != (mod%d->p_out0.get<uint32_t>() & %s)) {\n",
-					mask, i, mask)
-				compareStr += "    std::cerr << \"NO\" << std::endl;\n"
-				compareStr += "    return 1;\n}\n"
-			}
-		}
-	}
-
 	outStr := ""
-	for i := 0; i < len(g.OutputVars); i++ {
-		v := g.OutputVars[i]
-		width := 1
-		if v.hasRange {
-			width = v.Range.GetWidth()
-		}
-		bitWidth := genAllOnesHex(width)
-		if v.isSigned {
-			if i != len(g.OutputVars)-1 {
-				outStr += fmt.Sprintf("<< \"%s:\" << truncate_signed(mod0->p_out%d) << \" \"", v.Name, i)
-			} else {
-				outStr += fmt.Sprintf("<< \"%s:\" << truncate_signed(mod0->p_out%d) << std::endl;", v.Name, i)
-			}
-		} else {
-			if i != len(g.OutputVars)-1 {
-				outStr += fmt.Sprintf("<< \"%s:\" << (mod0->p_out%d.get<uint32_t>() & %s) << \" \"", v.Name, i, bitWidth)
-			} else {
-				outStr += fmt.Sprintf("<< \"%s:\" << (mod0->p_out%d.get<uint32_t>() & %s) << std::endl;", v.Name, i, bitWidth)
-			}
-		}
+	for i := 0; i < equalNumber; i++ {
+		outStr += g.cxxRecords(fmt.Sprintf("mod%d", i), fmt.Sprintf("_eq%d", i))
 	}
 
 	includeStr := ""
@@ -122,11 +139,7 @@ func (g *ExpressionGenerator) GenerateCXXRTLMultiModuleTestBench(equalNumber int
 using namespace std;
 using namespace cxxrtl_design;
 
-template <std::size_t N>
-int32_t truncate_signed(cxxrtl::value<N> val) {
-	int32_t raw = val.template get<int32_t>();
-	return (raw << (32 - N)) >> (32 - N);
-}
+%s
 
 std::vector<uint32_t> parse_line(const std::string &line) {
 	std::stringstream ss(line);
@@ -167,17 +180,13 @@ int main() {
 
 %s
 
-%s
-
 %s
 		if (!ofs) return 1;
-		ofs %s
-	}
+%s	}
 
-	std::cout << "All outputs matched." << std::endl;
 	return 0;
 }
-`, includeStr, modDecl, initMods, initStr, stepStr, stepStr, inStr, stepStr, stepStr, compareStr, outStr)
+`, includeStr, cxxHexValue, modDecl, initMods, initStr, stepStr, stepStr, inStr, stepStr, stepStr, outStr)
 
 	return tbStr
 }
@@ -198,7 +207,7 @@ func (g *ExpressionGenerator) GenerateCXXRTLTestBench() string {
 		initStr += fmt.Sprintf("mod->p_in%d  = cxxrtl::value<%d>(0u);\n", i, width)
 		valueIdx++
 	}
-	inStr += "\nmod->step();\n"
+	inStr += "\nmod->step();\nVEQ_SAMPLE(8000 + 4000 * (line_num - 1));\n"
 	//clock vars
 	for i := 0; i < len(g.ClockVars); i++ {
 		v := g.ClockVars[i]
@@ -213,31 +222,9 @@ func (g *ExpressionGenerator) GenerateCXXRTLTestBench() string {
 		initStr += fmt.Sprintf("mod->p_clock__%d  = cxxrtl::value<%d>(0u);\n", i, width)
 		valueIdx++
 	}
-	outStr := ""
-	for i := 0; i < len(g.OutputVars); i++ {
-		v := g.OutputVars[i]
-		var width int
-		if v.hasRange {
-			width = v.Range.GetWidth()
-		} else {
-			width = 1
-		}
-		bitWidth := genAllOnesHex(width)
-		if v.isSigned {
-			if i != len(g.OutputVars)-1 {
-				outStr += fmt.Sprintf("<< \"%s:\" << truncate_signed(mod->p_out%d) << \" \"", g.OutputVars[i].Name, i)
-			} else {
-				outStr += fmt.Sprintf("<< \"%s:\" << truncate_signed(mod->p_out%d) << std::endl;", g.OutputVars[i].Name, i)
-			}
-
-		} else {
-			if i != len(g.OutputVars)-1 {
-				outStr += fmt.Sprintf("<< \"%s:\" << (mod->p_out%d.get<uint32_t>() & %s)  << \" \"", g.OutputVars[i].Name, i, bitWidth)
-			} else {
-				outStr += fmt.Sprintf("<< \"%s:\" << (mod->p_out%d.get<uint32_t>() & %s) << std::endl;", g.OutputVars[i].Name, i, bitWidth)
-			}
-		}
-
+	debugSetup := ""
+	if g.Model != nil && len(g.Model.Observed) > 0 {
+		debugSetup = "\tcxxrtl::debug_items items;\n\tmod->debug_info(items, \"\");\n"
 	}
 	tbStr := fmt.Sprintf(`
 #include <fstream>
@@ -246,16 +233,14 @@ func (g *ExpressionGenerator) GenerateCXXRTLTestBench() string {
 #include <vector>
 #include <string>
 #include "test.cpp"
+%s
     
 using namespace std;
 using namespace cxxrtl_design;
 
-template <std::size_t N>
-int32_t truncate_signed(cxxrtl::value<N> val) {
-    int32_t raw = val.template get<int32_t>();
-    return (raw << (32 - N)) >> (32 - N);
-}
+%s
 
+%s
 
 std::vector<uint32_t> parse_line(const std::string &line) {
 	std::stringstream ss(line);
@@ -269,6 +254,8 @@ std::vector<uint32_t> parse_line(const std::string &line) {
 
 int main() {
 	std::unique_ptr<p_%s> mod = std::make_unique<p_%s>();
+%s
+%s
 	std::ofstream ofs("output.txt");
 	std::ifstream infile("input.txt");
 	if (!infile) {
@@ -284,6 +271,7 @@ int main() {
 	mod->step();
 	mod->step();
 	mod->step();
+	VEQ_SAMPLE(6000);
 	while (std::getline(infile, line)) {
 		line_num++;
 		auto values = parse_line(line);
@@ -293,16 +281,16 @@ int main() {
 		mod->step();
 		mod->step();
 		mod->step();
+		VEQ_SAMPLE(10000 + 4000 * (line_num - 1));
 
 
 		if (!ofs) return 1;
-		ofs %s
-	}
+%s	}
 
 	return 0;
 }
 
-`, g.Name, g.Name, initStr, inStr, outStr)
+`, cxxVCD, cxxHexValue, cxxWriteObserved, g.Name, g.Name, cxxVCDSetup, debugSetup, initStr, inStr, g.cxxRecords("mod", "")+g.cxxObserved())
 	return tbStr
 }
 
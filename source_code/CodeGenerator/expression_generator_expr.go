@@ -13,7 +13,7 @@ func (g *ExpressionGenerator) GenerateExpression(depth int) Expression {
 		return g.generateBasicExpression()
 	}
 
-	exprType := rand.Intn(6)
+	exprType := g.Rand.Intn(6)
 
 	switch exprType {
 	case 0:
@@ -41,7 +41,7 @@ func (g *ExpressionGenerator) GenerateExpression(depth int) Expression {
 }
 
 func (g *ExpressionGenerator) generateBasicExpression() Expression {
-	if rand.Intn(2) == 0 && len(g.CurrentDefinedVars) > 0 {
+	if g.Rand.Intn(2) == 0 && len(g.CurrentDefinedVars) > 0 {
 		return g.generateVariableExpression()
 	}
 	return g.generateNumberExpression()
@@ -55,7 +55,7 @@ func (g *ExpressionGenerator) generateBinaryExpression(depth int) Expression {
 		"==", "!=", "===", "!==", "<", "<=", ">", ">=",
 		"<<", ">>", "<<<", ">>>",
 	}
-	operator := operators[rand.Intn(len(operators))]
+	operator := operators[g.Rand.Intn(len(operators))]
 
 	left := g.GenerateExpression(depth - 1)
 	var right Expression
@@ -101,7 +101,7 @@ func (g *ExpressionGenerator) generateShiftAmountExpression(left Expression) Exp
 	}
 	value := 0
 	if limit > 0 {
-		value = rand.Intn(limit + 1)
+		value = g.Rand.Intn(limit + 1)
 	}
 	width := bitsNeeded(value)
 	return &NumberExpression{
@@ -116,7 +116,7 @@ func (g *ExpressionGenerator) generateShiftAmountExpression(left Expression) Exp
 func (g *ExpressionGenerator) generateUnaryExpression(depth int) Expression {
 	operators := []string{"!", "~", "-"}
 
-	operator := operators[rand.Intn(len(operators))]
+	operator := operators[g.Rand.Intn(len(operators))]
 
 	operand := g.GenerateExpression(depth - 1)
 
@@ -145,10 +145,10 @@ func (g *ExpressionGenerator) generateVariableExpression() Expression {
 		return g.generateNumberExpression()
 	}
 
-	variable := g.CurrentDefinedVars[rand.Intn(len(g.CurrentDefinedVars))]
-	if variable.hasRange && rand.Float64() > 0.8 {
-		r := variable.Range.l + rand.Intn(variable.Range.r-variable.Range.l+1)
-		l := variable.Range.l + rand.Intn(r-variable.Range.l+1)
+	variable := g.CurrentDefinedVars[g.Rand.Intn(len(g.CurrentDefinedVars))]
+	if variable.hasRange && g.Rand.Float64() > 0.8 {
+		r := variable.Range.l + g.Rand.Intn(variable.Range.r-variable.Range.l+1)
+		l := variable.Range.l + g.Rand.Intn(r-variable.Range.l+1)
 		return &VariableExpression{
 			Var:      variable,
 			hasRange: true,
@@ -177,39 +177,39 @@ func parseInt(valueStr string, base int) int {
 	return int(val)
 }
 
-func GenerateRandomNumber() string {
-	format := rand.Intn(4)
+func GenerateRandomNumber(rng *rand.Rand) string {
+	format := rng.Intn(4)
 
 	var numStr string
 	switch format {
 	case 0:
-		value := rand.Intn(1000)
+		value := rng.Intn(1000)
 		width := bitsNeeded(value)
 		numStr = fmt.Sprintf("%d'd%d", width, value)
 
 	case 1:
-		length := rand.Intn(10) + 1 // 1 到 10 位
+		length := rng.Intn(10) + 1 // 1 到 10 位
 		binStr := ""
 		for i := 0; i < length; i++ {
-			binStr += fmt.Sprintf("%d", rand.Intn(2))
+			binStr += fmt.Sprintf("%d", rng.Intn(2))
 		}
-		numStr = fmt.Sprintf("%d'b%s", length+rand.Intn(6), binStr)
+		numStr = fmt.Sprintf("%d'b%s", length+rng.Intn(6), binStr)
 
 	case 2:
-		digits := rand.Intn(4) + 1
+		digits := rng.Intn(4) + 1
 		octStr := ""
 		for i := 0; i < digits; i++ {
-			octStr += fmt.Sprintf("%o", rand.Intn(8))
+			octStr += fmt.Sprintf("%o", rng.Intn(8))
 		}
 		value := parseInt(octStr, 8)
 		width := bitsNeeded(value)
 		numStr = fmt.Sprintf("%d'o%s", width, octStr)
 
 	case 3:
-		digits := rand.Intn(3) + 1
+		digits := rng.Intn(3) + 1
 		hexStr := ""
 		for i := 0; i < digits; i++ {
-			hexStr += fmt.Sprintf("%x", rand.Intn(16))
+			hexStr += fmt.Sprintf("%x", rng.Intn(16))
 		}
 		value := parseInt(hexStr, 16)
 		width := bitsNeeded(value)
@@ -220,19 +220,19 @@ func GenerateRandomNumber() string {
 
 func (g *ExpressionGenerator) generateNumberExpression() Expression {
 	return &NumberExpression{
-		Value: RandomConstNumber(),
+		Value: RandomConstNumber(g.Rand),
 	}
 }
 
 func (g *ExpressionGenerator) generateConcatenationExpression(depth int) Expression {
-	numExprs := rand.Intn(3) + 2
+	numExprs := g.Rand.Intn(3) + 2
 	exprs := make([]Expression, 0, numExprs)
 
 	for i := 0; i < numExprs; i++ {
-		if rand.Float64() < -1 {
-			count := rand.Intn(8) + 1
+		if g.Rand.Float64() < -1 {
+			count := g.Rand.Intn(8) + 1
 			countExpr := &NumberExpression{
-				Value: RandomConstNumberWithBitWidth(count, false),
+				Value: RandomConstNumberWithBitWidth(g.Rand, count, false),
 			}
 			expr := g.GenerateExpression(depth - 1)
 			exprs = append(exprs, &ReplicationExpression{
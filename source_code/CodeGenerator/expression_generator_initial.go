@@ -10,6 +10,7 @@ type initialModuleParts struct {
 	combAssigns []*AssignExpression
 	seqBlock    *AlwaysBlock
 	outputStr   string
+	outputTerms []*Variable
 	isInput     map[*Variable]struct{}
 	isOutput    map[*Variable]struct{}
 }
@@ -60,12 +61,12 @@ func (g *ExpressionGenerator) generateInitialModuleParts() *initialModuleParts {
 		openSlots[i] = i
 	}
 
-	seqBlock := NewAlwaysBlock(AlwaysFF)
+	seqBlock := NewAlwaysBlock(AlwaysFF, g.Rand)
 	var clockVar *Variable
 	if len(g.ClockVars) > 0 {
-		clockVar = g.ClockVars[rand.Intn(len(g.ClockVars))]
+		clockVar = g.ClockVars[g.Rand.Intn(len(g.ClockVars))]
 	} else if len(g.InputVars) > 0 {
-		clockVar = g.InputVars[rand.Intn(len(g.InputVars))]
+		clockVar = g.InputVars[g.Rand.Intn(len(g.InputVars))]
 	}
 	if clockVar != nil {
 		seqBlock.SetClock(clockVar)
@@ -88,7 +89,7 @@ func (g *ExpressionGenerator) generateInitialModuleParts() *initialModuleParts {
 			if remainingSeqSlots >= remainingSignals {
 				useSeq = true
 			} else {
-				useSeq = rand.Float64() < 0.5
+				useSeq = g.Rand.Float64() < 0.5
 			}
 		}
 
@@ -105,7 +106,7 @@ func (g *ExpressionGenerator) generateInitialModuleParts() *initialModuleParts {
 		g.CurrentDefinedVars = append(g.CurrentDefinedVars, newVar)
 
 		if useSeq {
-			slotIdx := rand.Intn(len(openSlots))
+			slotIdx := g.Rand.Intn(len(openSlots))
 			pos := openSlots[slotIdx]
 			openSlots = append(openSlots[:slotIdx], openSlots[slotIdx+1:]...)
 			seqStatements[pos] = g.buildSeqStatement(expr, newVar, g.CurrentDefinedVars, depth, defs)
@@ -169,11 +170,13 @@ func (g *ExpressionGenerator) generateInitialModuleParts() *initialModuleParts {
 	g.CurrentDefinedVars = append(g.CurrentDefinedVars, outputVar)
 
 	outputStr := buildOutputAssign(outputVar, unused)
+	g.Model = g.newModel(combAssigns, []*AlwaysBlock{seqBlock}, unused)
 
 	return &initialModuleParts{
 		combAssigns: combAssigns,
 		seqBlock:    seqBlock,
 		outputStr:   outputStr,
+		outputTerms: unused,
 		isInput:     isInput,
 		isOutput:    isOutput,
 	}
@@ -186,7 +189,7 @@ func resetVarAttrs(v *Variable) {
 }
 
 func (g *ExpressionGenerator) buildSeqStatement(expr Expression, target *Variable, pool []*Variable, depthMap map[*Variable]int, defs map[*Variable]Expression) Statement {
-	choice := rand.Float64()
+	choice := g.Rand.Float64()
 	if choice < 0.5 {
 		return NewNonBlockingAssignment(target, expr, nil)
 	}
@@ -194,7 +197,7 @@ func (g *ExpressionGenerator) buildSeqStatement(expr Expression, target *Variabl
 		condition := g.GenerateExpressionFromPool(g.MaxDepth, pool, depthMap, defs)
 		ifStmt := NewIfStatement(condition)
 		ifStmt.AddTrueStatement(NewNonBlockingAssignment(target, expr, nil))
-		if rand.Float64() < 0.5 {
+		if g.Rand.Float64() < 0.5 {
 			ifStmt.AddElseStatement(NewNonBlockingAssignment(target, expr, nil))
 		}
 		return ifStmt
@@ -202,13 +205,13 @@ func (g *ExpressionGenerator) buildSeqStatement(expr Expression, target *Variabl
 
 	caseExpr := g.GenerateExpressionFromPool(g.MaxDepth, pool, depthMap, defs)
 	caseStmt := NewCaseStatement(caseExpr)
-	numCases := rand.Intn(3) + 2
+	numCases := g.Rand.Intn(3) + 2
 	for i := 0; i < numCases; i++ {
-		caseStmt.AddCase(GenerateRandomNumber(), []Statement{
+		caseStmt.AddCase(GenerateRandomNumber(g.Rand), []Statement{
 			NewNonBlockingAssignment(target, expr, nil),
 		})
 	}
-	if rand.Float64() < 0.7 {
+	if g.Rand.Float64() < 0.7 {
 		caseStmt.AddDefault([]Statement{
 			NewNonBlockingAssignment(target, expr, nil),
 		})
@@ -229,7 +232,7 @@ func (g *ExpressionGenerator) inferAttrsByDepth(vars []*Variable, depth map[*Var
 		}
 
 		if !signedSet[v] {
-			signed := balanceSignedness(defs[v], signedSet)
+			signed := balanceSignedness(g.Rand, defs[v], signedSet)
 			setVarSignedness(v, signed)
 			signedSet[v] = true
 		}
@@ -258,7 +261,7 @@ func (g *ExpressionGenerator) randomWidth() int {
 	if max < min {
 		max = min
 	}
-	return rand.Intn(max-min+1) + min
+	return g.Rand.Intn(max-min+1) + min
 }
 
 func setVarWidth(v *Variable, width int) {
@@ -278,13 +281,13 @@ func setVarSignedness(v *Variable, signed bool) {
 	v.isSigned = signed
 }
 
-func balanceSignedness(expr Expression, signedSet map[*Variable]bool) bool {
+func balanceSignedness(rng *rand.Rand, expr Expression, signedSet map[*Variable]bool) bool {
 	signed, unsigned := countSignedness(expr, signedSet)
 	if signed == 0 && unsigned == 0 {
-		return rand.Float64() < 0.5
+		return rng.Float64() < 0.5
 	}
 	if signed == unsigned {
-		return rand.Float64() < 0.5
+		return rng.Float64() < 0.5
 	}
 	return signed < unsigned
 }
@@ -2,9 +2,7 @@ package CodeGenerator
 
 import (
 	"fmt"
-	"math/rand"
 	"strconv"
-	"time"
 )
 
 func (g *ExpressionGenerator) GenerateInputFile() string {
@@ -18,9 +16,9 @@ func (g *ExpressionGenerator) GenerateInputFile() string {
 				r = maxInputRange(v.Range.GetWidth())
 			}
 			if j != len(g.InputVars)-1 {
-				inputLine += fmt.Sprintf("%d ", rand.Intn(r))
+				inputLine += fmt.Sprintf("%d ", g.Rand.Intn(r))
 			} else {
-				inputLine += fmt.Sprintf("%d\n", rand.Intn(r))
+				inputLine += fmt.Sprintf("%d\n", g.Rand.Intn(r))
 			}
 		}
 		res += inputLine
@@ -46,10 +44,6 @@ func maxInputRange(width int) int {
 	return r
 }
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 func (g *ExpressionGenerator) GetRandomVariable(regOnly bool) *Variable {
 	var allVars []*Variable
 	for _, v := range g.CurrentDefinedVars {
@@ -72,8 +66,8 @@ func (g *ExpressionGenerator) GetRandomVariable(regOnly bool) *Variable {
 			return nil
 		}
 
-		return regVars[rand.Intn(len(regVars))]
+		return regVars[g.Rand.Intn(len(regVars))]
 	}
 
-	return allVars[rand.Intn(len(allVars))]
+	return allVars[g.Rand.Intn(len(allVars))]
 }
@@ -2,7 +2,6 @@ package CodeGenerator
 
 import (
 	"fmt"
-	"math/rand"
 	"strings"
 )
 
@@ -10,6 +9,7 @@ type legacyModuleParts struct {
 	assignExpressions []*AssignExpression
 	alwaysBlocks      []*AlwaysBlock
 	outputStr         string
+	outputTerms       []*Variable
 	isInput           map[*Variable]struct{}
 	isOutput          map[*Variable]struct{}
 }
@@ -54,7 +54,7 @@ func (g *ExpressionGenerator) generateLegacyModuleParts() *legacyModuleParts {
 
 	alwaysBlocks := make([]*AlwaysBlock, 0)
 	randomPick := func(slice []*Variable, count int) []*Variable {
-		indices := rand.Perm(len(slice))[:count]
+		indices := g.Rand.Perm(len(slice))[:count]
 		result := make([]*Variable, count)
 		for i, idx := range indices {
 			result[i] = slice[idx]
@@ -69,10 +69,12 @@ func (g *ExpressionGenerator) generateLegacyModuleParts() *legacyModuleParts {
 	outputVar := g.OutputVars[0]
 	outputStr := fmt.Sprintf("    assign %s = ", outputVar.Name)
 	flag := false
+	outputTerms := make([]*Variable, 0)
 	for _, v := range g.CurrentDefinedVars {
 		if _, ok := isInput[v]; ok {
 			continue
 		}
+		outputTerms = append(outputTerms, v)
 		if flag {
 			outputStr += fmt.Sprintf("+ %s ", v.Name)
 		} else {
@@ -82,11 +84,13 @@ func (g *ExpressionGenerator) generateLegacyModuleParts() *legacyModuleParts {
 	}
 	outputStr += ";\n"
 	g.CurrentDefinedVars = append(g.CurrentDefinedVars, outputVar)
+	g.Model = g.newModel(assignExpressions, alwaysBlocks, outputTerms)
 
 	return &legacyModuleParts{
 		assignExpressions: assignExpressions,
 		alwaysBlocks:      alwaysBlocks,
 		outputStr:         outputStr,
+		outputTerms:       outputTerms,
 		isInput:           isInput,
 		isOutput:          isOutput,
 	}
@@ -168,6 +172,8 @@ func (g *ExpressionGenerator) generateLegacyLoopFreeModule() string {
 
 	moduleStr += "endmodule\n"
 
+	g.Design = g.newDesign(parts.outputTerms, true)
+	g.Design.addVariant(nil, parts.assignExpressions, parts.alwaysBlocks...)
 	return moduleStr
 }
 
@@ -184,6 +190,7 @@ func (g *ExpressionGenerator) generateLegacyLoopFreeEquivalentModules(equalNumbe
 	baseAlwaysStr := g.buildAlwaysBlocksString(parts.alwaysBlocks, false)
 
 	modules := make([]string, 0, equalNumber)
+	g.Design = g.newDesign(parts.outputTerms, false)
 
 	for eqIdx := 0; eqIdx < equalNumber; eqIdx++ {
 		currentAssigns := cloneAssignExpressions(baseAssigns)
@@ -251,10 +258,13 @@ func (g *ExpressionGenerator) generateLegacyLoopFreeEquivalentModules(equalNumbe
 		moduleStr += parts.outputStr
 
 		alwaysStr := baseAlwaysStr
+		alwaysBlocks := parts.alwaysBlocks
 		if eqIdx > 0 && g.EnableControlFlowEquiv {
-			alwaysStr = g.buildAlwaysBlocksString(parts.alwaysBlocks, true)
+			alwaysBlocks = g.transformAlwaysBlocks(parts.alwaysBlocks)
+			alwaysStr = g.buildAlwaysBlocksString(alwaysBlocks, false)
 		}
 		moduleStr += alwaysStr
+		g.Design.addVariant(g.takeRewrites(), currentAssigns, alwaysBlocks...)
 
 		moduleStr += "endmodule\n"
 		modules = append(modules, moduleStr)
@@ -80,6 +80,8 @@ func (g *ExpressionGenerator) GenerateLoopFreeModule() string {
 
 	moduleStr += "endmodule\n"
 
+	g.Design = g.newDesign(parts.outputTerms, true)
+	g.Design.addVariant(nil, parts.combAssigns, parts.seqBlock)
 	return moduleStr
 
 }
@@ -104,6 +106,7 @@ func (g *ExpressionGenerator) GenerateLoopFreeEquivalentModules(equalNumber int)
 	}
 
 	modules := make([]string, 0, equalNumber)
+	g.Design = g.newDesign(parts.outputTerms, false)
 
 	for eqIdx := 0; eqIdx < equalNumber; eqIdx++ {
 		currentAssigns := cloneAssignExpressions(baseAssigns)
@@ -166,10 +169,13 @@ func (g *ExpressionGenerator) GenerateLoopFreeEquivalentModules(equalNumber int)
 		moduleStr += parts.outputStr
 
 		seqStr := baseSeqStr
+		seqBlock := parts.seqBlock
 		if eqIdx > 0 && g.EnableControlFlowEquiv {
-			seqStr = g.buildSeqBlockString(parts.seqBlock, true)
+			seqBlock = g.ApplyControlFlowTransforms(parts.seqBlock)
+			seqStr = g.buildSeqBlockString(seqBlock, false)
 		}
 		moduleStr += seqStr
+		g.Design.addVariant(g.takeRewrites(), currentAssigns, seqBlock)
 
 		moduleStr += "endmodule\n"
 		modules = append(modules, moduleStr)
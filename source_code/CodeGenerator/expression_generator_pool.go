@@ -9,7 +9,7 @@ func (g *ExpressionGenerator) GenerateExpressionFromPool(depth int, pool []*Vari
 		return g.generateBasicExpressionFromPool(pool, depthMap, defs)
 	}
 
-	exprType := rand.Intn(6)
+	exprType := g.Rand.Intn(6)
 
 	switch exprType {
 	case 0:
@@ -30,7 +30,7 @@ func (g *ExpressionGenerator) GenerateExpressionFromPool(depth int, pool []*Vari
 }
 
 func (g *ExpressionGenerator) generateBasicExpressionFromPool(pool []*Variable, depthMap map[*Variable]int, defs map[*Variable]Expression) Expression {
-	if rand.Intn(2) == 0 && len(pool) > 0 {
+	if g.Rand.Intn(2) == 0 && len(pool) > 0 {
 		return g.generateVariableExpressionFromPool(pool, depthMap, defs)
 	}
 	return g.generateNumberExpression()
@@ -45,7 +45,7 @@ func (g *ExpressionGenerator) generateBinaryExpressionFromPool(depth int, pool [
 		"<<", ">>", "<<<", ">>>",
 		"<<", ">>", "<<<", ">>>",
 	}
-	operator := operators[rand.Intn(len(operators))]
+	operator := operators[g.Rand.Intn(len(operators))]
 
 	left := g.GenerateExpressionFromPool(depth-1, pool, depthMap, defs)
 	var right Expression
@@ -79,7 +79,7 @@ func (g *ExpressionGenerator) generateBinaryExpressionFromPool(depth int, pool [
 func (g *ExpressionGenerator) generateUnaryExpressionFromPool(depth int, pool []*Variable, depthMap map[*Variable]int, defs map[*Variable]Expression) Expression {
 	operators := []string{"!", "~", "-"}
 
-	operator := operators[rand.Intn(len(operators))]
+	operator := operators[g.Rand.Intn(len(operators))]
 	operand := g.GenerateExpressionFromPool(depth-1, pool, depthMap, defs)
 
 	return &UnaryExpression{
@@ -105,18 +105,18 @@ func (g *ExpressionGenerator) generateVariableExpressionFromPool(pool []*Variabl
 		return g.generateNumberExpression()
 	}
 
-	variable := weightedPickVar(pool, depthMap)
+	variable := weightedPickVar(g.Rand, pool, depthMap)
 	if variable == nil {
 		return g.generateNumberExpression()
 	}
 
-	if expr, ok := defs[variable]; ok && rand.Float64() < 0.4 {
+	if expr, ok := defs[variable]; ok && g.Rand.Float64() < 0.4 {
 		return cloneExpression(expr)
 	}
 
-	if variable.hasRange && rand.Float64() > 0.8 {
-		r := variable.Range.l + rand.Intn(variable.Range.r-variable.Range.l+1)
-		l := variable.Range.l + rand.Intn(r-variable.Range.l+1)
+	if variable.hasRange && g.Rand.Float64() > 0.8 {
+		r := variable.Range.l + g.Rand.Intn(variable.Range.r-variable.Range.l+1)
+		l := variable.Range.l + g.Rand.Intn(r-variable.Range.l+1)
 		return &VariableExpression{
 			Var:      variable,
 			hasRange: true,
@@ -134,14 +134,14 @@ func (g *ExpressionGenerator) generateVariableExpressionFromPool(pool []*Variabl
 }
 
 func (g *ExpressionGenerator) generateConcatenationExpressionFromPool(depth int, pool []*Variable, depthMap map[*Variable]int, defs map[*Variable]Expression) Expression {
-	numExprs := rand.Intn(3) + 2
+	numExprs := g.Rand.Intn(3) + 2
 	exprs := make([]Expression, 0, numExprs)
 
 	for i := 0; i < numExprs; i++ {
-		if rand.Float64() < -1 {
-			count := rand.Intn(8) + 1
+		if g.Rand.Float64() < -1 {
+			count := g.Rand.Intn(8) + 1
 			countExpr := &NumberExpression{
-				Value: RandomConstNumberWithBitWidth(count, false),
+				Value: RandomConstNumberWithBitWidth(g.Rand, count, false),
 			}
 			expr := g.GenerateExpressionFromPool(depth-1, pool, depthMap, defs)
 			exprs = append(exprs, &ReplicationExpression{
@@ -159,7 +159,7 @@ func (g *ExpressionGenerator) generateConcatenationExpressionFromPool(depth int,
 	}
 }
 
-func weightedPickVar(pool []*Variable, depthMap map[*Variable]int) *Variable {
+func weightedPickVar(rng *rand.Rand, pool []*Variable, depthMap map[*Variable]int) *Variable {
 	if len(pool) == 0 {
 		return nil
 	}
@@ -169,9 +169,9 @@ func weightedPickVar(pool []*Variable, depthMap map[*Variable]int) *Variable {
 		total += 1.0 / (1.0 + float64(d))
 	}
 	if total <= 0 {
-		return pool[rand.Intn(len(pool))]
+		return pool[rng.Intn(len(pool))]
 	}
-	r := rand.Float64() * total
+	r := rng.Float64() * total
 	for _, v := range pool {
 		d := depthMap[v]
 		w := 1.0 / (1.0 + float64(d))
@@ -3,22 +3,23 @@ package CodeGenerator
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 )
 
 const undefinedInputProbability = 0.2
 
-func pickUndefinedInputs(vars []*Variable, enable bool) map[*Variable]struct{} {
+func pickUndefinedInputs(rng *rand.Rand, vars []*Variable, enable bool) map[*Variable]struct{} {
 	undefined := make(map[*Variable]struct{})
 	if !enable || len(vars) == 0 {
 		return undefined
 	}
 	for _, v := range vars {
-		if rand.Float64() < undefinedInputProbability {
+		if rng.Float64() < undefinedInputProbability {
 			undefined[v] = struct{}{}
 		}
 	}
 	if len(undefined) == 0 && undefinedInputProbability > 0 {
-		undefined[vars[rand.Intn(len(vars))]] = struct{}{}
+		undefined[vars[rng.Intn(len(vars))]] = struct{}{}
 	}
 	return undefined
 }
@@ -38,10 +39,47 @@ func xLiteralForVar(v *Variable) string {
 	return fmt.Sprintf("{%d{1'bx}}", width)
 }
 
+// outputRecordFormat is the $fwrite format of one output sample: the vector
+// index, the signal name with its width and signedness, and its bits in hex.
+// Model.Simulate and the CXXRTL testbenches print the same records.
+func outputRecordFormat(name string, width int, signed bool) string {
+	return fmt.Sprintf("cycle=%%0d signal=%s width=%d signed=%d value=%%h\\n", name, width, boolFlag(signed))
+}
+
+func boolFlag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeRecords returns one $fwrite per output, each printed as name+suffix.
+func (g *ExpressionGenerator) writeRecords(indent, suffix string) string {
+	s := ""
+	for _, v := range g.OutputVars {
+		s += fmt.Sprintf("%s$fwrite(fout, \"%s\", i, %s%s);\n", indent, outputRecordFormat(v.Name+suffix, v.GetWidth(), v.isSigned), v.Name, suffix)
+	}
+	return s
+}
+
+// writeObserved returns one $fwrite per internal signal of uut in
+// observability mode.
+func (g *ExpressionGenerator) writeObserved(indent string) string {
+	if g.Model == nil {
+		return ""
+	}
+	s := ""
+	for _, v := range g.Model.Observed {
+		name := ObservePrefix + v.Name
+		s += fmt.Sprintf("%s$fwrite(fout, \"%s\", i, %s);\n", indent, outputRecordFormat(name, v.GetWidth(), v.isSigned), name)
+	}
+	return s
+}
+
 func (g *ExpressionGenerator) GenerateTb() string {
 	tbStr := fmt.Sprintf("`timescale 1ns/1ps\n\nmodule tb_dut_module;\n\n    parameter NUM_VECTORS = %d;  // 你想读取的行数\n\n",
 		g.TestBenchTestTime)
-	undefinedInputs := pickUndefinedInputs(g.InputPortVars, g.EnableXInputs)
+	undefinedInputs := g.undefinedInputs()
 	xAssignInit := ""
 	xAssignLoop := ""
 	for _, v := range g.InputPortVars {
@@ -166,23 +204,6 @@ func (g *ExpressionGenerator) GenerateTb() string {
 		}
 
 	}
-	outfmtStr := ""
-	for i := 0; i < len(g.OutputVars); i++ {
-		if i != len(g.OutputVars)-1 {
-			outfmtStr += fmt.Sprintf("%s:%%0d ", g.OutputVars[i].Name)
-		} else {
-			outfmtStr += fmt.Sprintf("%s:%%0d\\n", g.OutputVars[i].Name)
-		}
-	}
-	outVarStr := ""
-	for i := 0; i < len(g.OutputVars); i++ {
-		if i != len(g.OutputVars)-1 {
-			outVarStr += fmt.Sprintf("%s, ", g.OutputVars[i].Name)
-		} else {
-			outVarStr += fmt.Sprintf("%s", g.OutputVars[i].Name)
-		}
-	}
-
 	tbStr += fmt.Sprintf(`
     %s uut  (
 		%s
@@ -191,6 +212,12 @@ func (g *ExpressionGenerator) GenerateTb() string {
     integer fin, fout;
     integer i, status;
     reg [31:0] output_hash;
+`+"`ifdef"+` VEQ_VCD
+    initial begin
+        $dumpfile("waves.vcd");
+        $dumpvars(0, uut);
+    end
+`+"`endif"+`
     initial begin
 
         fin = $fopen("%s", "r");
@@ -225,8 +252,7 @@ func (g *ExpressionGenerator) GenerateTb() string {
 
 %s
             #2000;
-			$fwrite(fout, "%s", %s);
-        end
+%s        end
 
         $fclose(fin);
         $fclose(fout);
@@ -238,14 +264,14 @@ endmodule
 `, g.Name, inputPort, outputPort, g.TestBenchInputFileName,
 		g.TestBenchInputFileName, g.TestBenchOutputFileName, g.TestBenchOutputFileName,
 		initInput, initRegStr, xAssignInit, scanStr, scanClockStr, len(g.InputVars),
-		xAssignLoop, outfmtStr, outVarStr)
+		xAssignLoop, g.writeRecords("\t\t\t", "")+g.writeObserved("\t\t\t"))
 	return tbStr
 }
 
 func (g *ExpressionGenerator) GenerateEquivalenceCheckTb(equalNumber int) string {
 	tbStr := fmt.Sprintf("`timescale 1ns/1ps\n\nmodule tb_equiv_check;\n\nparameter NUM_VECTORS = %d;\n\n", g.TestBenchTestTime)
 
-	undefinedInputs := pickUndefinedInputs(g.InputPortVars, g.EnableXInputs)
+	undefinedInputs := g.undefinedInputs()
 	xAssignInit := ""
 	xAssignLoop := ""
 	for _, v := range g.InputPortVars {
@@ -379,27 +405,9 @@ initial begin
         #20;
 `, g.TestBenchInputFileName, xAssignInit, signalScanStmt, clockScanStmt, totalVars, xAssignLoop)
 
-	tbStr += `        if (
-`
-
-	for i := 1; i < equalNumber; i++ {
-		for j, v := range g.OutputVars {
-			tbStr += fmt.Sprintf("            %s_eq0 !== %s_eq%d", v.Name, v.Name, i)
-			if !(i == equalNumber-1 && j == len(g.OutputVars)-1) {
-				tbStr += " ||\n"
-			} else {
-				tbStr += "\n"
-			}
-		}
+	for i := 0; i < equalNumber; i++ {
+		tbStr += g.writeRecords("        ", fmt.Sprintf("_eq%d", i))
 	}
-
-	tbStr += `        ) begin
-            $fwrite(fout, "NO\n");
-        end else begin
-            $fwrite(fout, "YES\n");
-        end
-`
-
 	tbStr += `
     end
 
@@ -413,3 +421,117 @@ endmodule
 `
 	return tbStr
 }
+
+// GenerateInlineTb prints a testbench for the loaded design that needs no
+// input file: every vector of the stimulus is written out as constants and
+// the outputs go to the console. With one top it times the vectors like
+// GenerateTb, with several like GenerateEquivalenceCheckTb, and then also
+// says in which cycle a top disagrees with the first.
+func (g *ExpressionGenerator) GenerateInlineTb(tops ...string) string {
+	undefinedInputs := g.undefinedInputs()
+	suffix := func(i int) string {
+		if len(tops) == 1 {
+			return ""
+		}
+		return fmt.Sprintf("_eq%d", i)
+	}
+	decl := func(kind string, v *Variable, name string) string {
+		signed := ""
+		if v.isSigned {
+			signed = "signed "
+		}
+		if v.hasRange {
+			return fmt.Sprintf("%s %s[%d:%d] %s;\n", kind, signed, v.Range.r, v.Range.l, name)
+		}
+		return fmt.Sprintf("%s %s%s;\n", kind, signed, name)
+	}
+
+	tbStr := "`timescale 1ns/1ps\n\nmodule tb_inline;\n\n"
+	for _, v := range g.InputVars {
+		tbStr += decl("reg", v, v.Name)
+	}
+	for i := range tops {
+		for _, v := range g.OutputVars {
+			tbStr += decl("wire", v, v.Name+suffix(i))
+		}
+	}
+	for i, top := range tops {
+		tbStr += fmt.Sprintf("\n%s uut%s (\n", top, suffix(i))
+		for _, v := range g.InputVars {
+			tbStr += fmt.Sprintf("    .%s(%s),\n", v.Name, v.Name)
+		}
+		for j, v := range g.OutputVars {
+			sep := ","
+			if j == len(g.OutputVars)-1 {
+				sep = ""
+			}
+			tbStr += fmt.Sprintf("    .%s(%s%s)%s\n", v.Name, v.Name, suffix(i), sep)
+		}
+		tbStr += ");\n"
+	}
+
+	assign := func(v *Variable, value uint64) string {
+		if _, ok := undefinedInputs[v]; ok {
+			return ""
+		}
+		return fmt.Sprintf("    %s = %d'd%d;\n", v.Name, v.GetWidth(), value)
+	}
+	xAssign := ""
+	for _, v := range g.InputPortVars {
+		if _, ok := undefinedInputs[v]; ok {
+			xAssign += fmt.Sprintf("    %s = %s;\n", v.Name, xLiteralForVar(v))
+		}
+	}
+	delay := "    #20;\n"
+	tbStr += "\ninitial begin\n"
+	if len(tops) == 1 {
+		delay = "    #2000;\n"
+		tbStr += delay
+		for _, v := range g.InputPortVars {
+			tbStr += assign(v, 0)
+		}
+		tbStr += delay
+		for _, v := range g.ClockVars {
+			tbStr += assign(v, 0)
+		}
+		tbStr += delay
+		for _, v := range g.CurrentDefinedVars {
+			if v.Type == VarTypeReg {
+				tbStr += fmt.Sprintf("    uut.%s = 0;\n", v.Name)
+			}
+		}
+		tbStr += xAssign + delay
+	} else {
+		tbStr += xAssign
+	}
+
+	var stimulus [][]uint64
+	if g.Design != nil {
+		stimulus = g.Design.Stimulus
+	}
+	for cycle, row := range stimulus {
+		tbStr += fmt.Sprintf("\n    // vector %d\n", cycle)
+		for i, v := range g.InputPortVars {
+			tbStr += assign(v, row[i])
+		}
+		tbStr += delay
+		for i, v := range g.ClockVars {
+			tbStr += assign(v, row[len(g.InputPortVars)+i])
+		}
+		tbStr += delay
+		for i := range tops {
+			for _, v := range g.OutputVars {
+				format := strings.TrimSuffix(outputRecordFormat(v.Name+suffix(i), v.GetWidth(), v.isSigned), "\\n")
+				tbStr += fmt.Sprintf("    $display(\"%s\", %d, %s%s);\n", format, cycle, v.Name, suffix(i))
+			}
+		}
+		for i := 1; i < len(tops); i++ {
+			for _, v := range g.OutputVars {
+				tbStr += fmt.Sprintf("    if (%s%s !== %s%s) $display(\"MISMATCH cycle=%d: %s%s != %s%s\");\n",
+					v.Name, suffix(i), v.Name, suffix(0), cycle, v.Name, suffix(i), v.Name, suffix(0))
+			}
+		}
+	}
+	tbStr += "    $finish;\nend\n\nendmodule\n"
+	return tbStr
+}
@@ -1,10 +1,13 @@
 package CodeGenerator
 
-import "math/rand"
+import (
+	"math/rand"
+	"time"
+)
 
-func GetRandomName() (ans string) {
+func GetRandomName(rng *rand.Rand) (ans string) {
 	for i := 0; i < 10; i++ {
-		ans += string(rune('a' + rand.Intn(26)))
+		ans += string(rune('a' + rng.Intn(26)))
 	}
 	return ans
 }
@@ -37,13 +40,47 @@ type ExpressionGenerator struct {
 	UsePaperInitGen         bool
 	EnableControlFlowEquiv  bool
 	EnableXInputs           bool
+	EnableObservability     bool
+	Seed                    int64
+	Rand                    *rand.Rand
+	Model                   *Model
+	Design                  *Design
+
+	fixedXInputs map[*Variable]struct{}
+	// pendingRewrites are the rewrites made for the variant being built
+	pendingRewrites []*Rewrite
+}
+
+// GeneratorOptions selects the generation strategy of one generator. It is
+// passed at construction time instead of living in package globals, so
+// generators with different options can run side by side.
+type GeneratorOptions struct {
+	UsePaperInitGen        bool
+	EnableControlFlowEquiv bool
+	EnableXInputs          bool
+	// EnableObservability makes the output testbenches also print every
+	// internal signal, see ObservedSignals.
+	EnableObservability bool
 }
 
-var DefaultUsePaperInitGen = true
-var DefaultEnableControlFlowEquiv = false
-var DefaultEnableXInputs = false
+func DefaultGeneratorOptions() GeneratorOptions {
+	return GeneratorOptions{
+		UsePaperInitGen: true,
+	}
+}
 
 func NewExpressionGenerator() *ExpressionGenerator {
+	return NewExpressionGeneratorWithOptions(DefaultGeneratorOptions())
+}
+
+func NewExpressionGeneratorWithOptions(opts GeneratorOptions) *ExpressionGenerator {
+	return NewExpressionGeneratorWithSeed(time.Now().UnixNano(), opts)
+}
+
+// NewExpressionGeneratorWithSeed returns a generator whose every random
+// choice comes from its own source seeded with seed, so the same seed and
+// options always yield the same modules, testbenches and inputs.
+func NewExpressionGeneratorWithSeed(seed int64, opts GeneratorOptions) *ExpressionGenerator {
 	return &ExpressionGenerator{
 		Variables:               make(map[string]*Variable),
 		MaxDepth:                5,
@@ -61,9 +98,12 @@ func NewExpressionGenerator() *ExpressionGenerator {
 		TestBenchInputFileName:  "input.txt",
 		TestBenchOutputFileName: "output.txt",
 		TestBenchTestTime:       20,
-		UsePaperInitGen:         DefaultUsePaperInitGen,
-		EnableControlFlowEquiv:  DefaultEnableControlFlowEquiv,
-		EnableXInputs:           DefaultEnableXInputs,
+		UsePaperInitGen:         opts.UsePaperInitGen,
+		EnableControlFlowEquiv:  opts.EnableControlFlowEquiv,
+		EnableXInputs:           opts.EnableXInputs,
+		EnableObservability:     opts.EnableObservability,
+		Seed:                    seed,
+		Rand:                    rand.New(rand.NewSource(seed)),
 	}
 	//return &ExpressionGenerator{
 	//	Variables:               make(map[string]*Variable),
@@ -1,10 +1,5 @@
 package CodeGenerator
 
-import (
-	"fmt"
-	"math/rand"
-)
-
 func (g *ExpressionGenerator) AddVariable(name string, varType VerilogVarType) *Variable {
 	if _, exists := g.Variables[name]; exists {
 		return g.Variables[name]
@@ -15,17 +10,17 @@ func (g *ExpressionGenerator) AddVariable(name string, varType VerilogVarType) *
 		Type: varType,
 	}
 
-	if rand.Float64() < g.ProbabilityOfRange {
+	if g.Rand.Float64() < g.ProbabilityOfRange {
 		v.hasRange = true
-		r := rand.Intn(g.MaxRangeWidth-g.MinRangeWidth) + g.MinRangeWidth
-		l := rand.Intn(r + 1)
+		r := g.Rand.Intn(g.MaxRangeWidth-g.MinRangeWidth) + g.MinRangeWidth
+		l := g.Rand.Intn(r + 1)
 		v.Range = &BitRange{
 			r: r,
 			l: l,
 		}
 	}
 
-	if rand.Float64() < g.ProbabilityOfSigned {
+	if g.Rand.Float64() < g.ProbabilityOfSigned {
 		v.isSigned = true
 	}
 
@@ -49,16 +44,14 @@ func (g *ExpressionGenerator) AddVariableNotArray(name string, varType VerilogVa
 
 func (g *ExpressionGenerator) AddWireVariable(name string) *Variable {
 	if name == "" {
-		name = fmt.Sprintf("wire_%d", g.WireIndex)
-		g.WireIndex++
+		name = g.GenerateIdentifier(VarTypeWire)
 	}
 	return g.AddVariable(name, VarTypeWire)
 }
 
 func (g *ExpressionGenerator) AddRegVariable(name string) *Variable {
 	if name == "" {
-		name = fmt.Sprintf("reg_%d", g.RegIndex)
-		g.RegIndex++
+		name = g.GenerateIdentifier(VarTypeReg)
 	}
 	return g.AddVariable(name, VarTypeReg)
 }
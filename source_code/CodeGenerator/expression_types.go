@@ -2,7 +2,7 @@ package CodeGenerator
 
 type Expression interface {
 	GenerateString() string
-	EquivalentTrans() Expression
+	EquivalentTrans(t *rewriter) Expression
 	GetBitWidth() int
 	GetSignedness() bool // true is signed; false is unsigned
 	PropagateType(width int, signed bool)
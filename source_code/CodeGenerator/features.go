@@ -0,0 +1,123 @@
+package CodeGenerator
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Features describes the operators in the definition of signal in the last
+// generated module, not those of the signals it reads. Each entry is
+// "<op>:<s|u><width class>", e.g. ">>>:s64"; the classes are 1, 8, 32, 64
+// and wide, so definitions doing the same kind of arithmetic share
+// features. It returns nil for an unknown signal.
+func (g *ExpressionGenerator) Features(signal string) []string {
+	m := g.Model
+	if m == nil {
+		return nil
+	}
+	exprs := make(map[*Variable][]Expression)
+	for _, a := range m.Assigns {
+		exprs[a.Operand1] = append(exprs[a.Operand1], a.Right)
+	}
+	for _, b := range m.Blocks {
+		collectAssignedExprs(b.Statements, nil, exprs)
+	}
+	features := map[string]struct{}{}
+	for v, list := range exprs {
+		if v.Name != signal {
+			continue
+		}
+		for _, e := range list {
+			collectFeatures(e, features)
+		}
+	}
+	if len(features) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(features))
+	for f := range features {
+		list = append(list, f)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// WidthClass buckets a width into 1, 8, 32, 64 or wide.
+func WidthClass(width int) string {
+	switch {
+	case width <= 1:
+		return "1"
+	case width <= 8:
+		return "8"
+	case width <= 32:
+		return "32"
+	case width <= 64:
+		return "64"
+	}
+	return "wide"
+}
+
+func feature(op string, signed bool, widths ...int) string {
+	width := 0
+	for _, w := range widths {
+		width = max(width, w)
+	}
+	sign := "u"
+	if signed {
+		sign = "s"
+	}
+	return fmt.Sprintf("%s:%s%s", op, sign, WidthClass(width))
+}
+
+func collectFeatures(expr Expression, features map[string]struct{}) {
+	switch e := expr.(type) {
+	case *BinaryExpression:
+		signed := e.Left.GetSignedness() && e.Right.GetSignedness()
+		features[feature(e.Operator, signed, e.GetBitWidth(), e.Left.GetBitWidth(), e.Right.GetBitWidth())] = struct{}{}
+		collectFeatures(e.Left, features)
+		collectFeatures(e.Right, features)
+	case *UnaryExpression:
+		features[feature(e.Operator, e.Operand.GetSignedness(), e.GetBitWidth(), e.Operand.GetBitWidth())] = struct{}{}
+		collectFeatures(e.Operand, features)
+	case *TernaryExpression:
+		features[feature("?:", e.GetSignedness(), e.GetBitWidth())] = struct{}{}
+		collectFeatures(e.Condition, features)
+		collectFeatures(e.TrueExpr, features)
+		collectFeatures(e.FalseExpr, features)
+	case *ConcatenationExpression:
+		features[feature("{}", false, e.GetBitWidth())] = struct{}{}
+		for _, part := range e.Expressions {
+			collectFeatures(part, features)
+		}
+	case *ReplicationExpression:
+		features[feature("{{}}", false, e.GetBitWidth())] = struct{}{}
+		collectFeatures(e.Expression, features)
+	case *VariableExpression:
+		if e.hasRange {
+			features[feature("[]", e.GetSignedness(), e.Var.GetWidth())] = struct{}{}
+		}
+	}
+}
+
+// collectAssignedExprs records, for every target assigned in stmts, its
+// right-hand sides and the conditions guarding them.
+func collectAssignedExprs(stmts []Statement, conds []Expression, exprs map[*Variable][]Expression) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *NonBlockingAssignment:
+			exprs[s.Target] = append(append(exprs[s.Target], s.Expression), conds...)
+		case *BlockingAssignment:
+			exprs[s.Target] = append(append(exprs[s.Target], s.Expression), conds...)
+		case *IfStatement:
+			inner := append(append([]Expression(nil), conds...), s.Condition)
+			collectAssignedExprs(s.TrueBody, inner, exprs)
+			collectAssignedExprs(s.ElseBody, inner, exprs)
+		case *CaseStatement:
+			inner := append(append([]Expression(nil), conds...), s.Expression)
+			for _, c := range s.Cases {
+				collectAssignedExprs(c.Statements, inner, exprs)
+			}
+			collectAssignedExprs(s.Default, inner, exprs)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package CodeGenerator
+
+import "strings"
+
+// ObservePrefix names the internal signals the testbenches print in
+// observability mode: the hierarchical path through the uut instance.
+const ObservePrefix = "uut."
+
+// ObservedSignal describes one internal signal of an observed module.
+// Level is its depth in the dependency graph, inputs being level 0, so the
+// lowest divergent level is the topologically earliest divergence.
+type ObservedSignal struct {
+	Name       string `json:"name"`
+	Width      int    `json:"width"`
+	Signed     bool   `json:"signed"`
+	Level      int    `json:"level"`
+	Definition string `json:"definition"`
+}
+
+// observedVars lists every wire and reg of the module that is neither a
+// port nor a clock.
+func (g *ExpressionGenerator) observedVars() []*Variable {
+	if !g.EnableObservability {
+		return nil
+	}
+	var vars []*Variable
+	for _, v := range g.CurrentDefinedVars {
+		if !containsVar(g.InputVars, v) && !containsVar(g.OutputVars, v) {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// ObservedSignals describes the internal signals the testbenches print for
+// the last generated module, and the first output, in dependency order.
+func (g *ExpressionGenerator) ObservedSignals() []ObservedSignal {
+	m := g.Model
+	if m == nil || len(m.Observed) == 0 {
+		return nil
+	}
+	deps := make(map[*Variable]map[*Variable]struct{})
+	defs := make(map[*Variable][]string)
+	for _, a := range m.Assigns {
+		used := make(map[*Variable]struct{})
+		collectVarsInExpr(a.Right, used)
+		deps[a.Operand1] = used
+		defs[a.Operand1] = append(defs[a.Operand1], strings.TrimSpace(a.GenerateString()))
+	}
+	for _, b := range m.Blocks {
+		collectAssignedDeps(b.Statements, nil, deps, defs)
+	}
+
+	levels := make(map[*Variable]int)
+	var level func(v *Variable) int
+	level = func(v *Variable) int {
+		if l, ok := levels[v]; ok {
+			return l
+		}
+		// a register may feed itself; it counts as its own source
+		levels[v] = 0
+		l := 0
+		for d := range deps[v] {
+			if d != v {
+				l = max(l, level(d)+1)
+			}
+		}
+		levels[v] = l
+		return l
+	}
+
+	vars := append(append([]*Variable(nil), m.Observed...), m.Outputs...)
+	signals := make([]ObservedSignal, 0, len(vars))
+	for _, v := range vars {
+		name := v.Name
+		if containsVar(m.Observed, v) {
+			name = ObservePrefix + name
+		}
+		signals = append(signals, ObservedSignal{
+			Name:       name,
+			Width:      v.GetWidth(),
+			Signed:     v.isSigned,
+			Level:      level(v),
+			Definition: strings.Join(defs[v], " "),
+		})
+	}
+	return signals
+}
+
+// collectAssignedDeps records, for every target assigned in stmts, the
+// signals its value depends on: its right-hand sides and the conditions
+// guarding them.
+func collectAssignedDeps(stmts []Statement, conds []Expression, deps map[*Variable]map[*Variable]struct{}, defs map[*Variable][]string) {
+	add := func(target *Variable, e Expression, text string) {
+		if deps[target] == nil {
+			deps[target] = make(map[*Variable]struct{})
+		}
+		collectVarsInExpr(e, deps[target])
+		for _, c := range conds {
+			collectVarsInExpr(c, deps[target])
+		}
+		defs[target] = append(defs[target], text)
+	}
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *NonBlockingAssignment:
+			add(s.Target, s.Expression, s.GenerateString())
+		case *BlockingAssignment:
+			add(s.Target, s.Expression, s.GenerateString())
+		case *IfStatement:
+			inner := append(append([]Expression(nil), conds...), s.Condition)
+			collectAssignedDeps(s.TrueBody, inner, deps, defs)
+			collectAssignedDeps(s.ElseBody, inner, deps, defs)
+		case *CaseStatement:
+			inner := append(append([]Expression(nil), conds...), s.Expression)
+			for _, c := range s.Cases {
+				collectAssignedDeps(c.Statements, inner, deps, defs)
+			}
+			collectAssignedDeps(s.Default, inner, deps, defs)
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package CodeGenerator
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// The reference evaluator sizes expressions on its own, following IEEE 1364
+// 5.4 and 5.5, instead of reusing GetBitWidth: the generator widens + and *
+// so that no carry is lost, while a simulator keeps max(L(i), L(j)) bits.
+
+// refError aborts an evaluation the evaluator cannot model, e.g. a value
+// that would be X. Simulate turns it back into an error.
+type refError string
+
+func (e refError) Error() string {
+	return "reference: " + string(e)
+}
+
+func refFail(format string, args ...any) {
+	panic(refError(fmt.Sprintf(format, args...)))
+}
+
+var bigOne = big.NewInt(1)
+
+// truncate returns v modulo 2^w, i.e. its low w bits as a non-negative
+// number. big.Int bit operations use two's complement, so v may be negative.
+func truncate(v *big.Int, w int) *big.Int {
+	m := new(big.Int).Lsh(bigOne, uint(w))
+	m.Sub(m, bigOne)
+	return m.And(m, v)
+}
+
+// toSigned reads the w-bit pattern v as a two's complement number.
+func toSigned(v *big.Int, w int) *big.Int {
+	if w == 0 || v.Bit(w-1) == 0 {
+		return new(big.Int).Set(v)
+	}
+	return new(big.Int).Sub(v, new(big.Int).Lsh(bigOne, uint(w)))
+}
+
+// extend widens the w-bit pattern v to the expression width, sign-extending
+// when the expression is signed.
+func extend(v *big.Int, w int, signed bool, to int) *big.Int {
+	if signed {
+		return truncate(toSigned(v, w), to)
+	}
+	return truncate(v, to)
+}
+
+func boolValue(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return big.NewInt(0)
+}
+
+// exprSize returns the self-determined width and signedness of e.
+func exprSize(e Expression) (int, bool) {
+	switch x := e.(type) {
+	case *NumberExpression:
+		return x.Value.BitWidth, x.Value.Signedness
+	case *VariableExpression:
+		if x.hasRange {
+			return x.Range.GetWidth(), false
+		}
+		return x.Var.GetWidth(), x.Var.isSigned
+	case *UnaryExpression:
+		switch x.Operator {
+		case "-", "+", "~":
+			return exprSize(x.Operand)
+		}
+		return 1, false
+	case *BinaryExpression:
+		lw, ls := exprSize(x.Left)
+		rw, rs := exprSize(x.Right)
+		switch x.Operator {
+		case "==", "!=", "===", "!==", "<", "<=", ">", ">=", "&&", "||":
+			return 1, false
+		case "<<", ">>", "<<<", ">>>", "**":
+			return lw, ls
+		}
+		return max(lw, rw), ls && rs
+	case *TernaryExpression:
+		tw, ts := exprSize(x.TrueExpr)
+		fw, fs := exprSize(x.FalseExpr)
+		return max(tw, fw), ts && fs
+	case *ConcatenationExpression:
+		w := 0
+		for _, sub := range x.Expressions {
+			sw, _ := exprSize(sub)
+			w += sw
+		}
+		return w, false
+	case *ReplicationExpression:
+		w, _ := exprSize(x.Expression)
+		return replicationCount(x) * w, false
+	}
+	refFail("unsupported expression %T", e)
+	return 0, false
+}
+
+func replicationCount(r *ReplicationExpression) int {
+	n, ok := r.Count.(*NumberExpression)
+	if !ok {
+		refFail("non-constant replication count")
+	}
+	return int(n.Value.Value & (1<<n.Value.BitWidth - 1))
+}
+
+// eval computes e in a context of width w and signedness s, as decided by
+// the enclosing expression, and returns the low w bits.
+func (r *refSim) eval(e Expression, w int, s bool) *big.Int {
+	switch x := e.(type) {
+	case *NumberExpression:
+		v := new(big.Int).SetUint64(x.Value.Value)
+		return extend(truncate(v, x.Value.BitWidth), x.Value.BitWidth, s, w)
+	case *VariableExpression:
+		v := r.read(x.Var)
+		if !x.hasRange {
+			return extend(v, x.Var.GetWidth(), s, w)
+		}
+		low := 0
+		if x.Var.hasRange {
+			low = x.Range.l - x.Var.Range.l
+		}
+		part := truncate(new(big.Int).Rsh(v, uint(low)), x.Range.GetWidth())
+		return extend(part, x.Range.GetWidth(), s, w)
+	case *UnaryExpression:
+		return r.evalUnary(x, w, s)
+	case *BinaryExpression:
+		return r.evalBinary(x, w, s)
+	case *TernaryExpression:
+		if r.truth(x.Condition) {
+			return r.eval(x.TrueExpr, w, s)
+		}
+		return r.eval(x.FalseExpr, w, s)
+	case *ConcatenationExpression:
+		v := new(big.Int)
+		for _, sub := range x.Expressions {
+			sw, ss := exprSize(sub)
+			v.Lsh(v, uint(sw))
+			v.Or(v, r.eval(sub, sw, ss))
+		}
+		return truncate(v, w)
+	case *ReplicationExpression:
+		sw, ss := exprSize(x.Expression)
+		part := r.eval(x.Expression, sw, ss)
+		v := new(big.Int)
+		for i := 0; i < replicationCount(x); i++ {
+			v.Lsh(v, uint(sw))
+			v.Or(v, part)
+		}
+		return truncate(v, w)
+	}
+	refFail("unsupported expression %T", e)
+	return nil
+}
+
+// selfEval evaluates a self-determined operand.
+func (r *refSim) selfEval(e Expression) (*big.Int, int, bool) {
+	w, s := exprSize(e)
+	return r.eval(e, w, s), w, s
+}
+
+func (r *refSim) truth(e Expression) bool {
+	v, _, _ := r.selfEval(e)
+	return v.Sign() != 0
+}
+
+func (r *refSim) evalUnary(u *UnaryExpression, w int, s bool) *big.Int {
+	switch u.Operator {
+	case "+":
+		return r.eval(u.Operand, w, s)
+	case "-":
+		return truncate(new(big.Int).Neg(r.eval(u.Operand, w, s)), w)
+	case "~":
+		return truncate(new(big.Int).Not(r.eval(u.Operand, w, s)), w)
+	}
+
+	v, ow, _ := r.selfEval(u.Operand)
+	var bit bool
+	switch u.Operator {
+	case "!":
+		bit = v.Sign() == 0
+	case "&":
+		bit = v.Cmp(truncate(big.NewInt(-1), ow)) == 0
+	case "~&":
+		bit = v.Cmp(truncate(big.NewInt(-1), ow)) != 0
+	case "|":
+		bit = v.Sign() != 0
+	case "~|":
+		bit = v.Sign() == 0
+	case "^":
+		bit = parity(v)
+	case "~^", "^~":
+		bit = !parity(v)
+	default:
+		refFail("unsupported unary operator %s", u.Operator)
+	}
+	return truncate(boolValue(bit), w)
+}
+
+func parity(v *big.Int) bool {
+	odd := false
+	for i := 0; i < v.BitLen(); i++ {
+		if v.Bit(i) == 1 {
+			odd = !odd
+		}
+	}
+	return odd
+}
+
+func (r *refSim) evalBinary(b *BinaryExpression, w int, s bool) *big.Int {
+	switch b.Operator {
+	case "&&", "||":
+		l := r.truth(b.Left)
+		rt := r.truth(b.Right)
+		if b.Operator == "&&" {
+			return truncate(boolValue(l && rt), w)
+		}
+		return truncate(boolValue(l || rt), w)
+	case "==", "!=", "===", "!==", "<", "<=", ">", ">=":
+		lw, ls := exprSize(b.Left)
+		rw, rs := exprSize(b.Right)
+		cw, cs := max(lw, rw), ls && rs
+		lv := r.eval(b.Left, cw, cs)
+		rv := r.eval(b.Right, cw, cs)
+		if cs {
+			lv, rv = toSigned(lv, cw), toSigned(rv, cw)
+		}
+		c := lv.Cmp(rv)
+		var bit bool
+		switch b.Operator {
+		case "==", "===":
+			bit = c == 0
+		case "!=", "!==":
+			bit = c != 0
+		case "<":
+			bit = c < 0
+		case "<=":
+			bit = c <= 0
+		case ">":
+			bit = c > 0
+		case ">=":
+			bit = c >= 0
+		}
+		return truncate(boolValue(bit), w)
+	case "<<", ">>", "<<<", ">>>":
+		lv := r.eval(b.Left, w, s)
+		amount, _, _ := r.selfEval(b.Right)
+		n := w
+		if amount.IsInt64() && amount.Int64() < int64(w) {
+			n = int(amount.Int64())
+		}
+		switch {
+		case b.Operator == "<<" || b.Operator == "<<<":
+			return truncate(new(big.Int).Lsh(lv, uint(n)), w)
+		case b.Operator == ">>>" && s:
+			return truncate(new(big.Int).Rsh(toSigned(lv, w), uint(n)), w)
+		default:
+			return new(big.Int).Rsh(lv, uint(n))
+		}
+	case "**":
+		return r.evalPower(b, w, s)
+	}
+
+	lv := r.eval(b.Left, w, s)
+	rv := r.eval(b.Right, w, s)
+	v := new(big.Int)
+	switch b.Operator {
+	case "+":
+		v.Add(lv, rv)
+	case "-":
+		v.Sub(lv, rv)
+	case "*":
+		v.Mul(lv, rv)
+	case "/", "%":
+		if rv.Sign() == 0 {
+			refFail("division by zero")
+		}
+		if s {
+			lv, rv = toSigned(lv, w), toSigned(rv, w)
+		}
+		if b.Operator == "/" {
+			v.Quo(lv, rv)
+		} else {
+			v.Rem(lv, rv)
+		}
+	case "&":
+		v.And(lv, rv)
+	case "|":
+		v.Or(lv, rv)
+	case "^":
+		v.Xor(lv, rv)
+	case "~&":
+		v.Not(v.And(lv, rv))
+	case "~|":
+		v.Not(v.Or(lv, rv))
+	case "~^", "^~":
+		v.Not(v.Xor(lv, rv))
+	default:
+		refFail("unsupported binary operator %s", b.Operator)
+	}
+	return truncate(v, w)
+}
+
+// evalPower computes base ** exponent in the width and signedness of the
+// base, per IEEE 1364 5.1.5: the exponent is self-determined and, when
+// signed, may be negative, which leaves only 1 and -1 with a non-zero
+// result. Zero to a negative power is X.
+func (r *refSim) evalPower(b *BinaryExpression, w int, s bool) *big.Int {
+	lv := r.eval(b.Left, w, s)
+	exp, ew, es := r.selfEval(b.Right)
+	if es {
+		exp = toSigned(exp, ew)
+	}
+	if exp.Sign() >= 0 {
+		// the low w bits of a power only depend on those of the base
+		return new(big.Int).Exp(lv, exp, new(big.Int).Lsh(bigOne, uint(w)))
+	}
+	base := lv
+	if s {
+		base = toSigned(lv, w)
+	}
+	switch {
+	case base.Sign() == 0:
+		refFail("zero to a negative power")
+	case base.Cmp(bigOne) == 0:
+		return truncate(big.NewInt(1), w)
+	case base.Cmp(big.NewInt(-1)) == 0:
+		if exp.Bit(0) == 1 {
+			return truncate(big.NewInt(-1), w)
+		}
+		return truncate(big.NewInt(1), w)
+	}
+	return new(big.Int)
+}
+
+// assignValue evaluates the right-hand side of an assignment to a target
+// of width tw: the target widens the context but not the signedness.
+func (r *refSim) assignValue(e Expression, tw int) *big.Int {
+	w, s := exprSize(e)
+	return truncate(r.eval(e, max(w, tw), s), tw)
+}
+
+func (r *refSim) exec(stmts []Statement) {
+	for _, stmt := range stmts {
+		switch x := stmt.(type) {
+		case *NonBlockingAssignment:
+			v := r.assignValue(x.Expression, targetWidth(x.Target, x.Range))
+			r.pending = append(r.pending, refUpdate{x.Target, x.Range, v})
+		case *BlockingAssignment:
+			r.store(x.Target, x.Range, r.assignValue(x.Expression, targetWidth(x.Target, x.Range)))
+		case *IfStatement:
+			if r.truth(x.Condition) {
+				r.exec(x.TrueBody)
+			} else {
+				r.exec(x.ElseBody)
+			}
+		case *CaseStatement:
+			r.execCase(x)
+		default:
+			refFail("unsupported statement %T", stmt)
+		}
+	}
+}
+
+// execCase compares the case expression and all items at their common
+// width, as in IEEE 1364 9.5.
+func (r *refSim) execCase(c *CaseStatement) {
+	items := make([]*NumberExpression, len(c.Cases))
+	w, s := exprSize(c.Expression)
+	for i, item := range c.Cases {
+		lit, ok := parseVerilogLiteral(item.Value)
+		if !ok {
+			refFail("unsupported case item %s", item.Value)
+		}
+		items[i] = &NumberExpression{Value: ConstNumber{Value: lit.value, BitWidth: lit.width, Signedness: lit.signed}}
+		w = max(w, lit.width)
+		s = s && lit.signed
+	}
+	v := r.eval(c.Expression, w, s)
+	for i, item := range items {
+		if v.Cmp(r.eval(item, w, s)) == 0 {
+			r.exec(c.Cases[i].Statements)
+			return
+		}
+	}
+	r.exec(c.Default)
+}
+
+func targetWidth(v *Variable, rng *BitRange) int {
+	if rng != nil {
+		return rng.GetWidth()
+	}
+	return v.GetWidth()
+}
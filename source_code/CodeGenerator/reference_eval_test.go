@@ -0,0 +1,298 @@
+package CodeGenerator
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func num(value uint64, width int, signed bool) *NumberExpression {
+	return &NumberExpression{Value: ConstNumber{Value: value, BitWidth: width, Signedness: signed}}
+}
+
+func signal(name string, width int, signed bool) *Variable {
+	v := &Variable{Name: name, Type: VarTypeReg, isSigned: signed}
+	if width > 1 {
+		v.Range, v.hasRange = &BitRange{l: 0, r: width - 1}, true
+	}
+	return v
+}
+
+func use(v *Variable) *VariableExpression {
+	return &VariableExpression{Var: v}
+}
+
+func bin(l Expression, op string, r Expression) *BinaryExpression {
+	return &BinaryExpression{Left: l, Right: r, Operator: op}
+}
+
+func newRefSim() *refSim {
+	r := &refSim{values: map[*Variable]*big.Int{}, drivers: map[*Variable]*AssignExpression{}}
+	r.invalidate()
+	return r
+}
+
+// evalSelf evaluates e self-determined and recovers the refError of an
+// evaluation the evaluator refuses.
+func evalSelf(r *refSim, e Expression) (v *big.Int, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = p.(refError)
+		}
+	}()
+	v, _, _ = r.selfEval(e)
+	return v, nil
+}
+
+func TestExprSize(t *testing.T) {
+	s8 := signal("s8", 8, true)
+	u4 := signal("u4", 4, false)
+	offset := &Variable{Name: "o", Range: &BitRange{l: 4, r: 11}, hasRange: true, isSigned: true}
+	tests := []struct {
+		name   string
+		e      Expression
+		width  int
+		signed bool
+	}{
+		{"signed var", use(s8), 8, true},
+		{"signed plus unsigned", bin(use(s8), "+", use(u4)), 8, false},
+		{"signed plus signed literal", bin(use(s8), "+", num(1, 4, true)), 8, true},
+		{"comparison", bin(use(s8), "<", use(u4)), 1, false},
+		{"shift keeps left operand", bin(use(u4), "<<", use(s8)), 4, false},
+		{"arithmetic shift keeps signedness", bin(use(s8), ">>>", use(u4)), 8, true},
+		{"reduction", &UnaryExpression{Operator: "&", Operand: use(s8)}, 1, false},
+		{"negation", &UnaryExpression{Operator: "-", Operand: use(s8)}, 8, true},
+		{"ternary mixes", &TernaryExpression{Condition: use(u4), TrueExpr: use(s8), FalseExpr: use(u4)}, 8, false},
+		{"concatenation", &ConcatenationExpression{Expressions: []Expression{use(s8), use(u4)}}, 12, false},
+		{"replication", &ReplicationExpression{Count: num(3, 2, false), Expression: use(u4)}, 12, false},
+		{"part-select is unsigned", &VariableExpression{Var: offset, Range: &BitRange{l: 6, r: 9}, hasRange: true}, 4, false},
+	}
+	for _, tt := range tests {
+		w, s := exprSize(tt.e)
+		if w != tt.width || s != tt.signed {
+			t.Errorf("%s: exprSize = %d, %v; want %d, %v", tt.name, w, s, tt.width, tt.signed)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	m8 := num(0x80, 8, true)
+	tests := []struct {
+		name string
+		e    Expression
+		want uint64
+	}{
+		// comparisons take the common width; mixing makes both unsigned
+		{"signed less than", bin(num(0xf, 4, true), "<", num(1, 4, true)), 1},
+		{"mixed less than", bin(num(0xf, 4, true), "<", num(1, 4, false)), 0},
+		{"signed widened", bin(num(0xf, 4, true), "<", num(1, 8, true)), 1},
+		{"unsigned widened", bin(num(0xf, 4, true), ">", num(1, 8, false)), 1},
+		{"mixed equality zero-extends", bin(num(0xf, 4, true), "==", num(0xff, 8, false)), 0},
+		{"signed equality sign-extends", bin(num(0xf, 4, true), "==", num(0xff, 8, true)), 1},
+
+		// >>> is arithmetic only in a signed context
+		{"signed >>>", bin(m8, ">>>", num(2, 2, false)), 0xe0},
+		{"unsigned >>>", bin(num(0x80, 8, false), ">>>", num(2, 2, false)), 0x20},
+		{">>> in unsigned context", bin(bin(m8, ">>>", num(2, 2, false)), "+", num(0, 8, false)), 0x20},
+		{">>> in wider signed context", bin(bin(num(0x8, 4, true), ">>>", num(1, 1, false)), "+", num(0, 8, true)), 0xfc},
+		{"signed amount counts unsigned", bin(num(1, 8, false), "<<", num(0xf, 4, true)), 0},
+
+		// shifting by the width or more
+		{"<< by width", bin(num(0xff, 8, false), "<<", num(8, 4, false)), 0},
+		{">> past width", bin(num(0xff, 8, false), ">>", num(9, 4, false)), 0},
+		{">>> signed by width", bin(m8, ">>>", num(8, 4, false)), 0xff},
+		{">>> signed by a huge amount", bin(m8, ">>>", num(1<<40, 64, false)), 0xff},
+		{">>> positive by width", bin(num(0x40, 8, true), ">>>", num(100, 8, false)), 0},
+
+		// signed division truncates toward zero, % takes the dividend's sign
+		{"signed /", bin(num(0xf9, 8, true), "/", num(2, 8, true)), 0xfd},
+		{"signed %", bin(num(0xf9, 8, true), "%", num(2, 8, true)), 0xff},
+		{"% by negative", bin(num(7, 8, true), "%", num(0xfe, 8, true)), 1},
+		{"mixed / is unsigned", bin(num(0xf9, 8, true), "/", num(2, 8, false)), 0x7c},
+		{"/ sign-extends a narrow operand", bin(num(0xf9, 8, true), "/", num(0xe, 4, true)), 3},
+
+		// ** takes the base's width and signedness; the exponent is self-determined
+		{"power", bin(num(3, 8, false), "**", num(4, 3, false)), 81},
+		{"power wraps at the base width", bin(num(3, 4, false), "**", num(3, 8, false)), 0xb},
+		{"power of a negative base", bin(num(0xfe, 8, true), "**", num(3, 2, false)), 0xf8},
+		{"power in a wider context", bin(bin(num(2, 4, false), "**", num(5, 4, false)), "+", num(0, 8, false)), 32},
+		{"x ** 0 is 1", bin(num(0, 8, false), "**", num(0, 4, false)), 1},
+		{"0 ** positive is 0", bin(num(0, 8, false), "**", num(3, 4, false)), 0},
+		{"huge exponent", bin(num(3, 8, false), "**", num(1<<40+1, 64, false)), 3},
+		{"negative exponent", bin(num(5, 8, true), "**", num(0xf, 4, true)), 0},
+		{"1 ** negative", bin(num(1, 8, true), "**", num(0xe, 4, true)), 1},
+		{"-1 ** odd negative", bin(num(0xff, 8, true), "**", num(0xf, 4, true)), 0xff},
+		{"-1 ** even negative", bin(num(0xff, 8, true), "**", num(0xe, 4, true)), 1},
+		{"unsigned exponent is never negative", bin(num(2, 8, true), "**", num(0xf, 4, false)), 0},
+		{"unsigned base of all ones", bin(num(0xff, 8, false), "**", num(0xf, 4, true)), 0},
+
+		// other context rules
+		{"+ wraps at the operand width", bin(num(0xff, 8, false), "+", num(1, 8, false)), 0},
+		{"concatenation operands are self-determined", &ConcatenationExpression{Expressions: []Expression{num(0xf, 4, true), num(1, 2, false)}}, 0x3d},
+		{"reduction of a signed operand", &UnaryExpression{Operator: "&", Operand: num(0xf, 4, true)}, 1},
+	}
+	for _, tt := range tests {
+		v, err := evalSelf(newRefSim(), tt.e)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if v.Uint64() != tt.want {
+			t.Errorf("%s: got %#x, want %#x", tt.name, v.Uint64(), tt.want)
+		}
+	}
+}
+
+func TestEvalDivisionByZero(t *testing.T) {
+	for _, op := range []string{"/", "%"} {
+		if _, err := evalSelf(newRefSim(), bin(num(1, 4, false), op, num(0, 4, false))); err == nil {
+			t.Errorf("%s by zero: want an error, the result is X", op)
+		}
+	}
+}
+
+func TestEvalZeroToNegativePower(t *testing.T) {
+	if _, err := evalSelf(newRefSim(), bin(num(0, 8, true), "**", num(0xf, 4, true))); err == nil {
+		t.Error("0 ** -1: want an error, the result is X")
+	}
+}
+
+func TestAssignValueWidensContext(t *testing.T) {
+	r := newRefSim()
+	// 8'hff + 8'h01 keeps its carry when assigned to 9 bits
+	if v := r.assignValue(bin(num(0xff, 8, false), "+", num(1, 8, false)), 9); v.Uint64() != 0x100 {
+		t.Errorf("9-bit target: got %#x, want 0x100", v.Uint64())
+	}
+	// the target does not make a signed operand unsigned: 4'sb1000 sign-extends
+	if v := r.assignValue(num(0x8, 4, true), 8); v.Uint64() != 0xf8 {
+		t.Errorf("signed into 8 bits: got %#x, want 0xf8", v.Uint64())
+	}
+}
+
+func TestPartSelectOfOffsetRange(t *testing.T) {
+	// reg [11:4] o = 8'hab: bit 4 of o is bit 0 of the value
+	o := &Variable{Name: "o", Range: &BitRange{l: 4, r: 11}, hasRange: true}
+	r := newRefSim()
+	r.values[o] = big.NewInt(0xab)
+	tests := []struct {
+		l, r int
+		want uint64
+	}{
+		{4, 7, 0xb},
+		{8, 11, 0xa},
+		{6, 9, 0xa},
+		{11, 11, 1},
+	}
+	for _, tt := range tests {
+		e := &VariableExpression{Var: o, Range: &BitRange{l: tt.l, r: tt.r}, hasRange: true}
+		if v, err := evalSelf(r, e); err != nil || v.Uint64() != tt.want {
+			t.Errorf("o[%d:%d] = %v (%v), want %#x", tt.r, tt.l, v, err, tt.want)
+		}
+	}
+
+	// o[9:6] = 4'b0101 only touches bits 2 to 5 of the value
+	r.store(o, &BitRange{l: 6, r: 9}, big.NewInt(0x5))
+	if got := r.read(o).Uint64(); got != 0x97 {
+		t.Errorf("after o[9:6] = 5: o = %#x, want 0x97", got)
+	}
+}
+
+func TestCaseItemsWiderThanSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector *NumberExpression
+		items    []string
+		want     uint64
+	}{
+		// the selector is zero-extended to 3 bits: 011 is no 111
+		{"unsigned", num(3, 2, false), []string{"3'b111", "3'b011"}, 2},
+		// all signed: the selector sign-extends to 111
+		{"signed", num(3, 2, true), []string{"3'sb111", "3'sb011"}, 1},
+		// one unsigned item makes the comparison unsigned
+		{"mixed", num(3, 2, true), []string{"3'b111", "3'sb011"}, 2},
+		{"default", num(3, 2, false), []string{"3'b111", "3'b110"}, 3},
+	}
+	for _, tt := range tests {
+		out := signal("out", 2, false)
+		c := &CaseStatement{Expression: tt.selector, Default: []Statement{&BlockingAssignment{Target: out, Expression: num(3, 2, false)}}}
+		for i, item := range tt.items {
+			c.Cases = append(c.Cases, CaseItem{Value: item, Statements: []Statement{
+				&BlockingAssignment{Target: out, Expression: num(uint64(i+1), 2, false)},
+			}})
+		}
+		r := newRefSim()
+		r.exec([]Statement{c})
+		if got := r.read(out).Uint64(); got != tt.want {
+			t.Errorf("%s: took branch %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBlockingAndNonblockingOrder(t *testing.T) {
+	in := signal("in", 4, false)
+	clk := signal("clk", 1, false)
+	tmp, x, y, z, w := signal("t", 4, false), signal("x", 4, false), signal("y", 4, false), signal("z", 4, false), signal("w", 4, false)
+	m := &Model{
+		Inputs:  []*Variable{in},
+		Clocks:  []*Variable{clk},
+		Outputs: []*Variable{x, y, z, w},
+		Blocks: []*AlwaysBlock{{
+			Type:         AlwaysFF,
+			ClockVars:    []*Variable{clk},
+			ClockPosedge: []bool{true},
+			Statements: []Statement{
+				&BlockingAssignment{Target: tmp, Expression: bin(use(in), "+", num(1, 4, false))},
+				&NonBlockingAssignment{Target: x, Expression: use(tmp)},
+				// both read x before the nonblocking update
+				&NonBlockingAssignment{Target: y, Expression: use(x)},
+				&BlockingAssignment{Target: z, Expression: use(x)},
+				// reads the blocking update of t
+				&BlockingAssignment{Target: w, Expression: use(tmp)},
+			},
+		}},
+	}
+	out, err := m.Simulate("3 1\n5 0\n5 1\n", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"cycle=0 signal=x width=4 signed=0 value=4",
+		"cycle=0 signal=y width=4 signed=0 value=0",
+		"cycle=0 signal=z width=4 signed=0 value=0",
+		"cycle=0 signal=w width=4 signed=0 value=4",
+		// no edge: nothing changes
+		"cycle=1 signal=x width=4 signed=0 value=4",
+		"cycle=1 signal=y width=4 signed=0 value=0",
+		"cycle=1 signal=z width=4 signed=0 value=0",
+		"cycle=1 signal=w width=4 signed=0 value=4",
+		"cycle=2 signal=x width=4 signed=0 value=6",
+		"cycle=2 signal=y width=4 signed=0 value=4",
+		"cycle=2 signal=z width=4 signed=0 value=4",
+		"cycle=2 signal=w width=4 signed=0 value=6",
+	}
+	if got := strings.Split(strings.TrimSpace(out), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSimulateContinuousAssignments(t *testing.T) {
+	a := signal("a", 4, true)
+	b := signal("b", 8, true)
+	out := signal("out", 8, false)
+	// out = a + b sign-extends a into 8 bits; the driver of b is read first
+	m := &Model{
+		Inputs:  []*Variable{a},
+		Outputs: []*Variable{out},
+		Assigns: []*AssignExpression{
+			{Operand1: out, Right: bin(use(a), "+", use(b))},
+			{Operand1: b, Right: num(0x10, 8, true)},
+		},
+	}
+	got, err := m.Simulate("15\n", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "cycle=0 signal=out width=8 signed=0 value=0f\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
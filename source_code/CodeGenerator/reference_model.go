@@ -0,0 +1,259 @@
+package CodeGenerator
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Model is the design behind the last generated module, or behind the
+// first variant of an equivalent set, kept as AST so that ReferenceOutput
+// can compute its outputs without a simulator.
+type Model struct {
+	Inputs  []*Variable
+	Clocks  []*Variable
+	Outputs []*Variable
+	Assigns []*AssignExpression
+	Blocks  []*AlwaysBlock
+	// Observed are the internal signals printed after the outputs.
+	Observed []*Variable
+}
+
+// newModel records the current module. outputTerms are the signals summed
+// into the first output.
+func (g *ExpressionGenerator) newModel(assigns []*AssignExpression, blocks []*AlwaysBlock, outputTerms []*Variable) *Model {
+	var sum Expression = &NumberExpression{Value: ConstNumber{Value: 0, BitWidth: 1}}
+	for i, v := range outputTerms {
+		term := &VariableExpression{Var: v}
+		if i == 0 {
+			sum = term
+		} else {
+			sum = &BinaryExpression{Left: sum, Right: term, Operator: "+"}
+		}
+	}
+	m := &Model{
+		Inputs:  append([]*Variable(nil), g.InputPortVars...),
+		Clocks:  append([]*Variable(nil), g.ClockVars...),
+		Outputs: append([]*Variable(nil), g.OutputVars...),
+		Assigns: append([]*AssignExpression(nil), assigns...),
+		Blocks:  blocks,
+
+		Observed: g.observedVars(),
+	}
+	if len(m.Outputs) > 0 {
+		m.Assigns = append(m.Assigns, &AssignExpression{Operand1: m.Outputs[0], Right: sum})
+	}
+	return m
+}
+
+// ReferenceOutput returns what the testbench from GenerateTb writes for
+// input, computed by evaluating the last generated module in Go. It fails
+// for X-valued inputs and for constructs the evaluator does not model.
+func (g *ExpressionGenerator) ReferenceOutput(input string) (string, error) {
+	if g.Model == nil {
+		return "", errors.New("reference: no module generated")
+	}
+	if g.EnableXInputs {
+		return "", errors.New("reference: X-valued inputs are not modelled")
+	}
+	return g.Model.Simulate(input, g.TestBenchTestTime)
+}
+
+type refUpdate struct {
+	v     *Variable
+	rng   *BitRange
+	value *big.Int
+}
+
+type refSim struct {
+	m        *Model
+	values   map[*Variable]*big.Int
+	drivers  map[*Variable]*AssignExpression
+	settled  map[*Variable]bool
+	visiting map[*Variable]bool
+	pending  []refUpdate
+}
+
+// Simulate replays the GenerateTb stimulus: inputs, clocks and registers
+// start at 0, then each vector sets the inputs, then the clocks, and the
+// outputs are sampled once everything has settled and printed as records.
+func (m *Model) Simulate(input string, vectors int) (out string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			e, ok := p.(refError)
+			if !ok {
+				panic(p)
+			}
+			err = e
+		}
+	}()
+
+	r := &refSim{
+		m:       m,
+		values:  make(map[*Variable]*big.Int),
+		drivers: make(map[*Variable]*AssignExpression),
+	}
+	for _, a := range m.Assigns {
+		if a.UsedRange != nil {
+			refFail("partial assignment to %s", a.Operand1.Name)
+		}
+		r.drivers[a.Operand1] = a
+	}
+	for _, b := range m.Blocks {
+		if b.Type != AlwaysFF || len(b.ClockVars) == 0 {
+			refFail("unsupported always block")
+		}
+	}
+	r.invalidate()
+
+	fields := strings.Fields(input)
+	var sb strings.Builder
+	for i := 0; i < vectors; i++ {
+		if len(fields) < len(m.Inputs)+len(m.Clocks) {
+			break
+		}
+		r.step(m.Inputs, fields[:len(m.Inputs)])
+		fields = fields[len(m.Inputs):]
+		r.step(m.Clocks, fields[:len(m.Clocks)])
+		fields = fields[len(m.Clocks):]
+
+		for _, v := range m.Outputs {
+			fmt.Fprintf(&sb, "cycle=%d signal=%s width=%d signed=%d value=%s\n",
+				i, v.Name, v.GetWidth(), boolFlag(v.isSigned), hexDigits(r.read(v), v.GetWidth()))
+		}
+		for _, v := range m.Observed {
+			fmt.Fprintf(&sb, "cycle=%d signal=%s%s width=%d signed=%d value=%s\n",
+				i, ObservePrefix, v.Name, v.GetWidth(), boolFlag(v.isSigned), hexDigits(r.read(v), v.GetWidth()))
+		}
+	}
+	return sb.String(), nil
+}
+
+// hexDigits formats the w-bit pattern v like %h: ceil(w/4) hex digits.
+func hexDigits(v *big.Int, w int) string {
+	s := v.Text(16)
+	if n := (w + 3) / 4; len(s) < n {
+		s = strings.Repeat("0", n-len(s)) + s
+	}
+	return s
+}
+
+// step is one $fscanf of the testbench: it sets vars, then runs the always
+// blocks with an edge on them and applies their nonblocking assignments.
+func (r *refSim) step(vars []*Variable, fields []string) {
+	before := make(map[*Variable]*big.Int)
+	for _, b := range r.m.Blocks {
+		for _, v := range sensitivity(b) {
+			before[v] = r.read(v)
+		}
+	}
+	for i, v := range vars {
+		value, ok := new(big.Int).SetString(fields[i], 10)
+		if !ok {
+			refFail("bad input value %q", fields[i])
+		}
+		r.store(v, nil, value)
+	}
+	for _, b := range r.m.Blocks {
+		if r.triggered(b, before) {
+			r.run(b)
+		}
+	}
+	for _, u := range r.pending {
+		r.store(u.v, u.rng, u.value)
+	}
+	r.pending = nil
+}
+
+// sensitivity lists the signals in the event control of b, in the order
+// GenerateString writes them.
+func sensitivity(b *AlwaysBlock) []*Variable {
+	vars := append([]*Variable(nil), b.ClockVars...)
+	if b.ResetVar != nil && !containsVar(vars, b.ResetVar) {
+		vars = append(vars, b.ResetVar)
+	}
+	return vars
+}
+
+func containsVar(vars []*Variable, v *Variable) bool {
+	for _, x := range vars {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *refSim) triggered(b *AlwaysBlock, before map[*Variable]*big.Int) bool {
+	for i, v := range sensitivity(b) {
+		posedge := true
+		if i < len(b.ClockVars) && !b.ForcePosedge && len(b.ClockPosedge) == len(b.ClockVars) {
+			posedge = b.ClockPosedge[i]
+		}
+		was, now := before[v].Bit(0), r.read(v).Bit(0)
+		if posedge && was == 0 && now == 1 || !posedge && was == 1 && now == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *refSim) run(b *AlwaysBlock) {
+	if b.ResetVar == nil {
+		r.exec(b.Statements)
+		return
+	}
+	if r.read(b.ResetVar).Sign() == 0 {
+		r.exec(b.Statements)
+		return
+	}
+	lit, ok := parseVerilogLiteral(b.ResetValue)
+	if !ok {
+		refFail("unsupported reset value %s", b.ResetValue)
+	}
+	value := &NumberExpression{Value: ConstNumber{Value: lit.value, BitWidth: lit.width, Signedness: lit.signed}}
+	for _, v := range b.UsedVars {
+		r.pending = append(r.pending, refUpdate{v, nil, r.assignValue(value, v.GetWidth())})
+	}
+}
+
+// read returns the current value of v, evaluating its continuous
+// assignment first when it has one.
+func (r *refSim) read(v *Variable) *big.Int {
+	a, ok := r.drivers[v]
+	if !ok || r.settled[v] {
+		if value, ok := r.values[v]; ok {
+			return value
+		}
+		return new(big.Int)
+	}
+	if r.visiting[v] {
+		refFail("combinational loop through %s", v.Name)
+	}
+	r.visiting[v] = true
+	r.values[v] = r.assignValue(a.Right, v.GetWidth())
+	delete(r.visiting, v)
+	r.settled[v] = true
+	return r.values[v]
+}
+
+func (r *refSim) store(v *Variable, rng *BitRange, value *big.Int) {
+	if rng == nil || !v.hasRange {
+		r.values[v] = truncate(value, v.GetWidth())
+	} else {
+		low := uint(rng.l - v.Range.l)
+		w := rng.GetWidth()
+		old := r.read(v)
+		field := new(big.Int).Lsh(truncate(big.NewInt(-1), w), low)
+		next := new(big.Int).AndNot(old, field)
+		next.Or(next, new(big.Int).Lsh(truncate(value, w), low))
+		r.values[v] = next
+	}
+	r.invalidate()
+}
+
+func (r *refSim) invalidate() {
+	r.settled = make(map[*Variable]bool)
+	r.visiting = make(map[*Variable]bool)
+}
@@ -0,0 +1,275 @@
+package CodeGenerator
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Rewrite is one equivalence rewrite a variant was made with: the rule, its
+// site in the first variant and the code before and after it.
+type Rewrite struct {
+	Rule   string `json:"rule"`
+	Site   string `json:"site"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+
+	// pick and shift choose among the candidates of the rule, so that the
+	// rewrite can be made again
+	pick, shift   int
+	before, after printable
+	// replaced is the node a rule that keeps one of its operands took out
+	replaced Expression
+}
+
+type printable interface {
+	GenerateString() string
+}
+
+func (r *Rewrite) String() string {
+	return fmt.Sprintf("%s at %s: %s => %s", r.Rule, r.Site, r.Before, r.After)
+}
+
+// rewriter makes the rewrites of one variant. It draws them from rng, or,
+// when replay is set, makes again the recorded rewrites it holds by site.
+// Sites are paths in the first variant, e.g. "assign[3] wire_5/l/op" or
+// "always[0]/2/then/0".
+type rewriter struct {
+	rng         *rand.Rand
+	controlFlow bool
+	replay      map[string]*Rewrite
+	site        string
+	log         []*Rewrite
+}
+
+func (g *ExpressionGenerator) newRewriter(site string) *rewriter {
+	return &rewriter{rng: g.Rand, controlFlow: g.EnableControlFlowEquiv, site: site}
+}
+
+func replayRewriter(rewrites []*Rewrite) *rewriter {
+	t := &rewriter{controlFlow: true, replay: make(map[string]*Rewrite)}
+	for _, r := range rewrites {
+		t.replay[r.Site] = r
+	}
+	return t
+}
+
+// child transforms e, found at name below the current site.
+func (t *rewriter) child(name string, e Expression) Expression {
+	saved := t.site
+	t.site += "/" + name
+	out := e.EquivalentTrans(t)
+	t.site = saved
+	return out
+}
+
+// descend says whether to transform the operands of a node that keeps
+// them. Replaying always does; only the recorded sites change anything.
+func (t *rewriter) descend() bool {
+	return t.replay != nil || t.rng.Float64() > 0.5
+}
+
+// maybe draws whether to apply a rule taken half the time.
+func (t *rewriter) maybe(rule string) bool {
+	if t.replay != nil {
+		return t.fire(rule)
+	}
+	return t.rng.Float64() < 0.5
+}
+
+// fire says whether to apply a rule that always applies where it can.
+func (t *rewriter) fire(rule string) bool {
+	if t.replay == nil {
+		return true
+	}
+	r := t.replay[t.site]
+	return r != nil && r.Rule == rule
+}
+
+// recorded returns the rewrite to make again at the current site.
+func (t *rewriter) recorded() *Rewrite {
+	return t.replay[t.site]
+}
+
+// pick chooses one of the named candidates to replace e with, e itself
+// being the first.
+func (t *rewriter) pick(e Expression, candidates []Expression, names []string, shift int) Expression {
+	var i int
+	if t.replay != nil {
+		r := t.recorded()
+		if r == nil || r.pick >= len(candidates) || names[r.pick] != r.Rule {
+			return e
+		}
+		i = r.pick
+	} else {
+		i = t.rng.Intn(len(candidates))
+	}
+	if i > 0 {
+		t.record(names[i], i, shift, e, candidates[i])
+	}
+	return candidates[i]
+}
+
+func (t *rewriter) record(rule string, pick, shift int, before, after printable) *Rewrite {
+	r := &Rewrite{Rule: rule, Site: t.site, pick: pick, shift: shift, before: before, after: after}
+	t.log = append(t.log, r)
+	return r
+}
+
+// rewrites returns the rewrites that are part of root, the transformed
+// expression, or all of them for statements. A rewrite made inside an
+// operand is lost when an enclosing node then keeps its old operand, and
+// one made in place survives even so; what counts is whether its result
+// is still in the tree, or in an operand a live rule relied on.
+func (t *rewriter) rewrites(root Expression) []*Rewrite {
+	if root == nil {
+		return t.log
+	}
+	nodes := make(map[Expression]bool)
+	var walk func(e Expression)
+	walk = func(e Expression) {
+		if e == nil || nodes[e] {
+			return
+		}
+		nodes[e] = true
+		switch x := e.(type) {
+		case *BinaryExpression:
+			walk(x.Left)
+			walk(x.Right)
+		case *UnaryExpression:
+			walk(x.Operand)
+		case *TernaryExpression:
+			walk(x.Condition)
+			walk(x.TrueExpr)
+			walk(x.FalseExpr)
+		case *ConcatenationExpression:
+			for _, part := range x.Expressions {
+				walk(part)
+			}
+		case *ReplicationExpression:
+			walk(x.Count)
+			walk(x.Expression)
+		}
+	}
+	live := func(r *Rewrite) bool {
+		after, _ := r.after.(Expression)
+		return nodes[after] && (r.replaced == nil || !nodes[r.replaced])
+	}
+	walk(root)
+	// a rule that keeps one operand may have applied only because of what
+	// the rewrites inside the other made of it
+	for grown := true; grown; {
+		grown = false
+		for _, r := range t.log {
+			before, _ := r.before.(Expression)
+			if r.replaced != nil && live(r) && !nodes[before] {
+				walk(before)
+				grown = true
+			}
+		}
+	}
+	var out []*Rewrite
+	for _, r := range t.log {
+		if live(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// takeRewrites returns the rewrites made since the last variant was added.
+func (g *ExpressionGenerator) takeRewrites() []*Rewrite {
+	rewrites := g.pendingRewrites
+	g.pendingRewrites = nil
+	return rewrites
+}
+
+// describe prints the code before and after each rewrite on one line. It
+// runs once the variant has been printed, so that it cannot change what
+// the generator prints.
+func describe(rewrites []*Rewrite) {
+	for _, r := range rewrites {
+		if r.before != nil {
+			r.Before, r.After = oneLine(r.before), oneLine(r.after)
+			r.before, r.after = nil, nil
+		}
+	}
+}
+
+// maxRewriteText cuts the code of a rewritten statement, which holds all
+// of its body.
+const maxRewriteText = 160
+
+func oneLine(p printable) string {
+	s := strings.Join(strings.Fields(p.GenerateString()), " ")
+	if len(s) > maxRewriteText {
+		s = s[:maxRewriteText] + " ..."
+	}
+	return s
+}
+
+func assignSite(i int, a *AssignExpression) string {
+	return fmt.Sprintf("assign[%d] %s", i, a.Operand1.Name)
+}
+
+func blockSite(i int) string {
+	return fmt.Sprintf("always[%d]", i)
+}
+
+// RewriteLog lists the rewrites of every variant after the first.
+func (d *Design) RewriteLog() string {
+	var sb strings.Builder
+	for i, vr := range d.Variants {
+		if i == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s_eq%d: %d rewrites\n", d.Name, i, len(vr.Rewrites))
+		for _, r := range vr.Rewrites {
+			fmt.Fprintf(&sb, "  %s\n", r)
+		}
+	}
+	return sb.String()
+}
+
+// Rewritten makes a variant from the first one with only the given
+// rewrites, all from the log of one variant. It also returns the rewrites
+// that took effect: one inside an operand that a left-out rewrite does not
+// keep has nothing to apply to.
+func (d *Design) Rewritten(rewrites []*Rewrite) (*Variant, []*Rewrite) {
+	base := d.Variants[0]
+	vr := &Variant{}
+	var applied []*Rewrite
+	for i, a := range cloneAssignExpressions(base.Assigns) {
+		t := replayRewriter(rewrites)
+		t.site = assignSite(i, a)
+		out := a.EquivalentTrans(t).(*AssignExpression)
+		vr.Assigns = append(vr.Assigns, out)
+		applied = append(applied, t.rewrites(out.Right)...)
+	}
+	for i, b := range base.Blocks {
+		t := replayRewriter(rewrites)
+		t.site = blockSite(i)
+		vr.Blocks = append(vr.Blocks, t.block(b))
+		applied = append(applied, t.rewrites(nil)...)
+	}
+	describe(applied)
+	bySite := make(map[string]*Rewrite)
+	for _, r := range rewrites {
+		bySite[r.Site] = r
+	}
+	for i, r := range applied {
+		// report the recorded rewrite, with the code it was recorded with
+		if orig := bySite[r.Site]; orig != nil {
+			applied[i] = orig
+		}
+	}
+	vr.Rewrites = applied
+	return vr, applied
+}
+
+// Pair returns the design cut down to its first variant and vr.
+func (d *Design) Pair(vr *Variant) *Design {
+	pair := *d
+	pair.Variants = []*Variant{d.Variants[0], vr}
+	return &pair
+}
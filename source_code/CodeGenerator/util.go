@@ -5,28 +5,27 @@ import (
 	"strconv"
 )
 
-var wireCnt int
-var regCnt int
-
-func GenerateIdentifier(varType VerilogVarType) string {
+// GenerateIdentifier returns the next fresh wire_N / reg_N name. The counters
+// live on the generator, so names only depend on this generator's history.
+func (g *ExpressionGenerator) GenerateIdentifier(varType VerilogVarType) string {
 	if varType == VarTypeWire {
-		name := "wire_" + strconv.Itoa(wireCnt)
-		wireCnt++
+		name := "wire_" + strconv.Itoa(g.WireIndex)
+		g.WireIndex++
 		return name
 	} else if varType == VarTypeReg {
-		name := "reg_" + strconv.Itoa(regCnt)
-		regCnt++
+		name := "reg_" + strconv.Itoa(g.RegIndex)
+		g.RegIndex++
 		return name
 	}
 	return ""
 }
 
-func GetRandomRangeFromVar(v *Variable) *BitRange {
+func GetRandomRangeFromVar(rng *rand.Rand, v *Variable) *BitRange {
 	if !v.hasRange {
 		return nil
 	}
-	r := v.Range.l + rand.Intn(v.Range.r-v.Range.l+1)
-	l := v.Range.l + rand.Intn(r-v.Range.l+1)
+	r := v.Range.l + rng.Intn(v.Range.r-v.Range.l+1)
+	l := v.Range.l + rng.Intn(r-v.Range.l+1)
 	return &BitRange{
 		r: r,
 		l: l,
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rewritesFileName lists the rewrites each variant of a case was made with.
+const rewritesFileName = "rewrites.txt"
+
+// bisectReportFileName says which rewrites a minimal pair keeps.
+const bisectReportFileName = "bisect.txt"
+
+// RunBisect implements `VeriEQ bisect`: for a case whose variants disagree,
+// it finds the first variant that disagrees with eq0 and looks for the
+// smallest set of its rewrites after which the two still do. The pair of
+// modules goes to -out.
+func RunBisect(args []string) {
+	fs := flag.NewFlagSet("bisect", flag.ExitOnError)
+	casePath := fs.String("case", "", "case.json of a saved bug, or its directory")
+	oracleSpec := fs.String("oracle", "", "What the pair must keep doing, e.g. equiv:T or crash:T (default: equiv on the case's simulator)")
+	variant := fs.Int("variant", 0, "Variant to bisect (default: the first that disagrees with eq0)")
+	configPath := fs.String("config", "", "Path to config file")
+	compileLimit := fs.Duration("compile-timeout", compileTimeout, "Default limit for elaboration and C++ builds")
+	runLimit := fs.Duration("run-timeout", runTimeout, "Default limit for one simulation run")
+	outDir := fs.String("out", "", "Directory for the minimal pair (default: bisected/ next to case.json)")
+	_ = fs.Parse(args)
+
+	path, base, orig := loadSavedCase("bisect", *casePath)
+	if base.Fuzzer == "fuzz" {
+		PrettyErr("bisect", "fuzz cases have a single module and no rewrites")
+		os.Exit(1)
+	}
+	cfg, err := LoadToolConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config load warning: %v\n", err)
+	}
+	toolConfig = cfg
+	compileTimeout = *compileLimit
+	runTimeout = *runLimit
+	if err := toolConfig.validateTimeouts(); err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(filepath.Dir(path), "bisected")
+	}
+	full := orig.Generator.Design
+	if *variant < 0 || *variant >= len(full.Variants) {
+		PrettyErr("bisect", fmt.Sprintf("variant %d: the case has eq0 to eq%d", *variant, len(full.Variants)-1))
+		os.Exit(1)
+	}
+	work, err := os.MkdirTemp("", "veq_bisect_")
+	if err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	}
+	defer os.RemoveAll(work)
+
+	r := &reducer{base: base, design: full, work: work, results: map[string]bool{}}
+	r.oracle = Oracle{Kind: "equiv", Tools: []string{base.Fuzzer}}
+	if *oracleSpec != "" {
+		if r.oracle, err = parseOracle(*oracleSpec); err != nil {
+			PrettyErr("bisect", err.Error())
+			os.Exit(1)
+		}
+	}
+	r.check = r.oracle.holds
+	b := &bisector{reducer: r, full: full}
+
+	k := *variant
+	if k == 0 {
+		for i := 1; i < len(full.Variants) && k == 0; i++ {
+			ok, err := b.start(full.Variants[i])
+			if err != nil {
+				PrettyErr("bisect", err.Error())
+				os.Exit(1)
+			}
+			if ok {
+				k = i
+			}
+		}
+		if k == 0 {
+			PrettyErr("bisect", fmt.Sprintf("no variant disagrees with eq0 under oracle %s", r.oracle))
+			os.Exit(1)
+		}
+	} else if ok, err := b.start(full.Variants[k]); err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	} else if !ok {
+		PrettyErr("bisect", fmt.Sprintf("eq%d does not disagree with eq0 under oracle %s", k, r.oracle))
+		os.Exit(1)
+	}
+	all := full.Variants[k].Rewrites
+	PrettyInfo("bisect", fmt.Sprintf("seed %d, oracle %s, eq%d with %d rewrites", base.Seed, r.oracle, k, len(all)))
+	kept, err := b.minimize(all)
+	if err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	}
+	vr, _ := full.Rewritten(kept)
+	r.design = full.Pair(vr)
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	}
+	// no case.json: its seed would rebuild every variant
+	if err := r.write(*outDir); err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "case: %s\nseed: %d\noracle: %s\nvariant: eq%d\ntests: %d\nrewrites: %d -> %d\n", path, base.Seed, r.oracle, k, r.tests, len(all), len(kept))
+	for _, rw := range kept {
+		fmt.Fprintf(&sb, "  %s\n", rw)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, bisectReportFileName), []byte(sb.String()), 0o644); err != nil {
+		PrettyErr("bisect", err.Error())
+		os.Exit(1)
+	}
+	PrettyOK("bisect", fmt.Sprintf("eq%d: %d of %d rewrites in %d tests, written to %s", k, len(kept), len(all), r.tests, *outDir))
+	for _, rw := range kept {
+		PrettyInfo("bisect", rw.String())
+	}
+}
+
+// bisector checks the oracle on eq0 paired with variants rebuilt from a
+// subset of the rewrites of one.
+type bisector struct {
+	*reducer
+	full *CodeGenerator.Design
+}
+
+// start checks the oracle on a variant with all its rewrites, like
+// reducer.start on an unreduced design.
+func (b *bisector) start(vr *CodeGenerator.Variant) (bool, error) {
+	b.design = b.full.Pair(vr)
+	return b.reducer.start()
+}
+
+func (b *bisector) holds(vr *CodeGenerator.Variant) (bool, error) {
+	b.design = b.full.Pair(vr)
+	return b.reducer.holds()
+}
+
+// minimize runs ddmin over the rewrites: it tries each chunk, then all but
+// each chunk, and doubles the number of chunks when neither holds. A subset
+// is replaced by the rewrites of it that took effect.
+func (b *bisector) minimize(rewrites []*CodeGenerator.Rewrite) ([]*CodeGenerator.Rewrite, error) {
+	var err error
+	try := func(subset []*CodeGenerator.Rewrite) ([]*CodeGenerator.Rewrite, bool) {
+		if err != nil {
+			return nil, false
+		}
+		vr, applied := b.full.Rewritten(subset)
+		ok, holdsErr := b.holds(vr)
+		err = holdsErr
+		return applied, ok
+	}
+	if applied, ok := try(rewrites); ok {
+		rewrites = applied
+	}
+	for n := 2; len(rewrites) > 1; {
+		n = min(n, len(rewrites))
+		size := (len(rewrites) + n - 1) / n
+		reduced := false
+		for start := 0; start < len(rewrites) && !reduced; start += size {
+			chunk := rewrites[start:min(start+size, len(rewrites))]
+			if applied, ok := try(chunk); ok {
+				rewrites, n, reduced = applied, 2, true
+			}
+		}
+		for start := 0; start < len(rewrites) && !reduced && n > 2; start += size {
+			rest := append(append([]*CodeGenerator.Rewrite(nil), rewrites[:start]...), rewrites[min(start+size, len(rewrites)):]...)
+			if applied, ok := try(rest); ok {
+				rewrites, n, reduced = applied, n-1, true
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !reduced {
+			if n == len(rewrites) {
+				break
+			}
+			n *= 2
+		}
+	}
+	return rewrites, err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// The stub oracle holds while the rendered pair carries every culprit
+// rewrite, as if the bug were in their combination.
+func TestBisectWithStubOracle(t *testing.T) {
+	f := &Fuzzer{TestFileName: "test.v", TestBenchName: "tb.v"}
+	tc := f.NewTestCase("iverilog", 1, 2, nil)
+	full := tc.Generator.Design
+	all := full.Variants[1].Rewrites
+	if len(all) < 8 {
+		t.Fatalf("eq1 has %d rewrites, want at least 8", len(all))
+	}
+	tests := []struct {
+		name     string
+		culprits []*CodeGenerator.Rewrite
+	}{
+		{"single culprit", []*CodeGenerator.Rewrite{all[len(all)/2]}},
+		{"culprit pair", []*CodeGenerator.Rewrite{all[1], all[len(all)-2]}},
+	}
+	for _, tt := range tests {
+		check := func(tc *TestCase, dir string) (bool, bool) {
+			sites := map[string]bool{}
+			for _, rw := range tc.Generator.Design.Variants[1].Rewrites {
+				sites[rw.Site] = true
+			}
+			for _, rw := range tt.culprits {
+				if !sites[rw.Site] {
+					return false, false
+				}
+			}
+			return true, false
+		}
+		r := &reducer{base: tc, design: full, check: check, work: t.TempDir(), results: map[string]bool{}}
+		b := &bisector{reducer: r, full: full}
+		if ok, err := b.start(full.Variants[1]); err != nil || !ok {
+			t.Fatalf("%s: start: %v, %v", tt.name, ok, err)
+		}
+		kept, err := b.minimize(all)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got, want := rewriteSites(kept), rewriteSites(tt.culprits); got != want {
+			t.Errorf("%s: kept %s, want %s", tt.name, got, want)
+		}
+		t.Logf("%s: %d of %d rewrites in %d tests", tt.name, len(kept), len(all), r.tests)
+	}
+}
+
+func rewriteSites(rewrites []*CodeGenerator.Rewrite) string {
+	var sites []string
+	for _, rw := range rewrites {
+		sites = append(sites, rw.Site)
+	}
+	sort.Strings(sites)
+	return strings.Join(sites, ", ")
+}
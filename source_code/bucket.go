@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// bucketIndexFileName is the index of the buckets in a campaign's bug
+// directory: each bucket's signature, how many cases fell into it and which
+// of them were kept.
+const bucketIndexFileName = "buckets.json"
+
+// signatureFileName holds the signature of a kept case.
+const signatureFileName = "signature.json"
+
+// bucketKeep is how many cases of one bucket are saved; 0 keeps all.
+var bucketKeep = 5
+
+type BucketEntry struct {
+	Signature *Signature `json:"signature,omitempty"`
+	Count     int64      `json:"count"`
+	Kept      []string   `json:"kept"`
+}
+
+type bucketIndex struct {
+	path    string
+	buckets map[string]*BucketEntry
+}
+
+var bucketIndexMu sync.Mutex
+var bucketIndexes = map[string]*bucketIndex{}
+
+// bucketIndexFor returns the index of crashDir, reading the one a resumed
+// campaign left there. The caller holds bucketIndexMu.
+func bucketIndexFor(crashDir string) *bucketIndex {
+	if ix, ok := bucketIndexes[crashDir]; ok {
+		return ix
+	}
+	ix := &bucketIndex{path: filepath.Join(crashDir, bucketIndexFileName), buckets: map[string]*BucketEntry{}}
+	if data, err := os.ReadFile(ix.path); err == nil {
+		_ = json.Unmarshal(data, &ix.buckets)
+	}
+	bucketIndexes[crashDir] = ix
+	return ix
+}
+
+func (ix *bucketIndex) entry(bucket string) *BucketEntry {
+	e, ok := ix.buckets[bucket]
+	if !ok {
+		e = &BucketEntry{}
+		ix.buckets[bucket] = e
+	}
+	return e
+}
+
+// reserve adds name to the kept cases of bucket unless it is full.
+func (ix *bucketIndex) reserve(bucket, name string) bool {
+	e := ix.entry(bucket)
+	if bucketKeep > 0 && len(e.Kept) >= bucketKeep {
+		return false
+	}
+	e.Kept = append(e.Kept, name)
+	return true
+}
+
+func (ix *bucketIndex) release(bucket, name string) {
+	e := ix.entry(bucket)
+	for i, kept := range e.Kept {
+		if kept == name {
+			e.Kept = append(e.Kept[:i], e.Kept[i+1:]...)
+			break
+		}
+	}
+}
+
+// save writes the index with the current bucket counts.
+func (ix *bucketIndex) save() {
+	for bucket, n := range bucketCounts() {
+		ix.entry(bucket).Count = n
+	}
+	data, err := encodeJSON(ix.buckets)
+	if err != nil {
+		return
+	}
+	tmp := ix.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err == nil {
+		_ = os.Rename(tmp, ix.path)
+	}
+}
+
+// fileCase counts a case under the bucket of sig and returns the directory
+// in crashDir to save it to, with its signature.json already written, or ""
+// when the bucket holds bucketKeep cases already. The callers count the case
+// first, so the checkpoint it requests has both.
+func fileCase(crashDir string, sig Signature, name string) string {
+	bucket := sig.Bucket()
+	addBucket(bucket)
+	defer requestCheckpoint()
+	bucketIndexMu.Lock()
+	defer bucketIndexMu.Unlock()
+	ix := bucketIndexFor(crashDir)
+	ix.entry(bucket).Signature = &sig
+	kept := ix.reserve(bucket, name)
+	ix.save()
+	if !kept {
+		return ""
+	}
+	dir := filepath.Join(crashDir, filepath.FromSlash(bucket), name)
+	if err := os.MkdirAll(dir, 0755); err == nil {
+		if data, err := encodeJSON(sig); err == nil {
+			_ = os.WriteFile(filepath.Join(dir, signatureFileName), data, 0o644)
+		}
+	}
+	return dir
+}
+
+// reserveBundle applies the bucket limit to the bundles the workers send;
+// they count their cases themselves.
+func reserveBundle(crashDir, bucket, name string) bool {
+	bucketIndexMu.Lock()
+	defer bucketIndexMu.Unlock()
+	return bucketIndexFor(crashDir).reserve(bucket, name)
+}
+
+// storedBundle records the signature of a stored bundle, or drops its
+// reservation when it could not be stored.
+func storedBundle(crashDir, bucket, name, dir string, ok bool) {
+	bucketIndexMu.Lock()
+	defer bucketIndexMu.Unlock()
+	ix := bucketIndexFor(crashDir)
+	if !ok {
+		ix.release(bucket, name)
+		return
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, signatureFileName)); err == nil {
+		sig := &Signature{}
+		if json.Unmarshal(data, sig) == nil {
+			ix.entry(bucket).Signature = sig
+		}
+	}
+	ix.save()
+}
+
+// encodeJSON indents v and keeps the < > & of operators readable.
+func encodeJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+// saveBucketIndex rewrites the index of crashDir with the current counts.
+func saveBucketIndex(crashDir string) {
+	bucketIndexMu.Lock()
+	defer bucketIndexMu.Unlock()
+	bucketIndexFor(crashDir).save()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIssueLines bounds the design, log and diff excerpts pasted into an
+// issue; longer files are left to the attachments.
+const maxIssueLines = 120
+
+// projectOf is the tracker a tool's bugs go to.
+func projectOf(tool string) string {
+	switch tool {
+	case "verilator":
+		return "verilator"
+	case "iverilog":
+		return "iverilog"
+	case "yosys", "yosys-verilator", "cxxrtl":
+		return "yosys"
+	}
+	return ""
+}
+
+var projectNames = map[string]string{
+	"verilator": "Verilator",
+	"iverilog":  "Icarus Verilog",
+	"yosys":     "Yosys",
+}
+
+// projects are the trackers to write an issue for: that of the suspect, or
+// of every tool the case ran when there is none.
+func (r *bugReport) projects() []string {
+	if r.sig != nil {
+		if project := projectOf(r.sig.Tool); project != "" {
+			return []string{project}
+		}
+	}
+	var out []string
+	for _, cmd := range r.cmds {
+		if project := projectOf(cmd.Tool); project != "" && !containsString(out, project) {
+			out = append(out, project)
+		}
+	}
+	return out
+}
+
+func (r *bugReport) kind() string {
+	if r.sig != nil {
+		return r.sig.Kind
+	}
+	if r.failure != nil {
+		return r.failure.Category
+	}
+	return "crash"
+}
+
+func (r *bugReport) tool() string {
+	if r.sig != nil && r.sig.Tool != "" {
+		return r.sig.Tool
+	}
+	if r.failure != nil {
+		return r.failure.Tool
+	}
+	return ""
+}
+
+func (r *bugReport) phase() string {
+	if r.failure != nil {
+		return r.failure.Phase
+	}
+	if r.sig != nil {
+		return r.sig.Phase
+	}
+	return ""
+}
+
+// simulated are the simulators of the case, in the order they ran.
+func (r *bugReport) simulated() []string {
+	var out []string
+	for _, cmd := range r.cmds {
+		if cmd.Phase == PhaseSimulation && !containsString(out, cmd.Tool) {
+			out = append(out, cmd.Tool)
+		}
+	}
+	return out
+}
+
+// equivalence says whether the case compares the variants of test.v in one
+// testbench rather than simulators.
+func (r *bugReport) equivalence() bool {
+	return r.tc != nil && r.tc.Fuzzer != "fuzz" && !r.tc.DiffSim
+}
+
+func (r *bugReport) title(project string) string {
+	tool, phase := r.tool(), r.phase()
+	switch r.kind() {
+	case "hang":
+		return fmt.Sprintf("%s hangs in %s", tool, phase)
+	case "resource":
+		if r.failure != nil && r.failure.Signal != "" {
+			return fmt.Sprintf("%s runs out of resources in %s (%s)", tool, phase, r.failure.Signal)
+		}
+		return fmt.Sprintf("%s runs out of resources in %s", tool, phase)
+	case "rejection":
+		return fmt.Sprintf("%s rejects a design other tools accept: %s", tool, r.sig.Message)
+	case "mismatch":
+		if r.equivalence() {
+			return fmt.Sprintf("%s simulates equivalent modules differently", projectNames[project])
+		}
+		return fmt.Sprintf("Simulation results differ between %s", strings.Join(r.simulated(), ", "))
+	}
+	message := ""
+	if r.sig != nil {
+		message = r.sig.Message
+	}
+	if message == "" && r.failure != nil {
+		message = r.failure.Error
+	}
+	if tool == "" {
+		return "Crash: " + message
+	}
+	return fmt.Sprintf("%s crashes in %s: %s", tool, phase, message)
+}
+
+// excerpt is the text of a bug file, its last lines if tail is set, cut to
+// maxIssueLines.
+func (r *bugReport) excerpt(name string, tail bool) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(r.dir, name))
+	if err != nil {
+		return "", false
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxIssueLines {
+		if tail {
+			lines = append([]string{"..."}, lines[len(lines)-maxIssueLines:]...)
+		} else {
+			lines = append(lines[:maxIssueLines], "...")
+		}
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+func fence(lang, text string) string {
+	return "```" + lang + "\n" + text + "\n```\n"
+}
+
+// shown are the commands an issue lists: for a failure those of the tool
+// up to the one that failed, leaving out the frontend checks unless it
+// failed one; for a mismatch all but the frontend checks.
+func (r *bugReport) shown() []ToolCommand {
+	var out []ToolCommand
+	failed := r.kind() != "mismatch"
+	for _, cmd := range r.cmds {
+		if !failed {
+			if cmd.Phase != PhaseFrontend {
+				out = append(out, cmd)
+			}
+			continue
+		}
+		if cmd.Tool != r.tool() {
+			continue
+		}
+		if (r.kind() == "rejection") != (cmd.Phase == PhaseFrontend) {
+			continue
+		}
+		out = append(out, cmd)
+		if cmd.Result != "ok" {
+			break
+		}
+	}
+	return out
+}
+
+// displayLine prints cmd to be run from the bug directory, with the tool
+// named by its program.
+func displayLine(cmd ToolCommand) string {
+	args := append([]string(nil), cmd.Args...)
+	for _, v := range reproVars() {
+		if len(args) > 0 && args[0] == v.value {
+			args[0] = filepath.Base(v.value)
+		}
+	}
+	for i := range args {
+		args[i] = strings.ReplaceAll(strings.ReplaceAll(args[i], caseVar+"/", ""), caseVar, ".")
+	}
+	line := shellLine(args, nil)
+	if dir := strings.TrimPrefix(strings.TrimPrefix(cmd.Dir, caseVar), "/"); dir != "" {
+		line = fmt.Sprintf("(cd %s && %s)", shellQuote(dir, nil), line)
+	}
+	return line
+}
+
+func (r *bugReport) design() string {
+	var sb strings.Builder
+	var attached []string
+	if data, err := os.ReadFile(filepath.Join(r.dir, "test.v")); err == nil {
+		if lines := strings.Count(string(data), "\n"); lines > maxIssueLines {
+			attached = append(attached, fmt.Sprintf("`test.v` (%d lines)", lines))
+		} else {
+			sb.WriteString("`test.v`:\n\n" + fence("verilog", strings.TrimRight(string(data), "\n")) + "\n")
+		}
+	}
+	for _, name := range []string{"tb.v", "tb_diff.v", "main.cpp", "main_eq.cpp", "input.txt", rewritesFileName} {
+		if _, err := os.Stat(filepath.Join(r.dir, name)); err == nil {
+			attached = append(attached, "`"+name+"`")
+		}
+	}
+	if len(attached) > 0 {
+		fmt.Fprintf(&sb, "Attached: %s.\n", strings.Join(attached, ", "))
+	}
+	return sb.String()
+}
+
+func (r *bugReport) steps() string {
+	shown := r.shown()
+	if len(shown) == 0 {
+		return ""
+	}
+	var lines []string
+	if dirs := caseSubdirs(shown); len(dirs) > 0 {
+		lines = append(lines, "mkdir -p "+shellLine(dirs, nil))
+	}
+	for _, cmd := range shown {
+		dir := strings.TrimPrefix(cmd.Dir, caseVar+"/")
+		if cmd.Input != "" && cmd.Dir != caseVar {
+			lines = append(lines, fmt.Sprintf("cp %s %s/", shellQuote(cmd.Input, nil), shellQuote(dir, nil)))
+		}
+		lines = append(lines, displayLine(cmd))
+	}
+	return "From the directory holding the attachments:\n\n" + fence("sh", strings.Join(lines, "\n")) +
+		"\n`repro.sh` reruns every command of the case.\n"
+}
+
+func (r *bugReport) actual() string {
+	switch r.kind() {
+	case "mismatch":
+		if text, ok := r.excerpt("diff.txt", false); ok {
+			return fence("", text)
+		}
+		// one report per pair that differs, each quoted under its name
+		pairs, _ := filepath.Glob(filepath.Join(r.dir, pairDiffPattern))
+		var sb strings.Builder
+		for _, path := range pairs {
+			if text, ok := r.excerpt(filepath.Base(path), false); ok {
+				fmt.Fprintf(&sb, "`%s`:\n\n%s\n", filepath.Base(path), fence("", text))
+			}
+		}
+		if sb.Len() > 0 {
+			return strings.TrimSuffix(sb.String(), "\n")
+		}
+		for _, name := range []string{equivDiffFileName, "reference_diff.txt"} {
+			if text, ok := r.excerpt(name, false); ok {
+				return fence("", text)
+			}
+		}
+		return "The outputs differ.\n"
+	case "rejection":
+		if text, ok := r.excerpt(rejectionFileName, false); ok {
+			return fence("", text)
+		}
+	}
+	var sb strings.Builder
+	if r.failure != nil {
+		sb.WriteString(r.failure.Error + "\n")
+	}
+	shown := r.shown()
+	if len(shown) > 0 {
+		last := shown[len(shown)-1]
+		if text, ok := r.excerpt(strings.TrimPrefix(last.Log, caseVar+"/"), true); ok && text != "" {
+			sb.WriteString("\n" + fence("", text))
+		}
+	}
+	if sb.Len() == 0 && r.sig != nil {
+		sb.WriteString(r.sig.Message + "\n")
+	}
+	return sb.String()
+}
+
+func (r *bugReport) expected() string {
+	tool, phase := r.tool(), r.phase()
+	switch r.kind() {
+	case "hang":
+		if r.failure != nil && r.failure.Timeout > 0 {
+			return fmt.Sprintf("%s finishes %s within %s.\n", tool, phase, formatSeconds(r.failure.Timeout))
+		}
+		return fmt.Sprintf("%s finishes %s.\n", tool, phase)
+	case "resource":
+		return fmt.Sprintf("%s finishes %s within the memory and CPU limits.\n", tool, phase)
+	case "rejection":
+		return fmt.Sprintf("%s accepts the design, as the other frontends do.\n", tool)
+	case "mismatch":
+		if r.equivalence() {
+			return "The modules of `test.v` are rewritten from `_eq0` by equivalence-preserving rules " +
+				"(listed in `rewrites.txt`), so every module prints the same records and the testbench " +
+				"reports no mismatch.\n"
+		}
+		if _, err := os.Stat(filepath.Join(r.dir, referenceFileName)); err == nil {
+			return "Every simulator prints the outputs of `" + referenceFileName + "`, computed from the Verilog semantics.\n"
+		}
+		return "Every simulator prints the same outputs.\n"
+	}
+	return fmt.Sprintf("%s finishes %s without crashing.\n", tool, phase)
+}
+
+func (r *bugReport) version(project string) string {
+	version := toolVersion(project)
+	if version == "" {
+		return "unknown"
+	}
+	if hash := gitHash(version); hash != "" {
+		return fmt.Sprintf("`%s` (commit %s)", version, hash)
+	}
+	return "`" + version + "`"
+}
+
+func (r *bugReport) found() string {
+	if r.tc == nil {
+		return "Found by VeriEQ.\n"
+	}
+	return fmt.Sprintf("Found by VeriEQ (fuzzer %s, seed %d).\n", r.tc.Fuzzer, r.tc.Seed)
+}
+
+// issue writes the issue body in the layout of the project's tracker.
+func (r *bugReport) issue(project string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", r.title(project))
+	switch project {
+	case "verilator":
+		sb.WriteString("### Can you attach an example that shows the issue?\n\n")
+		sb.WriteString(r.found() + "\n" + r.design() + "\n" + r.steps() + "\nActual:\n\n" + r.actual() + "\nExpected: " + r.expected())
+		sb.WriteString("\n### What 'verilator --version' are you using? Did you try it with the git master version?\n\n")
+		sb.WriteString(r.version(project) + "; not tried with git master.\n")
+		sb.WriteString("\n### What OS and distribution are you using?\n\n" + osDescription() + "\n")
+	case "iverilog":
+		sb.WriteString(r.found())
+		sb.WriteString("\n## Version\n\n`iverilog -V`: " + r.version(project) + "\n")
+		sb.WriteString("\n## Test case\n\n" + r.design())
+		sb.WriteString("\n## Steps to reproduce\n\n" + r.steps())
+		sb.WriteString("\n## Actual behavior\n\n" + r.actual())
+		sb.WriteString("\n## Expected behavior\n\n" + r.expected())
+		sb.WriteString("\n## Environment\n\n" + osDescription() + "\n")
+	default:
+		sb.WriteString("### Version\n\n" + r.version(project) + "\n")
+		sb.WriteString("\n### On which OS did this happen?\n\n" + osDescription() + "\n")
+		sb.WriteString("\n### Reproduction Steps\n\n" + r.found() + "\n" + r.design() + "\n" + r.steps())
+		sb.WriteString("\n### Expected Behavior\n\n" + r.expected())
+		sb.WriteString("\n### Actual Behavior\n\n" + r.actual())
+	}
+	return sb.String()
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// commandLogFileName is where runTool logs the commands of a case.
+	commandLogFileName = "commands.jsonl"
+	commandsFileName   = "commands.txt"
+	manifestFileName   = "manifest.json"
+	reproFileName      = "repro.sh"
+)
+
+// caseVar stands for the case directory in logged commands; repro.sh sets
+// it to the copy it runs in.
+const caseVar = "$W"
+
+// ToolCommand is one tool run of a case as runTool started it, before the
+// resource limits wrapped it. Paths in the case directory start with $W.
+type ToolCommand struct {
+	Tool    string   `json:"tool"`
+	Phase   string   `json:"phase"`
+	Dir     string   `json:"dir"`
+	Args    []string `json:"args"`
+	Input   string   `json:"input,omitempty"`
+	Log     string   `json:"log,omitempty"`
+	Timeout float64  `json:"timeout_seconds,omitempty"`
+	Result  string   `json:"result"`
+}
+
+var commandLogMu sync.Mutex
+
+// logCommand appends cmd to the command log of job's case.
+func logCommand(job SimJob, cmd ToolCommand) {
+	root := job.caseDir()
+	if root == "" {
+		return
+	}
+	root = filepath.Clean(root)
+	inCase := func(s string) string { return strings.ReplaceAll(s, root, caseVar) }
+	cmd.Dir, cmd.Log = inCase(cmd.Dir), inCase(cmd.Log)
+	cmd.Args = append([]string(nil), cmd.Args...)
+	for i, arg := range cmd.Args {
+		cmd.Args[i] = inCase(arg)
+	}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return
+	}
+	commandLogMu.Lock()
+	defer commandLogMu.Unlock()
+	file, err := os.OpenFile(filepath.Join(root, commandLogFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	_, _ = file.Write(append(data, '\n'))
+}
+
+func readCommands(path string) []ToolCommand {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var cmds []ToolCommand
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1<<20), 1<<24)
+	for scanner.Scan() {
+		var cmd ToolCommand
+		if json.Unmarshal(scanner.Bytes(), &cmd) == nil {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds
+}
+
+// BugManifest is saved as manifest.json with every bug directory.
+type BugManifest struct {
+	Bucket      string              `json:"bucket,omitempty"`
+	Signature   *Signature          `json:"signature,omitempty"`
+	Seed        int64               `json:"seed"`
+	Fuzzer      string              `json:"fuzzer,omitempty"`
+	Case        *TestCase           `json:"case,omitempty"`
+	CommandLine []string            `json:"command_line"`
+	Revision    string              `json:"veriEQ_revision,omitempty"`
+	OS          string              `json:"os"`
+	Tools       map[string]ToolInfo `json:"tools"`
+	Commands    []ToolCommand       `json:"commands"`
+}
+
+// ToolInfo is the binary a tool ran from and its version.
+type ToolInfo struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Git     string `json:"git,omitempty"`
+}
+
+// bugReport is what the files of a saved case say about it.
+type bugReport struct {
+	dir     string
+	sig     *Signature
+	tc      *TestCase
+	failure *FailureRecord
+	cmds    []ToolCommand
+}
+
+func loadBugReport(dir string) *bugReport {
+	r := &bugReport{dir: dir, cmds: readCommands(filepath.Join(dir, commandLogFileName))}
+	if data, err := os.ReadFile(filepath.Join(dir, signatureFileName)); err == nil {
+		sig := &Signature{}
+		if json.Unmarshal(data, sig) == nil {
+			r.sig = sig
+		}
+	}
+	if tc, err := LoadTestCase(filepath.Join(dir, caseFileName)); err == nil {
+		r.tc = tc
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, failureFileName)); err == nil {
+		failure := &FailureRecord{}
+		if json.Unmarshal(data, failure) == nil {
+			r.failure = failure
+		}
+	}
+	return r
+}
+
+// writeBugReport adds to the bug directory dir its manifest, the commands
+// its case ran, repro.sh and, unless it was suppressed, an issue body for
+// the tracker of each project it may be a bug of.
+func writeBugReport(dir string) error {
+	r := loadBugReport(dir)
+	data, err := encodeJSON(r.manifest())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, manifestFileName), data, 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, commandsFileName), []byte(r.commandsText()), 0o644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, reproFileName), []byte(r.repro()), 0o755); err != nil {
+		return err
+	}
+	if r.sig != nil && r.sig.Kind == "suppressed" {
+		return nil
+	}
+	for _, project := range r.projects() {
+		name := "issue_" + project + ".md"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(r.issue(project)), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *bugReport) manifest() *BugManifest {
+	m := &BugManifest{
+		Signature:   r.sig,
+		Case:        r.tc,
+		CommandLine: os.Args,
+		Revision:    veriEQRevision(),
+		OS:          osDescription(),
+		Tools:       map[string]ToolInfo{},
+		Commands:    r.cmds,
+	}
+	if m.Commands == nil {
+		m.Commands = []ToolCommand{}
+	}
+	if r.sig != nil {
+		m.Bucket = r.sig.Bucket()
+	}
+	if r.tc != nil {
+		m.Seed, m.Fuzzer = r.tc.Seed, r.tc.Fuzzer
+	}
+	for _, cmd := range r.cmds {
+		if path := toolPath(cmd.Tool); path != "" {
+			version := toolVersion(cmd.Tool)
+			m.Tools[cmd.Tool] = ToolInfo{Path: path, Version: version, Git: gitHash(version)}
+		}
+	}
+	return m
+}
+
+// toolPath is the binary of a tool in the tool config.
+func toolPath(tool string) string {
+	switch tool {
+	case "iverilog":
+		return toolConfig.IverilogPath
+	case "verilator", "yosys-verilator":
+		return toolConfig.VerilatorPath
+	case "yosys", "cxxrtl":
+		return toolConfig.YosysPath
+	}
+	return ""
+}
+
+// gitVersionHash finds the commit in `yosys -V` ("git sha1 2f9c1b2") and in
+// the describe-style versions of verilator and iverilog ("-g1a2b3c4").
+var gitVersionHash = regexp.MustCompile(`git sha1 ([0-9a-f]{6,40})|-g([0-9a-f]{6,40})\b`)
+
+func gitHash(version string) string {
+	m := gitVersionHash.FindStringSubmatch(version)
+	if m == nil {
+		return ""
+	}
+	return m[1] + m[2]
+}
+
+var (
+	revisionOnce sync.Once
+	revision     string
+)
+
+// veriEQRevision is the commit VeriEQ was built from, or else the one
+// checked out where it runs.
+func veriEQRevision() string {
+	revisionOnce.Do(func() {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			modified := false
+			for _, s := range info.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					revision = s.Value
+				case "vcs.modified":
+					modified = s.Value == "true"
+				}
+			}
+			if revision != "" && modified {
+				revision += "+dirty"
+			}
+		}
+		if revision == "" {
+			if out, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+				revision = strings.TrimSpace(string(out))
+			}
+		}
+	})
+	return revision
+}
+
+func osDescription() string {
+	name := runtime.GOOS
+	if data, err := os.ReadFile("/etc/os-release"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+				name = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return name + " " + runtime.GOARCH
+}
+
+// shellVar is a variable repro.sh substitutes for a path.
+type shellVar struct {
+	name, value string
+}
+
+// reproVars are the tool paths of the config, the longest first so that
+// yosys-config is not taken for yosys.
+func reproVars() []shellVar {
+	vars := []shellVar{
+		{"VERILATOR", toolConfig.VerilatorPath},
+		{"IVERILOG", toolConfig.IverilogPath},
+		{"YOSYS", toolConfig.YosysPath},
+		{"YOSYS_CONFIG", toolConfig.YosysConfigPath},
+		{"CLANGXX", toolConfig.ClangXXPath},
+	}
+	sort.SliceStable(vars, func(i, j int) bool { return len(vars[i].value) > len(vars[j].value) })
+	return vars
+}
+
+var plainWord = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote quotes s for bash, leaving $W and the paths of vars to be
+// expanded. A path with no slash, such as clang++, is only taken for a
+// variable at the start of s.
+func shellQuote(s string, vars []shellVar) string {
+	if s == "" {
+		return "''"
+	}
+	var sb strings.Builder
+	literal := func(text string) {
+		if text == "" {
+			return
+		}
+		if plainWord.MatchString(text) {
+			sb.WriteString(text)
+			return
+		}
+		sb.WriteString("'" + strings.ReplaceAll(text, "'", `'\''`) + "'")
+	}
+	for s != "" {
+		at, name, value := -1, "", ""
+		consider := func(n, v string) {
+			if v == "" {
+				return
+			}
+			i := strings.Index(s, v)
+			if !strings.Contains(v, "/") && i != 0 {
+				return
+			}
+			if i >= 0 && (at < 0 || i < at || i == at && len(v) > len(value)) {
+				at, name, value = i, n, v
+			}
+		}
+		consider("W", caseVar)
+		for _, v := range vars {
+			consider(v.name, v.value)
+		}
+		if at < 0 {
+			literal(s)
+			break
+		}
+		literal(s[:at])
+		sb.WriteString(`"$` + name + `"`)
+		s = s[at+len(value):]
+		// a bare name only stands for the tool at the very start
+		vars = withPaths(vars)
+	}
+	return sb.String()
+}
+
+func withPaths(vars []shellVar) []shellVar {
+	var out []shellVar
+	for _, v := range vars {
+		if strings.Contains(v.value, "/") {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func shellLine(args []string, vars []shellVar) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		words[i] = shellQuote(arg, vars)
+	}
+	return strings.Join(words, " ")
+}
+
+// commandsText lists the commands as run, one per line after its tool,
+// phase and result.
+func (r *bugReport) commandsText() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s is the case directory\n", caseVar)
+	for _, cmd := range r.cmds {
+		fmt.Fprintf(&sb, "\n# %s %s: %s\n", cmd.Tool, cmd.Phase, cmd.Result)
+		fmt.Fprintf(&sb, "cd %s && %s\n", shellQuote(cmd.Dir, nil), shellLine(cmd.Args, nil))
+	}
+	return sb.String()
+}
+
+var casePath = regexp.MustCompile(`\$W/([^\s'";]+)`)
+
+// caseSubdirs are the directories below $W the commands build in or write
+// to, which have to be created before they run.
+func caseSubdirs(cmds []ToolCommand) []string {
+	seen := map[string]bool{}
+	var dirs []string
+	add := func(dir string) {
+		if dir != "." && !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, cmd := range cmds {
+		if rel, ok := strings.CutPrefix(cmd.Dir, caseVar+"/"); ok {
+			add(rel)
+		}
+		for _, arg := range cmd.Args {
+			for _, m := range casePath.FindAllStringSubmatch(arg, -1) {
+				add(filepath.Dir(m[1]))
+			}
+		}
+	}
+	return dirs
+}
+
+// repro writes a script that reruns every command of the case in a copy of
+// the bug directory, with the tools at the paths of the config the case was
+// run with.
+func (r *bugReport) repro() string {
+	vars := reproVars()
+	var sb strings.Builder
+	sb.WriteString("#!/usr/bin/env bash\n")
+	sb.WriteString("# Reruns the tools of this case in a copy of its directory. The tool paths\n")
+	sb.WriteString("# come from the config.json it was found with; override them with\n")
+	sb.WriteString("# VERILATOR=... IVERILOG=... YOSYS=... YOSYS_CONFIG=... CLANGXX=...\n")
+	sb.WriteString("# and the copy with W=<dir>.\n")
+	sb.WriteString("set -u\n")
+	for _, v := range []string{"VERILATOR", "IVERILOG", "YOSYS", "YOSYS_CONFIG", "CLANGXX"} {
+		for _, sv := range vars {
+			if sv.name == v {
+				fmt.Fprintf(&sb, "%s=${%s:-%s}\n", v, v, shellQuote(sv.value, nil))
+			}
+		}
+	}
+	sb.WriteString(`here=$(cd "$(dirname "$0")" && pwd)` + "\n")
+	sb.WriteString("W=${W:-$(mktemp -d)}\n")
+	sb.WriteString(`cp -R "$here"/. "$W"/` + "\n")
+	sb.WriteString(`echo "running in $W"` + "\n")
+	for _, dir := range caseSubdirs(r.cmds) {
+		fmt.Fprintf(&sb, "mkdir -p %s\n", shellQuote(caseVar+"/"+dir, nil))
+	}
+	for _, cmd := range r.cmds {
+		fmt.Fprintf(&sb, "\necho %s\n", shellQuote(fmt.Sprintf("== %s %s (found: %s)", cmd.Tool, cmd.Phase, cmd.Result), nil))
+		dir := shellQuote(cmd.Dir, nil)
+		if cmd.Input != "" && cmd.Dir != caseVar {
+			fmt.Fprintf(&sb, "cp %s %s/\n", shellQuote(caseVar+"/"+cmd.Input, nil), dir)
+		}
+		line := shellLine(cmd.Args, vars)
+		if cmd.Timeout > 0 {
+			line = fmt.Sprintf("timeout -s KILL %s %s", formatSeconds(cmd.Timeout), line)
+		}
+		fmt.Fprintf(&sb, "(cd %s && %s)\n", dir, line)
+		sb.WriteString("echo \"exit $?\"\n")
+	}
+	return sb.String()
+}
+
+// formatSeconds prints a timeout for timeout(1) without rounding it, so
+// that a limit under a second does not become 0, which disables it.
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64) + "s"
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatSeconds(t *testing.T) {
+	tests := []struct {
+		seconds float64
+		want    string
+	}{
+		{0.3, "0.3s"},
+		{0.25, "0.25s"},
+		{1, "1s"},
+		{1.5, "1.5s"},
+		{1800, "1800s"},
+		{1e6, "1000000s"},
+	}
+	for _, tt := range tests {
+		if got := formatSeconds(tt.seconds); got != tt.want {
+			t.Errorf("formatSeconds(%v) = %q, want %q", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestReproTimeout(t *testing.T) {
+	r := &bugReport{cmds: []ToolCommand{
+		{Tool: "iverilog", Phase: PhaseSimulation, Dir: caseVar, Args: []string{"vvp", "a.out"}, Timeout: 0.3, Result: "hang"},
+		{Tool: "iverilog", Phase: PhaseElaboration, Dir: caseVar, Args: []string{"iverilog", "test.v"}, Result: "ok"},
+	}}
+	script := r.repro()
+	if !strings.Contains(script, "(cd \"$W\" && timeout -s KILL 0.3s vvp a.out)\n") {
+		t.Errorf("sub-second timeout lost:\n%s", script)
+	}
+	if !strings.Contains(script, "(cd \"$W\" && iverilog test.v)\n") {
+		t.Errorf("command without a timeout:\n%s", script)
+	}
+}
+
+func TestPairDiffsReachTheReport(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		"test.v":                         "module m; endmodule\n",
+		"diff_iverilog_vs_verilator.txt": "out differs at cycle 3\n",
+		"diff_0_vs_2.txt":                "out_eq2 differs at cycle 1\n",
+		"notes.txt":                      "not copied\n",
+	}
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := copyCrashArtifacts(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name := range files {
+		_, err := os.Stat(filepath.Join(dst, name))
+		if copied := err == nil; copied != (name != "notes.txt") {
+			t.Errorf("%s: copied = %v", name, copied)
+		}
+	}
+
+	r := &bugReport{dir: dst, sig: &Signature{Kind: "mismatch"}}
+	actual := r.actual()
+	for _, want := range []string{"`diff_0_vs_2.txt`:", "out_eq2 differs at cycle 1", "`diff_iverilog_vs_verilator.txt`:", "out differs at cycle 3"} {
+		if !strings.Contains(actual, want) {
+			t.Errorf("actual lacks %q:\n%s", want, actual)
+		}
+	}
+	if strings.Contains(actual, "The outputs differ.") {
+		t.Errorf("pair diffs not quoted:\n%s", actual)
+	}
+}
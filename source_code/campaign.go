@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	StopReasonSignal   = "signal"
+	StopReasonDuration = "duration"
+	StopReasonMaxCases = "max-cases"
+	// a worker stops when its coordinator ends the campaign or goes away
+	StopReasonCoordinator = "coordinator"
+)
+
+// Campaign bounds a fuzzing run by wall-clock time, number of generated
+// cases and SIGINT/SIGTERM. Producers ask it for permission before handing
+// out work, so stopping it lets the in-flight cases finish cleanly.
+type Campaign struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	Start    time.Time
+	Duration time.Duration
+	MaxCases int64
+	Seed     int64
+	// ID names the log/, tmp/ and bug/ directories. A resumed campaign keeps
+	// the ID of the run it continues.
+	ID int64
+
+	prior  time.Duration // elapsed time of the runs this one resumes
+	issued int64
+	seq    int64
+	// inflight maps the seeds handed out and not done yet to their sequence
+	// numbers; requeue holds those of a resumed run, handed out first.
+	seqMu      sync.Mutex
+	inflight   map[int64]int64
+	requeue    []int64
+	stopMu     sync.Mutex
+	stopReason string
+}
+
+var activeCampaign *Campaign
+
+func NewCampaign(duration time.Duration, maxCases int64, seed int64) *Campaign {
+	ctx, cancel := context.WithCancel(context.Background())
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	c := &Campaign{
+		ctx:      ctx,
+		cancel:   cancel,
+		Start:    time.Now(),
+		Duration: duration,
+		MaxCases: maxCases,
+		Seed:     seed,
+	}
+	c.ID = c.Start.UnixMilli()
+	if duration > 0 {
+		time.AfterFunc(duration, func() {
+			c.Stop(StopReasonDuration)
+		})
+	}
+	activeCampaign = c
+	return c
+}
+
+// LogDir is log/<ID>/, the directory the campaign's fuzzers log to.
+func (c *Campaign) LogDir() string {
+	return filepath.Join(LOGDIR, strconv.FormatInt(c.ID, 10))
+}
+
+func (c *Campaign) Context() context.Context {
+	return c.ctx
+}
+
+// Next claims one case from the budget. It returns false once the campaign
+// has been stopped or the case budget is exhausted.
+func (c *Campaign) Next() bool {
+	if c.ctx.Err() != nil {
+		return false
+	}
+	if c.MaxCases > 0 && atomic.AddInt64(&c.issued, 1) > c.MaxCases {
+		c.Stop(StopReasonMaxCases)
+		return false
+	}
+	return true
+}
+
+// NextSeed returns the seed of the next test case. Case seeds are derived
+// from the campaign seed and a sequence number, so a whole campaign can be
+// regenerated from its base seed and any single case from its own seed.
+// The seed counts as in flight until Done is called with it.
+func (c *Campaign) NextSeed() int64 {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	var seq int64
+	if len(c.requeue) > 0 {
+		seq, c.requeue = c.requeue[0], c.requeue[1:]
+	} else {
+		seq = atomic.AddInt64(&c.seq, 1)
+	}
+	seed := caseSeed(c.Seed, seq)
+	if c.inflight == nil {
+		c.inflight = map[int64]int64{}
+	}
+	c.inflight[seed] = seq
+	return seed
+}
+
+// Done marks the case of seed as finished, so a checkpoint no longer lists
+// it as in flight.
+func (c *Campaign) Done(seed int64) {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	delete(c.inflight, seed)
+}
+
+// pending returns the sequence numbers of the cases handed out and not done
+// and of those still to be requeued, in order.
+func (c *Campaign) pending() []int64 {
+	c.seqMu.Lock()
+	defer c.seqMu.Unlock()
+	seqs := append([]int64(nil), c.requeue...)
+	for _, seq := range c.inflight {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs
+}
+
+func caseSeed(base, seq int64) int64 {
+	// splitmix64 finalizer, so neighbouring cases get unrelated streams
+	z := uint64(base) + uint64(seq)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return int64(z >> 1)
+}
+
+func (c *Campaign) Stop(reason string) {
+	c.stopMu.Lock()
+	if c.stopReason == "" {
+		c.stopReason = reason
+	}
+	c.stopMu.Unlock()
+	c.cancel()
+}
+
+func (c *Campaign) Stopping() bool {
+	return c != nil && c.ctx.Err() != nil
+}
+
+// Interrupted reports whether the campaign was stopped by a signal. Tools
+// running at that moment may have been killed by the same signal.
+func (c *Campaign) Interrupted() bool {
+	return c.Stopping() && c.StopReason() == StopReasonSignal
+}
+
+func (c *Campaign) StopReason() string {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	return c.stopReason
+}
+
+// HandleSignals stops the campaign on the first SIGINT/SIGTERM and lets the
+// workers drain. A second signal exits immediately.
+func (c *Campaign) HandleSignals() {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		PrettyWarn("main", fmt.Sprintf("received %s, draining in-flight workers (send again to force exit)", sig))
+		c.Stop(StopReasonSignal)
+		<-sigs
+		PrettyErr("main", "forced exit")
+		os.Exit(130)
+	}()
+}
+
+type CampaignSummary struct {
+	Fuzzer     string  `json:"fuzzer"`
+	Seed       int64   `json:"seed"`
+	StopReason string  `json:"stop_reason"`
+	Elapsed    float64 `json:"elapsed_seconds"`
+	Cases      int64   `json:"cases"`
+	Iverilog   int64   `json:"iverilog_variants"`
+	Verilator  int64   `json:"verilator_variants"`
+	YosysOpt   int64   `json:"yosys_opt_variants"`
+	CXXRTL     int64   `json:"cxxrtl_variants"`
+	Bugs       int64   `json:"bugs"`
+	Crashes    int64   `json:"crashes"`
+	Hangs      int64   `json:"hangs"`
+	Resource   int64   `json:"resource_exhausted"`
+	// Rejections counts frontend rejections of designs other frontends
+	// accept, per rejecting frontend.
+	Rejections int64 `json:"rejections"`
+	// Suppressed counts the cases a false-positive rule matched; they are
+	// not in Bugs, Crashes, Hangs or Resource.
+	Suppressed int64 `json:"suppressed"`
+	// Suspects counts mismatches by the tool the majority vote blamed.
+	Suspects map[string]int64 `json:"suspects,omitempty"`
+	// Buckets counts the findings by signature bucket, see buckets.json.
+	Buckets map[string]int64 `json:"buckets,omitempty"`
+}
+
+func (c *Campaign) Summary(name string) CampaignSummary {
+	return CampaignSummary{
+		Fuzzer:     name,
+		Seed:       c.Seed,
+		StopReason: c.StopReason(),
+		Elapsed:    (c.prior + time.Since(c.Start)).Seconds(),
+		Cases:      atomic.LoadInt64(&countCases),
+		Iverilog:   atomic.LoadInt64(&countIverilog),
+		Verilator:  atomic.LoadInt64(&countVerilator),
+		YosysOpt:   atomic.LoadInt64(&countYosysOpt),
+		CXXRTL:     atomic.LoadInt64(&countCXXRTL),
+		Bugs:       atomic.LoadInt64(&countBugs),
+		Crashes:    atomic.LoadInt64(&countCrashes),
+		Hangs:      atomic.LoadInt64(&countHangs),
+		Resource:   atomic.LoadInt64(&countResource),
+		Rejections: atomic.LoadInt64(&countRejections),
+		Suppressed: atomic.LoadInt64(&countSuppressed),
+		Suspects:   suspectCounts(),
+		Buckets:    bucketCounts(),
+	}
+}
+
+func (s CampaignSummary) String() string {
+	str := fmt.Sprintf("seed=%d stop=%s elapsed=%.0fs cases=%d bugs=%d crashes=%d hangs=%d resource=%d rejections=%d suppressed=%d\nIcarus=%d Verilator=%d YosysOpt=%d CXXRTL=%d",
+		s.Seed, s.StopReason, s.Elapsed, s.Cases, s.Bugs, s.Crashes, s.Hangs, s.Resource, s.Rejections, s.Suppressed,
+		s.Iverilog, s.Verilator, s.YosysOpt, s.CXXRTL)
+	if len(s.Suspects) > 0 {
+		str += "\nsuspects:"
+		for _, tool := range sortedKeys(s.Suspects) {
+			str += fmt.Sprintf(" %s=%d", tool, s.Suspects[tool])
+		}
+	}
+	if len(s.Buckets) > 0 {
+		str += fmt.Sprintf("\nbuckets=%d", len(s.Buckets))
+	}
+	return str
+}
+
+func writeSummary(logDir string, s CampaignSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(logDir, "summary.json"), data, 0o644)
+}
+
+// finish removes the fuzzer's working tree and records the final summary.
+func (c *Campaign) finish(name string, fuzzers ...*Fuzzer) {
+	summary := c.Summary(name)
+	for _, f := range fuzzers {
+		if err := os.RemoveAll(f.TmpDir); err != nil {
+			PrettyErr("main", err.Error())
+		}
+		if err := writeSummary(f.LogDir, summary); err != nil {
+			PrettyErr("main", err.Error())
+		}
+	}
+	if err := writeCheckpoint(c.LogDir(), c.Checkpoint(name)); err != nil {
+		PrettyErr("main", err.Error())
+	}
+	emitEvent(Event{Type: EventSummary, Fuzzer: name, Duration: summary.Elapsed, Summary: &summary})
+	if err := eventLog.Close(); err != nil {
+		PrettyErr("main", err.Error())
+	}
+	PrettySummary("campaign finished", summary.String())
+}
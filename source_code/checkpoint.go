@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// Checkpoint is what -resume needs to continue a campaign: its directory ID,
+// targets, position in the seed sequence and counters. Test cases are
+// regenerated from their seeds, so the sequence position is the corpus.
+// InFlight lists the sequence numbers below Seq whose cases had not
+// finished; they run again first.
+type Checkpoint struct {
+	ID       int64           `json:"id"`
+	Targets  string          `json:"targets"`
+	Seq      int64           `json:"seq"`
+	InFlight []int64         `json:"in_flight,omitempty"`
+	Summary  CampaignSummary `json:"summary"`
+}
+
+func (c *Campaign) Checkpoint(targets string) Checkpoint {
+	return Checkpoint{
+		ID:       c.ID,
+		Targets:  targets,
+		Seq:      atomic.LoadInt64(&c.seq),
+		InFlight: c.pending(),
+		Summary:  c.Summary(targets),
+	}
+}
+
+// writeCheckpoint replaces dir/checkpoint.json atomically, so a run killed
+// mid-write still leaves the previous checkpoint behind.
+func writeCheckpoint(dir string, cp Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, checkpointFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, checkpointFileName))
+}
+
+// LoadCheckpoint reads the checkpoint of a previous run. runDir may be its
+// log/<ts>, tmp/<ts> or bug/<ts> directory, or just <ts>.
+func LoadCheckpoint(runDir string) (*Checkpoint, error) {
+	ts := filepath.Base(filepath.Clean(runDir))
+	if _, err := strconv.ParseInt(ts, 10, 64); err != nil {
+		return nil, fmt.Errorf("resume: %s is not a run directory", runDir)
+	}
+	data, err := os.ReadFile(filepath.Join(LOGDIR, ts, checkpointFileName))
+	if err != nil {
+		return nil, fmt.Errorf("resume: %w", err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("resume: %s: %w", ts, err)
+	}
+	return &cp, nil
+}
+
+// ResumeCampaign continues the campaign recorded in cp: same directories,
+// seed and counters. The cases that were in flight run again first, then
+// the seed sequence picks up where it stopped. -duration and -max-cases
+// bound only the resumed session.
+func ResumeCampaign(cp *Checkpoint, duration time.Duration, maxCases int64) *Campaign {
+	c := NewCampaign(duration, maxCases, cp.Summary.Seed)
+	c.ID = cp.ID
+	c.seq = cp.Seq
+	c.requeue = append([]int64(nil), cp.InFlight...)
+	c.prior = time.Duration(cp.Summary.Elapsed * float64(time.Second))
+
+	s := cp.Summary
+	atomic.StoreInt64(&countCases, s.Cases)
+	atomic.StoreInt64(&countIverilog, s.Iverilog)
+	atomic.StoreInt64(&countVerilator, s.Verilator)
+	atomic.StoreInt64(&countYosysOpt, s.YosysOpt)
+	atomic.StoreInt64(&countCXXRTL, s.CXXRTL)
+	atomic.StoreInt64(&countBugs, s.Bugs)
+	atomic.StoreInt64(&countCrashes, s.Crashes)
+	atomic.StoreInt64(&countHangs, s.Hangs)
+	atomic.StoreInt64(&countResource, s.Resource)
+	atomic.StoreInt64(&countRejections, s.Rejections)
+	atomic.StoreInt64(&countSuppressed, s.Suppressed)
+	setSuspectCounts(s.Suspects)
+	setBucketCounts(s.Buckets)
+
+	// leftovers of cases that were in flight when the run died
+	_ = os.RemoveAll(filepath.Join(TMPDIR, strconv.FormatInt(c.ID, 10)))
+	return c
+}
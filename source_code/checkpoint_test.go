@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestResumeRequeuesInFlightCases(t *testing.T) {
+	withCampaignDirs(t)
+	c := NewCampaign(0, 0, 42)
+	first, second, third := c.NextSeed(), c.NextSeed(), c.NextSeed()
+	c.Done(second)
+	cp := c.Checkpoint("fuzz:1")
+	if cp.Seq != 3 || len(cp.InFlight) != 2 || cp.InFlight[0] != 1 || cp.InFlight[1] != 3 {
+		t.Fatalf("checkpoint at %d with %v in flight, want 3 with [1 3]", cp.Seq, cp.InFlight)
+	}
+
+	r := ResumeCampaign(&cp, 0, 0)
+	want := []int64{first, third, caseSeed(42, 4)}
+	for i, w := range want {
+		if got := r.NextSeed(); got != w {
+			t.Errorf("seed %d after resume: %d, want %d", i, got, w)
+		}
+	}
+	// requeued cases not handed out yet stay in the next checkpoint
+	r = ResumeCampaign(&cp, 0, 0)
+	r.Done(r.NextSeed())
+	if got := r.Checkpoint("fuzz:1").InFlight; len(got) != 1 || got[0] != 3 {
+		t.Errorf("in flight after one requeued case: %v, want [3]", got)
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type ToolConfig struct {
@@ -16,6 +18,61 @@ type ToolConfig struct {
 	YosysConfigPath string `json:"yosys_config_path"`
 	ClangXXPath     string `json:"clangxx_path"`
 	TreePath        string `json:"tree_path"`
+
+	// Backends maps a fuzzing target to the simulators it is compared
+	// against in diff-sim mode, e.g. {"verilator": ["iverilog", "cxxrtl"]}.
+	Backends map[string][]string `json:"backends,omitempty"`
+
+	// Frontends are compiled with every case before it is simulated, see
+	// checkFrontends; default iverilog, verilator and yosys.
+	Frontends []string `json:"frontends,omitempty"`
+
+	// Timeouts bounds each tool by name ("verilator", "iverilog", "yosys",
+	// "cxxrtl"); unset entries fall back to -compile-timeout/-run-timeout.
+	Timeouts map[string]ToolTimeout `json:"timeouts,omitempty"`
+
+	// Limits holds per-tool resource limits; "default" applies to tools
+	// without their own entry.
+	Limits map[string]ResourceLimits `json:"limits,omitempty"`
+
+	// Targets is used when -fuzzer is not given: target name to threads,
+	// e.g. {"verilator": 40, "cxxrtl": 20}.
+	Targets map[string]int `json:"targets,omitempty"`
+}
+
+// ToolTimeout holds Go durations such as "10m". Compile covers elaboration
+// and the C++ build, Run the simulation itself; "0" disables the limit.
+type ToolTimeout struct {
+	Compile string `json:"compile,omitempty"`
+	Run     string `json:"run,omitempty"`
+}
+
+// timeout returns the limit for one phase of tool.
+func (c *ToolConfig) timeout(tool, phase string) time.Duration {
+	limit := compileTimeout
+	value := c.Timeouts[tool].Compile
+	if phase == PhaseSimulation {
+		limit = runTimeout
+		value = c.Timeouts[tool].Run
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		limit = d
+	}
+	return limit
+}
+
+func (c *ToolConfig) validateTimeouts() error {
+	for tool, t := range c.Timeouts {
+		for _, value := range []string{t.Compile, t.Run} {
+			if value == "" {
+				continue
+			}
+			if _, err := time.ParseDuration(value); err != nil {
+				return fmt.Errorf("timeouts.%s: %v", tool, err)
+			}
+		}
+	}
+	return nil
 }
 
 func defaultToolConfig() ToolConfig {
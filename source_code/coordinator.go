@@ -0,0 +1,478 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const maxBundleBytes = 256 << 20
+
+// Assignment is one case a worker should run.
+type Assignment struct {
+	Fuzzer   string   `json:"fuzzer"`
+	Seed     int64    `json:"seed"`
+	Backends []string `json:"backends"`
+}
+
+// Lease carries the campaign-wide settings with the cases, so every worker
+// generates the same bytes for a seed. An empty lease means "ask again".
+type Lease struct {
+	ID         int64                          `json:"id"`
+	Count      int                            `json:"count"`
+	DiffSim    bool                           `json:"diff_sim"`
+	Reference  bool                           `json:"reference"`
+	Waveform   bool                           `json:"waveform"`
+	Frontends  []string                       `json:"frontends,omitempty"`
+	GenOptions CodeGenerator.GeneratorOptions `json:"generator_options"`
+	Cases      []Assignment                   `json:"cases"`
+}
+
+type LeaseRequest struct {
+	Worker string `json:"worker"`
+	Slots  int    `json:"slots"`
+}
+
+type CaseResult struct {
+	Fuzzer  string  `json:"fuzzer"`
+	Seed    int64   `json:"seed"`
+	Found   bool    `json:"found"`
+	Seconds float64 `json:"seconds"`
+}
+
+// CompleteRequest returns a lease. Summary holds the worker's own counters
+// since it started, Run tells its runs apart; the coordinator's counters are
+// the sum over the runs of all workers.
+type CompleteRequest struct {
+	Worker  string          `json:"worker"`
+	Run     int64           `json:"run"`
+	Lease   int64           `json:"lease"`
+	Results []CaseResult    `json:"results"`
+	Summary CampaignSummary `json:"summary"`
+}
+
+type CoordinatorStatus struct {
+	Summary CampaignSummary            `json:"summary"`
+	Leases  int                        `json:"leases"`
+	Workers map[string]CampaignSummary `json:"workers"`
+}
+
+type workerRun struct {
+	worker string
+	run    int64
+}
+
+type lease struct {
+	worker  string
+	cases   []Assignment
+	expires time.Time
+}
+
+// Coordinator runs a campaign whose cases are executed by remote workers.
+// It hands out seeds through the same Scheduler as a local run, so weights
+// and -adaptive behave the same, and stores the workers' bug bundles under
+// its own bug/<ts>/<worker>/, keeping one bundle per bucket and case.
+type Coordinator struct {
+	mu           sync.Mutex
+	campaign     *Campaign
+	scheduler    *Scheduler
+	name         string
+	count        int
+	token        string
+	leaseTimeout time.Duration
+	nextLease    int64
+	leases       map[int64]*lease
+	orphans      []Assignment    // cases of expired leases, handed out again first
+	base         CampaignSummary // counters of the sessions before -resume
+	runs         map[workerRun]CampaignSummary
+	bundles      map[string]bool
+	bugDir       string
+}
+
+func NewCoordinator(targets []TargetSpec, campaign *Campaign, count int, token string, leaseTimeout time.Duration) *Coordinator {
+	scheduler := NewScheduler(targets, diffSimEnabled, campaign.ID)
+	return &Coordinator{
+		campaign:     campaign,
+		scheduler:    scheduler,
+		name:         formatTargets(targets),
+		count:        count,
+		token:        token,
+		leaseTimeout: leaseTimeout,
+		leases:       map[int64]*lease{},
+		base:         campaign.Summary(""),
+		runs:         map[workerRun]CampaignSummary{},
+		bundles:      map[string]bool{},
+		bugDir:       scheduler.targets[0].fuzzer.CrashDir,
+	}
+}
+
+// RunCoordinator serves workers on addr until the campaign stops and every
+// outstanding lease has come back or expired.
+func RunCoordinator(addr string, targets []TargetSpec, count int, campaign *Campaign, adaptive bool, rebalance time.Duration, token string, leaseTimeout time.Duration) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		PrettyErr("coordinator", err.Error())
+		os.Exit(1)
+	}
+	if ip := net.ParseIP(host); token == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		PrettyErr("coordinator", "-token is required when listening on "+addr)
+		os.Exit(1)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		PrettyErr("coordinator", err.Error())
+		os.Exit(1)
+	}
+	c := NewCoordinator(targets, campaign, count, token, leaseTimeout)
+	PrettyRunHeader("coordinator "+c.name, count, c.scheduler.workers)
+	PrettyInfo("coordinator", "listening on http://"+addr)
+	if adaptive {
+		c.scheduler.startRebalancer(campaign, rebalance)
+	}
+	server := &http.Server{Handler: c.handler()}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	for range ticker.C {
+		c.mu.Lock()
+		c.expire(time.Now())
+		done := campaign.Stopping() && len(c.leases) == 0
+		c.mu.Unlock()
+		if done {
+			break
+		}
+	}
+	ticker.Stop()
+	// let idle workers see that the campaign is over
+	time.Sleep(2 * workerPollInterval)
+	_ = server.Close()
+	campaign.finish(c.name, c.scheduler.Fuzzers()...)
+}
+
+func (c *Coordinator) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lease", c.handleLease)
+	mux.HandleFunc("/complete", c.handleComplete)
+	mux.HandleFunc("/bundle", c.handleBundle)
+	mux.HandleFunc("/status", c.handleStatus)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.token != "" && r.Header.Get("Authorization") != "Bearer "+c.token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (c *Coordinator) handleLease(w http.ResponseWriter, r *http.Request) {
+	var req LeaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Worker == "" {
+		http.Error(w, "bad lease request", http.StatusBadRequest)
+		return
+	}
+	l := c.lease(req)
+	if l == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, l)
+}
+
+// lease hands out up to req.Slots cases. It returns nil once the campaign
+// is over.
+func (c *Coordinator) lease(req LeaseRequest) *Lease {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(time.Now())
+	if c.campaign.Stopping() && len(c.leases) == 0 {
+		return nil
+	}
+	slots := max(req.Slots, 1)
+	var cases []Assignment
+	for len(cases) < slots && len(c.orphans) > 0 {
+		cases = append(cases, c.orphans[0])
+		c.orphans = c.orphans[1:]
+	}
+	for len(cases) < slots && c.campaign.Next() {
+		t := c.scheduler.acquire()
+		cases = append(cases, Assignment{Fuzzer: t.name, Seed: c.campaign.NextSeed(), Backends: t.fuzzer.Backends})
+	}
+	// the budget ran out just now
+	if len(cases) == 0 && c.campaign.Stopping() && len(c.leases) == 0 {
+		return nil
+	}
+	l := &Lease{Count: c.count, DiffSim: diffSimEnabled, Reference: referenceEnabled, Waveform: waveformEnabled, Frontends: activeFrontends(), GenOptions: generatorOptions, Cases: cases}
+	if len(cases) > 0 {
+		c.nextLease++
+		l.ID = c.nextLease
+		c.leases[l.ID] = &lease{worker: req.Worker, cases: cases, expires: time.Now().Add(c.leaseTimeout)}
+	}
+	return l
+}
+
+// expire reclaims the cases of workers that did not report back in time.
+// They keep their scheduler slot until someone completes them.
+func (c *Coordinator) expire(now time.Time) {
+	for id, l := range c.leases {
+		if now.Before(l.expires) {
+			continue
+		}
+		delete(c.leases, id)
+		PrettyWarn("coordinator", fmt.Sprintf("lease %d of %s expired", id, l.worker))
+		if c.campaign.Stopping() {
+			c.releaseCases(l.cases)
+			continue
+		}
+		c.orphans = append(c.orphans, l.cases...)
+	}
+}
+
+func (c *Coordinator) releaseCases(cases []Assignment) {
+	for _, a := range cases {
+		if t := c.scheduler.target(a.Fuzzer); t != nil {
+			c.scheduler.release(t, 0, false)
+		}
+	}
+}
+
+func (c *Coordinator) handleComplete(w http.ResponseWriter, r *http.Request) {
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Worker == "" {
+		http.Error(w, "bad completion", http.StatusBadRequest)
+		return
+	}
+	c.complete(req)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Coordinator) complete(req CompleteRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := workerRun{req.Worker, req.Run}
+	// completions of one run may arrive out of order
+	if prev, ok := c.runs[key]; !ok || req.Summary.Elapsed >= prev.Elapsed {
+		c.runs[key] = req.Summary
+		c.sumWorkers()
+	}
+	if _, ok := c.leases[req.Lease]; !ok {
+		// expired and handed out again; the counters above still count
+		return
+	}
+	delete(c.leases, req.Lease)
+	for _, res := range req.Results {
+		t := c.scheduler.target(res.Fuzzer)
+		if t == nil {
+			continue
+		}
+		c.scheduler.release(t, time.Duration(res.Seconds*float64(time.Second)), res.Found)
+		c.campaign.Done(res.Seed)
+		if res.Found {
+			emitEvent(Event{Type: EventMismatch, Fuzzer: res.Fuzzer, Seed: res.Seed, Detail: "worker " + req.Worker})
+		}
+	}
+}
+
+// sumWorkers sets the campaign counters to those the checkpoint started
+// from plus the latest counters of every worker run, so a restarted worker
+// adds to its earlier runs instead of replacing them.
+func (c *Coordinator) sumWorkers() {
+	total := CampaignSummary{}
+	total.add(c.base)
+	for _, s := range c.runs {
+		total.add(s)
+	}
+	atomic.StoreInt64(&countCases, total.Cases)
+	atomic.StoreInt64(&countIverilog, total.Iverilog)
+	atomic.StoreInt64(&countVerilator, total.Verilator)
+	atomic.StoreInt64(&countYosysOpt, total.YosysOpt)
+	atomic.StoreInt64(&countCXXRTL, total.CXXRTL)
+	atomic.StoreInt64(&countBugs, total.Bugs)
+	atomic.StoreInt64(&countCrashes, total.Crashes)
+	atomic.StoreInt64(&countHangs, total.Hangs)
+	atomic.StoreInt64(&countResource, total.Resource)
+	atomic.StoreInt64(&countRejections, total.Rejections)
+	atomic.StoreInt64(&countSuppressed, total.Suppressed)
+	setSuspectCounts(total.Suspects)
+	setBucketCounts(total.Buckets)
+	saveBucketIndex(c.bugDir)
+}
+
+// add adds the counters of o to s.
+func (s *CampaignSummary) add(o CampaignSummary) {
+	if s.Suspects == nil {
+		s.Suspects = map[string]int64{}
+	}
+	if s.Buckets == nil {
+		s.Buckets = map[string]int64{}
+	}
+	for tool, n := range o.Suspects {
+		s.Suspects[tool] += n
+	}
+	for bucket, n := range o.Buckets {
+		s.Buckets[bucket] += n
+	}
+	s.Cases += o.Cases
+	s.Iverilog += o.Iverilog
+	s.Verilator += o.Verilator
+	s.YosysOpt += o.YosysOpt
+	s.CXXRTL += o.CXXRTL
+	s.Bugs += o.Bugs
+	s.Crashes += o.Crashes
+	s.Hangs += o.Hangs
+	s.Resource += o.Resource
+	s.Rejections += o.Rejections
+	s.Suppressed += o.Suppressed
+}
+
+// handleBundle stores one bug directory, sent as a tar.gz, under
+// bug/<ts>/<worker>/<path>. A bundle of a case already stored in the same
+// bucket (e.g. by the first holder of an expired lease) is dropped.
+func (c *Coordinator) handleBundle(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	worker, rel := q.Get("worker"), filepath.FromSlash(q.Get("path"))
+	if worker == "" || filepath.Base(worker) != worker || !filepath.IsLocal(worker) || !filepath.IsLocal(rel) {
+		http.Error(w, "bad bundle path", http.StatusBadRequest)
+		return
+	}
+	key := filepath.Dir(rel) + "|" + q.Get("fuzzer") + "|" + q.Get("seed")
+	c.mu.Lock()
+	dup := c.bundles[key]
+	c.bundles[key] = true
+	c.mu.Unlock()
+	if dup {
+		writeJSON(w, map[string]bool{"stored": false})
+		return
+	}
+
+	// rel is <bucket>/<case>; the first bundles of a bucket over all
+	// workers are kept
+	bucket, name := filepath.ToSlash(filepath.Dir(rel)), worker+"/"+filepath.Base(rel)
+	if !reserveBundle(c.bugDir, bucket, name) {
+		writeJSON(w, map[string]bool{"stored": false})
+		return
+	}
+	dst := filepath.Join(c.bugDir, worker, rel)
+	if err := extractBundle(http.MaxBytesReader(w, r.Body, maxBundleBytes), dst); err != nil {
+		c.mu.Lock()
+		delete(c.bundles, key)
+		c.mu.Unlock()
+		storedBundle(c.bugDir, bucket, name, dst, false)
+		_ = os.RemoveAll(dst)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	storedBundle(c.bugDir, bucket, name, dst, true)
+	PrettyBug("coordinator", "bundle from "+worker, rel)
+	writeJSON(w, map[string]bool{"stored": true})
+}
+
+func (c *Coordinator) handleStatus(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	status := CoordinatorStatus{
+		Summary: c.campaign.Summary(c.name),
+		Leases:  len(c.leases),
+		Workers: map[string]CampaignSummary{},
+	}
+	for key, s := range c.runs {
+		w := status.Workers[key.worker]
+		w.add(s)
+		status.Workers[key.worker] = w
+	}
+	c.mu.Unlock()
+	writeJSON(w, status)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeBundle writes the regular files under dir as a tar.gz.
+func writeBundle(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// extractBundle unpacks a writeBundle archive into dst, refusing entries
+// that would land outside it.
+func extractBundle(r io.Reader, dst string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || !filepath.IsLocal(name) {
+			return fmt.Errorf("bundle: bad entry %q", hdr.Name)
+		}
+		path := filepath.Join(dst, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		// keeps repro.sh executable
+		mode := os.FileMode(0644)
+		if hdr.Mode&0o111 != 0 {
+			mode = 0755
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
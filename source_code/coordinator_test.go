@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoordinatorCounters(t *testing.T) {
+	// a coordinator resumed from a checkpoint with 100 cases
+	atomic.StoreInt64(&countCases, 100)
+	atomic.StoreInt64(&countBugs, 3)
+	setBucketCounts(map[string]int64{"mismatch/verilator_aaaa": 3})
+	c := &Coordinator{
+		campaign: NewCampaign(0, 0, 1),
+		leases:   map[int64]*lease{},
+		runs:     map[workerRun]CampaignSummary{},
+		bugDir:   t.TempDir(),
+	}
+	c.base = c.campaign.Summary("")
+
+	steps := []struct {
+		name  string
+		req   CompleteRequest
+		cases int64
+		bugs  int64
+	}{
+		{"first worker", CompleteRequest{Worker: "a", Run: 1, Summary: CampaignSummary{Elapsed: 1, Cases: 10, Bugs: 1}}, 110, 4},
+		{"second worker", CompleteRequest{Worker: "b", Run: 1, Summary: CampaignSummary{Elapsed: 1, Cases: 5}}, 115, 4},
+		{"first worker again", CompleteRequest{Worker: "a", Run: 1, Summary: CampaignSummary{Elapsed: 2, Cases: 12, Bugs: 1}}, 117, 4},
+		{"late completion", CompleteRequest{Worker: "a", Run: 1, Summary: CampaignSummary{Elapsed: 1.5, Cases: 11, Bugs: 1}}, 117, 4},
+		{"first worker restarted", CompleteRequest{Worker: "a", Run: 2, Summary: CampaignSummary{Elapsed: 1, Cases: 1, Bugs: 1}}, 118, 5},
+	}
+	for _, s := range steps {
+		c.complete(s.req)
+		if cases, bugs := atomic.LoadInt64(&countCases), atomic.LoadInt64(&countBugs); cases != s.cases || bugs != s.bugs {
+			t.Errorf("%s: %d cases, %d bugs; want %d, %d", s.name, cases, bugs, s.cases, s.bugs)
+		}
+	}
+	if n := bucketCounts()["mismatch/verilator_aaaa"]; n != 3 {
+		t.Errorf("bucket of the checkpoint counts %d, want 3", n)
+	}
+}
+
+// stubSim prints one output record; stub-c prints a different value than
+// the others and is outvoted.
+type stubSim struct {
+	name string
+	job  SimJob
+}
+
+func (s *stubSim) Name() string             { return s.name }
+func (s *stubSim) Compile(job SimJob) error { s.job = job; return nil }
+func (s *stubSim) Run(input string) error   { return nil }
+func (s *stubSim) Waveform() string         { return "" }
+func (s *stubSim) Output() ([]byte, error) {
+	value := 1
+	if s.name == "stub-c" {
+		value = 2
+	}
+	return []byte(fmt.Sprintf("cycle=0 signal=out0 width=8 signed=0 value=%d\n", value)), nil
+}
+
+// withCampaignDirs runs the test in a temporary directory, so the log/,
+// tmp/ and bug/ trees of its campaigns do not land in the source tree, and
+// with the runtime flags and counters reset.
+func withCampaignDirs(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	reference, waveform, frontend := referenceEnabled, waveformEnabled, frontendCheckEnabled
+	referenceEnabled, waveformEnabled, frontendCheckEnabled = false, false, false
+	t.Cleanup(func() {
+		referenceEnabled, waveformEnabled, frontendCheckEnabled = reference, waveform, frontend
+		_ = os.Chdir(wd)
+	})
+	for _, name := range []string{"stub-a", "stub-b", "stub-c"} {
+		name := name
+		simulators[name] = func() Simulator { return &stubSim{name: name} }
+		t.Cleanup(func() { delete(simulators, name) })
+	}
+	for _, counter := range []*int64{&countCases, &countBugs, &countCrashes, &countHangs, &countResource, &countRejections, &countSuppressed} {
+		atomic.StoreInt64(counter, 0)
+	}
+	setSuspectCounts(nil)
+	setBucketCounts(nil)
+}
+
+func TestCoordinatorWithWorker(t *testing.T) {
+	withCampaignDirs(t)
+	backends := backendsOverride
+	backendsOverride = []string{"stub-a", "stub-b", "stub-c"}
+	defer func() { backendsOverride = backends }()
+
+	campaign := NewCampaign(0, 3, 1)
+	c := NewCoordinator([]TargetSpec{{Name: "fuzz", Threads: 1}}, campaign, 1, "secret", 100*time.Millisecond)
+	server := httptest.NewServer(c.handler())
+	defer server.Close()
+
+	client := func(name, token string) *Worker {
+		return &Worker{name: name, url: server.URL, token: token, client: server.Client(),
+			fuzzers: map[string]*Fuzzer{}, uploaded: map[string]bool{}}
+	}
+	if _, err := client("intruder", "wrong").lease(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("lease with a wrong token: %v", err)
+	}
+
+	// a worker that takes a case and vanishes; it goes to the next one
+	ghost, err := client("ghost", "secret").lease()
+	if err != nil || len(ghost.Cases) != 1 {
+		t.Fatalf("ghost lease: %+v, %v", ghost, err)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	w := client("w1", "secret")
+	w.campaign = NewCampaign(0, 0, 0)
+	w.campaign.ID = campaign.ID + 1
+	w.loop()
+	if !w.campaign.Stopping() {
+		t.Error("the worker did not stop at the end of the campaign")
+	}
+	if l, err := client("late", "secret").lease(); err != nil || l != nil {
+		t.Errorf("lease after the campaign: %+v, %v; want 204", l, err)
+	}
+
+	var status CoordinatorStatus
+	if err := w.post("/status", nil, &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Leases != 0 || status.Summary.Cases != 3 || status.Workers["w1"].Cases != 3 || status.Summary.Bugs != 3 {
+		t.Errorf("status %+v, want 3 cases and bugs of w1 and no leases", status)
+	}
+	if n := status.Summary.Suspects["stub-c"]; n != 3 {
+		t.Errorf("stub-c suspected %d times, want 3", n)
+	}
+
+	// every case of the campaign, the ghost's too, came back as a bundle
+	bundles, _ := filepath.Glob(filepath.Join(c.bugDir, "w1", "mismatch", "*", "*", caseFileName))
+	seeds := map[int64]bool{}
+	for _, path := range bundles {
+		tc, err := LoadTestCase(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seeds[tc.Seed] = true
+		if _, err := os.Stat(filepath.Join(filepath.Dir(path), "test.v")); err != nil {
+			t.Errorf("bundle without test.v: %v", err)
+		}
+	}
+	if len(seeds) != 3 || !seeds[ghost.Cases[0].Seed] {
+		t.Errorf("bundles of seeds %v, want 3 including the ghost's %d", seeds, ghost.Cases[0].Seed)
+	}
+}
+
+func TestCoordinatorBundlePaths(t *testing.T) {
+	withCampaignDirs(t)
+	c := NewCoordinator([]TargetSpec{{Name: "fuzz", Threads: 1}}, NewCampaign(0, 1, 1), 1, "", time.Minute)
+	server := httptest.NewServer(c.handler())
+	defer server.Close()
+
+	bundle := func(entry string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		_ = tw.WriteHeader(&tar.Header{Name: entry, Mode: 0o644, Size: 4, Typeflag: tar.TypeReg})
+		_, _ = tw.Write([]byte("data"))
+		_ = tw.Close()
+		_ = gz.Close()
+		return &buf
+	}
+	tests := []struct {
+		name, worker, path, entry string
+		status                    int
+	}{
+		{"stored", "w1", "mismatch/stub_0/bug_1", "test.v", http.StatusOK},
+		{"path escapes the bug directory", "w1", "../../escape/bug_2", "test.v", http.StatusBadRequest},
+		{"absolute path", "w1", "/tmp/escape/bug_3", "test.v", http.StatusBadRequest},
+		{"worker escapes", "..", "mismatch/stub_0/bug_4", "test.v", http.StatusBadRequest},
+		{"entry escapes the case", "w1", "mismatch/stub_0/bug_5", "../../../escape.v", http.StatusBadRequest},
+	}
+	for i, tt := range tests {
+		q := url.Values{"worker": {tt.worker}, "path": {tt.path}, "fuzzer": {"fuzz"}, "seed": {fmt.Sprint(i)}}
+		resp, err := http.Post(server.URL+"/bundle?"+q.Encode(), "application/gzip", bundle(tt.entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c.bugDir, "w1", "mismatch", "stub_0", "bug_1", "test.v")); err != nil {
+		t.Errorf("stored bundle: %v", err)
+	}
+	// the test runs in a temporary directory holding the whole bug tree
+	var left []string
+	_ = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err == nil && (strings.Contains(path, "escape") || strings.Contains(path, "bug_5")) {
+			left = append(left, path)
+		}
+		return nil
+	})
+	if len(left) > 0 {
+		t.Errorf("rejected bundles left files: %v", left)
+	}
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"fmt"
-	"os"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
@@ -11,32 +9,117 @@ var countIverilog int64 = 0
 var countVerilator int64 = 0
 var countYosysOpt int64 = 0
 var countCXXRTL int64 = 0
+var countCases int64 = 0
+var countBugs int64 = 0
+var countCrashes int64 = 0
+var countHangs int64 = 0
+var countResource int64 = 0
 
-var outputFile = "task_counter.txt"
+// countSuppressed counts cases a false-positive rule kept from being reported.
+var countSuppressed int64 = 0
 
-func StartCounterLogger(outputFile string) {
-	startTimestamp := time.Now().Unix() // 起始时间戳（秒）
+// countRejections counts designs one frontend rejected and another accepted.
+var countRejections int64 = 0
 
-	go func() {
-		for {
-			time.Sleep(30 * time.Second)
+// countSuspects counts reported mismatches by the tool the vote blamed.
+var suspectMu sync.Mutex
+var countSuspects = map[string]int64{}
+
+func addSuspect(tool string) {
+	if tool == "" {
+		return
+	}
+	suspectMu.Lock()
+	countSuspects[tool]++
+	suspectMu.Unlock()
+}
+
+func suspectCounts() map[string]int64 {
+	suspectMu.Lock()
+	defer suspectMu.Unlock()
+	if len(countSuspects) == 0 {
+		return nil
+	}
+	counts := make(map[string]int64, len(countSuspects))
+	for tool, n := range countSuspects {
+		counts[tool] = n
+	}
+	return counts
+}
+
+func setSuspectCounts(counts map[string]int64) {
+	suspectMu.Lock()
+	defer suspectMu.Unlock()
+	countSuspects = map[string]int64{}
+	for tool, n := range counts {
+		countSuspects[tool] = n
+	}
+}
+
+// countBuckets counts saved bugs, crashes and hangs by signature bucket.
+var bucketMu sync.Mutex
+var countBuckets = map[string]int64{}
 
-			currentTime := time.Now().Format("2006-01-02 15:04:05")
-			currentTimestamp := time.Now().Unix()
-			elapsed := currentTimestamp - startTimestamp
+func addBucket(bucket string) {
+	bucketMu.Lock()
+	countBuckets[bucket]++
+	bucketMu.Unlock()
+}
 
-			iverilog := atomic.LoadInt64(&countIverilog)
-			verilator := atomic.LoadInt64(&countVerilator)
-			yosys := atomic.LoadInt64(&countYosysOpt)
-			cxxrtl := atomic.LoadInt64(&countCXXRTL)
+func bucketCounts() map[string]int64 {
+	bucketMu.Lock()
+	defer bucketMu.Unlock()
+	if len(countBuckets) == 0 {
+		return nil
+	}
+	counts := make(map[string]int64, len(countBuckets))
+	for bucket, n := range countBuckets {
+		counts[bucket] = n
+	}
+	return counts
+}
 
-			line := fmt.Sprintf("[%s] Icarus=%d Verilator=%d YosysOpt=%d CXXRTL=%d Elapsed=%ds\n",
-				currentTime, iverilog, verilator, yosys, cxxrtl, elapsed)
+func setBucketCounts(counts map[string]int64) {
+	bucketMu.Lock()
+	defer bucketMu.Unlock()
+	countBuckets = map[string]int64{}
+	for bucket, n := range counts {
+		countBuckets[bucket] = n
+	}
+}
 
-			f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-			if err == nil {
-				defer f.Close()
-				f.WriteString(line)
+// checkpointRequests holds a pending request for an early checkpoint.
+var checkpointRequests = make(chan struct{}, 1)
+
+// requestCheckpoint has the counter logger refresh the checkpoint now rather
+// than on its next tick, so a run killed in between does not file the same
+// bugs again after -resume.
+func requestCheckpoint() {
+	select {
+	case checkpointRequests <- struct{}{}:
+	default:
+	}
+}
+
+// StartCounterLogger emits a progress event with the campaign counters and
+// refreshes the checkpoint every interval, and whenever a case is filed,
+// until the campaign stops.
+func StartCounterLogger(campaign *Campaign, name string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-campaign.Context().Done():
+				return
+			case <-ticker.C:
+				summary := campaign.Summary(name)
+				emitEvent(Event{Type: EventProgress, Fuzzer: name, Summary: &summary})
+				metrics.sampleTmpDir()
+			case <-checkpointRequests:
+			}
+			if err := writeCheckpoint(campaign.LogDir(), campaign.Checkpoint(name)); err != nil {
+				PrettyErr("checkpoint", err.Error())
 			}
 		}
 	}()
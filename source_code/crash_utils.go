@@ -1,12 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -55,16 +57,36 @@ func processCrash(logFile string, stderr string) {
 	appendToLogFile(logFile, stderr)
 }
 
-func handleFailure(crashDir, realSubDir, logFile string, stderr string) {
+// handleFailure files the case of job, whose directory is removed, as a
+// crash of tool that ended after duration.
+func handleFailure(crashDir string, job SimJob, tool string, duration time.Duration, logFile string, stderr string) {
+	realSubDir := job.Dir
+	if activeCampaign.Interrupted() {
+		_ = os.RemoveAll(realSubDir)
+		return
+	}
+	fpCase := FPCase{Kind: "crash", Tool: tool, Dir: realSubDir, Report: stderr}
+	if rule := matchFPRule(fpCase); rule != nil {
+		suppressCase(crashDir, rule, fpCase, job.Fuzzer, job.Seed)
+		_ = os.RemoveAll(realSubDir)
+		return
+	}
+	atomic.AddInt64(&countCrashes, 1)
+	emitEvent(Event{Type: EventCrash, Fuzzer: job.Fuzzer, Seed: job.Seed, Tool: tool,
+		Duration: duration.Seconds(), Detail: stderr})
 	if logFile != "" {
 		processCrash(logFile, stderr)
 	}
+	sig := Signature{Kind: "crash", Tool: tool}
+	sig.Message, sig.Frames = messageSignature(stderr)
 	curTimeStr := strconv.FormatInt(time.Now().UnixMilli(), 10)
-	crashSubdir := filepath.Join(crashDir, "bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
-	if err := copyCrashArtifacts(realSubDir, crashSubdir); err != nil {
-		fmt.Printf("%v\n", err)
+	crashSubdir := fileCase(crashDir, sig, "bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
+	if crashSubdir != "" {
+		if err := copyCrashArtifacts(realSubDir, crashSubdir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
 	}
-	PrettyBug("runtime", "bug detected")
+	PrettyBug("runtime", "bug detected", fmt.Sprintf("seed: %d", job.Seed), "bucket: "+sig.Bucket())
 
 	// 删除测试目录
 	if err := os.RemoveAll(realSubDir); err != nil {
@@ -72,6 +94,93 @@ func handleFailure(crashDir, realSubDir, logFile string, stderr string) {
 	}
 }
 
+const failureFileName = "failure.json"
+
+// FailureRecord is saved as failure.json with every tool crash or hang.
+type FailureRecord struct {
+	Category string  `json:"category"`
+	Tool     string  `json:"tool"`
+	Phase    string  `json:"phase"`
+	Signal   string  `json:"signal,omitempty"`
+	ExitCode int     `json:"exit_code"`
+	Timeout  float64 `json:"timeout_seconds,omitempty"`
+	Error    string  `json:"error"`
+}
+
+// handleToolFailure is handleFailure for a ToolError. Hangs and resource
+// exhaustion are counted separately; every failure is filed under the
+// bucket of its signature in crashDir.
+func handleToolFailure(crashDir, realSubDir string, toolErr *ToolError) {
+	if activeCampaign.Interrupted() {
+		_ = os.RemoveAll(realSubDir)
+		return
+	}
+	record := FailureRecord{
+		Category: toolErr.Category(),
+		Tool:     toolErr.Tool,
+		Phase:    toolErr.Phase,
+		ExitCode: toolErr.ExitCode,
+		Error:    toolErr.Error(),
+	}
+	if toolErr.Signal != 0 {
+		record.Signal = signalName(toolErr.Signal)
+	}
+	fpCase := FPCase{Kind: record.Category, Tool: toolErr.Tool, Dir: realSubDir, Report: toolErr.Stderr}
+	if data, err := os.ReadFile(toolErr.Log); err == nil {
+		fpCase.Report += "\n" + string(data)
+	}
+	if rule := matchFPRule(fpCase); rule != nil {
+		suppressCase(crashDir, rule, fpCase, toolErr.Fuzzer, toolErr.Seed)
+		_ = os.RemoveAll(realSubDir)
+		return
+	}
+	switch record.Category {
+	case "hang":
+		record.Timeout = toolErr.Timeout.Seconds()
+		atomic.AddInt64(&countHangs, 1)
+	case "resource":
+		atomic.AddInt64(&countResource, 1)
+	default:
+		atomic.AddInt64(&countCrashes, 1)
+		processCrash(toolErr.Log, toolErr.Stderr)
+	}
+
+	sig := crashSignature(toolErr)
+	curTimeStr := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	crashSubdir := fileCase(crashDir, sig, "bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
+	if crashSubdir != "" {
+		// written first, so that the issue bodies can quote it
+		if data, err := json.MarshalIndent(record, "", "  "); err == nil {
+			_ = os.WriteFile(filepath.Join(realSubDir, failureFileName), data, 0o644)
+		}
+		if err := copyCrashArtifacts(realSubDir, crashSubdir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		_ = copyFile(toolErr.Log, filepath.Join(crashSubdir, filepath.Base(toolErr.Log)))
+	}
+	emitEvent(Event{
+		Type:   record.Category,
+		Fuzzer: toolErr.Fuzzer,
+		Seed:   toolErr.Seed,
+		Tool:   toolErr.Tool,
+		Phase:  toolErr.Phase,
+		Detail: record.Error,
+	})
+	PrettyBug(record.Category, record.Error, "bucket: "+sig.Bucket())
+
+	if err := os.RemoveAll(realSubDir); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+}
+
+// pairDiffPattern matches the diff reports of one pair of simulators or
+// variants, such as diff_iverilog_vs_verilator.txt or diff_0_vs_2.txt.
+const pairDiffPattern = "diff_*.txt"
+
+// copyCrashArtifacts copies the files of a case into its bug directory:
+// the design, testbenches and input, what the checks found, and the tool
+// logs with their paths in the case. It then writes the bug report, see
+// writeBugReport.
 func copyCrashArtifacts(srcDir, dstDir string) error {
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return err
@@ -83,10 +192,24 @@ func copyCrashArtifacts(srcDir, dstDir string) error {
 		"tb.v":        true,
 		"tb_diff.v":   true,
 		"main.cpp":    true,
+		"main_eq.cpp": true,
+		"case.json":   true,
+		"diff.txt":    true,
+
+		signatureFileName:    true,
+		referenceFileName:    true,
+		"reference_diff.txt": true,
+		voteFileName:         true,
+		rejectionFileName:    true,
+		equivDiffFileName:    true,
+		signalsFileName:      true,
+		rewritesFileName:     true,
+		failureFileName:      true,
+		commandLogFileName:   true,
 	}
 	seen := map[string]bool{}
 
-	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -94,7 +217,18 @@ func copyCrashArtifacts(srcDir, dstDir string) error {
 			return nil
 		}
 		base := filepath.Base(path)
-		if !allowed[base] {
+		if filepath.Ext(base) == ".log" {
+			rel, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+			dstPath := filepath.Join(dstDir, rel)
+			if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+				return err
+			}
+			return copyFile(path, dstPath)
+		}
+		if pairDiff, _ := filepath.Match(pairDiffPattern, base); !allowed[base] && !pairDiff {
 			return nil
 		}
 		if seen[base] {
@@ -107,6 +241,10 @@ func copyCrashArtifacts(srcDir, dstDir string) error {
 		seen[base] = true
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	return writeBugReport(dstDir)
 }
 
 // 将 ASan/UBSan 错误输出追加到日志文件末尾
@@ -166,13 +304,32 @@ func checkSanitizerErrorFromStderr(stderr string) bool {
 	return false
 }
 
-func saveCrashArtifacts(f *Fuzzer, logFileName, tmpFileName, reason string) {
-	_ = logFileName
-	_ = reason
+// saveCrashArtifacts files a failed run of tool on tmpFileName under the
+// bucket of its sanitizer report or error message, else of reason.
+func saveCrashArtifacts(f *Fuzzer, tool, logFileName, tmpFileName, reason string) {
+	fpCase := FPCase{Kind: "crash", Tool: tool, Dir: filepath.Dir(tmpFileName), Report: reason}
+	data, err := os.ReadFile(logFileName)
+	if err == nil {
+		fpCase.Report += "\n" + string(data)
+	}
+	if rule := matchFPRule(fpCase); rule != nil {
+		suppressCase(f.CrashDir, rule, fpCase, tool, 0)
+		return
+	}
+	atomic.AddInt64(&countCrashes, 1)
+	sig := Signature{Kind: "crash", Tool: tool}
+	if err == nil {
+		sig.Message, sig.Frames = messageSignature(string(data))
+	}
+	if sig.Message == "" && len(sig.Frames) == 0 {
+		sig.Message = reason
+	}
 	curTimeStr := strconv.FormatInt(time.Now().UnixMilli(), 10)
-	crashSubdir := filepath.Join(f.CrashDir, "bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
-	if err := copyCrashArtifacts(filepath.Dir(tmpFileName), crashSubdir); err != nil {
-		fmt.Printf("拷贝崩溃文件时出错: %v\n", err)
+	crashSubdir := fileCase(f.CrashDir, sig, "bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
+	if crashSubdir != "" {
+		if err := copyCrashArtifacts(filepath.Dir(tmpFileName), crashSubdir); err != nil {
+			fmt.Printf("拷贝崩溃文件时出错: %v\n", err)
+		}
 	}
-	PrettyBug("runtime", "bug detected")
+	PrettyBug("runtime", "bug detected", "bucket: "+sig.Bucket())
 }
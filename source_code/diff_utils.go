@@ -36,10 +36,6 @@ func diffLinesWithLabels(leftLabel string, leftData []byte, rightLabel string, r
 	return sb.String()
 }
 
-func diffLines(verilatorData, iverilogData []byte) string {
-	return diffLinesWithLabels("Verilator", verilatorData, "Icarus", iverilogData)
-}
-
 func generateEq0Tb(generator *CodeGenerator.ExpressionGenerator) string {
 	originalName := generator.Name
 	generator.Name = fmt.Sprintf("%s_eq0", originalName)
@@ -47,3 +43,12 @@ func generateEq0Tb(generator *CodeGenerator.ExpressionGenerator) string {
 	generator.Name = originalName
 	return tbData
 }
+
+// generateEq0CXXTb is the CXXRTL counterpart of generateEq0Tb.
+func generateEq0CXXTb(generator *CodeGenerator.ExpressionGenerator) string {
+	originalName := generator.Name
+	generator.Name = fmt.Sprintf("%s__eq0", originalName)
+	tbData := generator.GenerateCXXRTLTestBench()
+	generator.Name = originalName
+	return tbData
+}
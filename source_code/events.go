@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const eventsFileName = "events.jsonl"
+
+const (
+	EventCaseStart  = "case_start"
+	EventPhase      = "phase"
+	EventMismatch   = "mismatch"
+	EventCrash      = "crash"
+	EventHang       = "hang"
+	EventResource   = "resource"
+	EventSuppressed = "suppressed"
+	EventRejection  = "rejection"
+	EventCleanup    = "cleanup"
+	EventProgress   = "progress"
+	EventSummary    = "summary"
+	EventAllocation = "allocation"
+)
+
+// Event is one line of log/<ts>/events.jsonl. Phase events time a single
+// tool invocation, cleanup events the whole case; progress and summary
+// events carry the campaign counters.
+type Event struct {
+	Time     time.Time        `json:"time"`
+	Type     string           `json:"type"`
+	Fuzzer   string           `json:"fuzzer,omitempty"`
+	Seed     int64            `json:"seed,omitempty"`
+	Tool     string           `json:"tool,omitempty"`
+	Phase    string           `json:"phase,omitempty"`
+	Duration float64          `json:"duration_seconds,omitempty"`
+	Detail   string           `json:"detail,omitempty"`
+	Summary  *CampaignSummary `json:"summary,omitempty"`
+}
+
+type EventLog struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+var eventLog *EventLog
+
+func OpenEventLog(dir string) (*EventLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, eventsFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLog{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (l *EventLog) Emit(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+	_ = l.enc.Encode(e)
+}
+
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func emitEvent(e Event) {
+	eventLog.Emit(e)
+	metrics.Observe(e)
+}
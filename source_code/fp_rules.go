@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fpRulesPath is the false-positive rules file, set by -fp-rules. It is
+// read again whenever it changes, so rules can be added during a campaign.
+var fpRulesPath = "fp_rules.json"
+
+// FPRule describes a known false positive. Every field that is set must
+// match: Kind is mismatch, crash, hang or resource; Tool the suspected or
+// failing tool, or for an undecided mismatch one of the tools compared;
+// Version a regexp over the first line of Tool's version output; Construct
+// one of fpConstructs; Program a regexp over test.v and Diff one over the
+// diff reports or the tool's error output.
+type FPRule struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Kind        string `json:"kind,omitempty"`
+	Tool        string `json:"tool,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Construct   string `json:"construct,omitempty"`
+	Program     string `json:"program,omitempty"`
+	Diff        string `json:"diff,omitempty"`
+
+	version, program, diff *regexp.Regexp
+}
+
+type FPRules struct {
+	Rules []*FPRule `json:"rules"`
+}
+
+func (r *FPRule) compile() error {
+	if r.Name == "" || filepath.Base(r.Name) != r.Name {
+		return fmt.Errorf("rule %q: name must be a plain file name", r.Name)
+	}
+	if _, ok := fpConstructs[r.Construct]; r.Construct != "" && !ok {
+		return fmt.Errorf("rule %s: unknown construct %q", r.Name, r.Construct)
+	}
+	var err error
+	for _, re := range []struct {
+		expr string
+		dst  **regexp.Regexp
+	}{{r.Version, &r.version}, {r.Program, &r.program}, {r.Diff, &r.diff}} {
+		if re.expr == "" {
+			continue
+		}
+		if *re.dst, err = regexp.Compile(re.expr); err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// FPCase is what a rule is matched against. Dir holds test.v and the diff
+// reports; Report is added to the latter, e.g. a tool's stderr.
+type FPCase struct {
+	Kind   string
+	Tool   string
+	Tools  []string
+	Dir    string
+	Report string
+}
+
+func (c FPCase) program() string {
+	data, _ := os.ReadFile(filepath.Join(c.Dir, "test.v"))
+	return string(data)
+}
+
+// reports returns Report and the diff and vote reports in Dir.
+func (c FPCase) reports() string {
+	text := c.Report
+	for _, pattern := range []string{"*diff*.txt", voteFileName} {
+		files, _ := filepath.Glob(filepath.Join(c.Dir, pattern))
+		for _, file := range files {
+			if data, err := os.ReadFile(file); err == nil {
+				text += "\n" + string(data)
+			}
+		}
+	}
+	return text
+}
+
+func (r *FPRule) matches(c FPCase) bool {
+	if r.Kind != "" && r.Kind != c.Kind {
+		return false
+	}
+	if r.Tool != "" && r.Tool != c.Tool && (c.Tool != "" || !containsString(c.Tools, r.Tool)) {
+		return false
+	}
+	if r.version != nil && !r.version.MatchString(toolVersion(r.Tool)) {
+		return false
+	}
+	if r.Construct != "" || r.program != nil {
+		program := c.program()
+		if r.Construct != "" && !fpConstructs[r.Construct](program) {
+			return false
+		}
+		if r.program != nil && !r.program.MatchString(program) {
+			return false
+		}
+	}
+	return r.diff == nil || r.diff.MatchString(c.reports())
+}
+
+var (
+	fpRulesMu      sync.Mutex
+	fpRulesLoaded  *FPRules
+	fpRulesModTime time.Time
+)
+
+// loadFPRules returns the rules of fpRulesPath, reading the file again when
+// its modification time changed. A missing file means no rules; a broken
+// one is reported once and the rules read before stay in force.
+func loadFPRules() *FPRules {
+	fpRulesMu.Lock()
+	defer fpRulesMu.Unlock()
+	info, err := os.Stat(fpRulesPath)
+	if err != nil {
+		fpRulesLoaded, fpRulesModTime = nil, time.Time{}
+		return nil
+	}
+	// the mod time is kept for a broken file as well
+	if !fpRulesModTime.IsZero() && info.ModTime().Equal(fpRulesModTime) {
+		return fpRulesLoaded
+	}
+	fpRulesModTime = info.ModTime()
+	rules, err := readFPRules(fpRulesPath)
+	if err != nil {
+		PrettyErr("fp-rules", err.Error())
+		return fpRulesLoaded
+	}
+	fpRulesLoaded = rules
+	return rules
+}
+
+func readFPRules(path string) (*FPRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := &FPRules{}
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, r := range rules.Rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return rules, nil
+}
+
+// matchFPRule returns the first rule that c matches, if any.
+func matchFPRule(c FPCase) *FPRule {
+	rules := loadFPRules()
+	if rules == nil {
+		return nil
+	}
+	for _, r := range rules.Rules {
+		if r.matches(c) {
+			return r
+		}
+	}
+	return nil
+}
+
+// suppressCase counts a case rule matched instead of reporting it, and
+// keeps the first cases of each rule under suppressed/<rule>/ in crashDir,
+// so a rule that is too broad can be spotted.
+func suppressCase(crashDir string, rule *FPRule, c FPCase, fuzzer string, seed int64) {
+	atomic.AddInt64(&countSuppressed, 1)
+	emitEvent(Event{Type: EventSuppressed, Fuzzer: fuzzer, Seed: seed, Tool: c.Tool, Detail: rule.Name})
+	PrettyWarn(fuzzer, fmt.Sprintf("suppressed by %s (seed %d)", rule.Name, seed))
+	curTimeStr := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	dir := fileCase(crashDir, Signature{Kind: "suppressed", Tool: rule.Name, Message: rule.Description},
+		"bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
+	if dir != "" {
+		if err := copyCrashArtifacts(c.Dir, dir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// fpConstructs are the constructs a rule can name, each detected in the
+// text of test.v.
+var fpConstructs = map[string]func(program string) bool{
+	"clock-tested-in-body": clockTestedInBody,
+	"module-scope-block":   moduleScopeBlock,
+}
+
+var (
+	alwaysEdges   = regexp.MustCompile(`always\s*@\s*\(([^)]*)\)`)
+	edgeEvent     = regexp.MustCompile(`(?:posedge|negedge)\s+(\w+)`)
+	clockName     = regexp.MustCompile(`^clock_\d+$`)
+	blockComment  = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	lineComment   = regexp.MustCompile(`//[^\n]*`)
+	verilogTokens = regexp.MustCompile(`\w+|[;()]`)
+)
+
+// clockTestedInBody finds an always block triggered by two or more edges
+// whose body tests one of its clocks. The testbenches raise all clocks at
+// once, so the block wakes with the tested clock high whichever edge came
+// first, and simulators disagree on how often it runs. A test that guards a
+// reset branch, as the generator writes for clocks used as asynchronous
+// resets, does not count.
+func clockTestedInBody(program string) bool {
+	program = stripComments(program)
+	locs := alwaysEdges.FindAllStringSubmatchIndex(program, -1)
+	for i, loc := range locs {
+		edges := edgeEvent.FindAllStringSubmatch(program[loc[2]:loc[3]], -1)
+		if len(edges) < 2 {
+			continue
+		}
+		end := len(program)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := program[loc[1]:end]
+		for _, edge := range edges {
+			if !clockName.MatchString(edge[1]) {
+				continue
+			}
+			test := regexp.MustCompile(`if\s*\(\s*([!~]?)\s*` + edge[1] + `\s*\)`)
+			for _, m := range test.FindAllStringSubmatchIndex(body, -1) {
+				if m[2] != m[3] || !isResetBranch(body[m[1]:]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+var resetAssign = regexp.MustCompile(`^\s*\w+\s*<=\s*(\d[\w']*)\s*;`)
+
+// isResetBranch reports whether the statement at the start of branch is a
+// begin/end block that loads one constant into every register it assigns.
+func isResetBranch(branch string) bool {
+	branch = strings.TrimSpace(branch)
+	if !strings.HasPrefix(branch, "begin") {
+		return false
+	}
+	branch = branch[len("begin"):]
+	value := ""
+	for {
+		m := resetAssign.FindStringSubmatchIndex(branch)
+		if m == nil {
+			break
+		}
+		v := branch[m[2]:m[3]]
+		if value != "" && v != value {
+			return false
+		}
+		value = v
+		branch = branch[m[1]:]
+	}
+	return value != "" && strings.HasPrefix(strings.TrimSpace(branch), "end")
+}
+
+// moduleScopeBlock finds a begin/end block directly in a module, outside
+// any always, initial, function or task and not part of a generate if, case
+// or for.
+func moduleScopeBlock(program string) bool {
+	tokens := verilogTokens.FindAllString(stripComments(program), -1)
+	depth := 0
+	// procedural lasts for the statement of an always or initial, routine
+	// up to endfunction or endtask
+	procedural, routine := false, false
+	prev := ""
+	for _, tok := range tokens {
+		switch tok {
+		case "always", "initial":
+			procedural = true
+		case "function", "task":
+			routine = true
+		case "endfunction", "endtask":
+			routine = false
+		case "begin":
+			if depth == 0 && !procedural && !routine && prev == ";" {
+				return true
+			}
+			depth++
+		case "end":
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 {
+				procedural = false
+			}
+		case ";":
+			if depth == 0 {
+				procedural = false
+			}
+		}
+		prev = tok
+	}
+	return false
+}
+
+func stripComments(program string) string {
+	return lineComment.ReplaceAllString(blockComment.ReplaceAllString(program, ""), "")
+}
+
+var (
+	toolVersionsMu sync.Mutex
+	toolVersions   = map[string]string{}
+)
+
+// toolVersion returns the first line of a tool's version output, or "" if
+// it cannot be run. CXXRTL is versioned with the yosys that generates it.
+func toolVersion(tool string) string {
+	toolVersionsMu.Lock()
+	defer toolVersionsMu.Unlock()
+	if v, ok := toolVersions[tool]; ok {
+		return v
+	}
+	var name string
+	var args []string
+	switch tool {
+	case "iverilog":
+		name, args = toolConfig.IverilogPath, []string{"-V"}
+	case "verilator", "yosys-verilator":
+		name, args = toolConfig.VerilatorPath, []string{"--version"}
+	case "yosys", "cxxrtl":
+		name, args = toolConfig.YosysPath, []string{"-V"}
+	}
+	version := ""
+	if name != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// iverilog -V exits 1 for want of a source file after the version
+		out, _ := exec.CommandContext(ctx, name, args...).CombinedOutput()
+		cancel()
+		version, _, _ = strings.Cut(strings.TrimSpace(string(out)), "\n")
+	}
+	toolVersions[tool] = version
+	return version
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const accuracyDir = "../experiment_data/experiment_3/Accuracy"
+
+func TestFPConstructs(t *testing.T) {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(accuracyDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	tests := []struct {
+		name      string
+		program   string
+		construct string
+		want      bool
+	}{
+		{"fp_cxxrtl.v", read("fp_cxxrtl.v"), "clock-tested-in-body", true},
+		{"fp_yosys.v", read("fp_yosys.v"), "module-scope-block", true},
+		{"fp_yosys.v", read("fp_yosys.v"), "clock-tested-in-body", false},
+		{"fp_cxxrtl.v", read("fp_cxxrtl.v"), "module-scope-block", false},
+		{"negated clock test", "always @(posedge clock_0 or negedge clock_1)\n  if (!clock_1) r <= 0;\n", "clock-tested-in-body", true},
+		{"one edge", "always @(posedge clock_0) if (clock_0) r <= 0;\n", "clock-tested-in-body", false},
+		{"reset, not a clock", "always @(posedge clock_0 or posedge rst) if (rst) r <= 0;\n", "clock-tested-in-body", false},
+		{"clock tested in the next block", "always @(posedge clock_0 or posedge clock_1) r <= 1;\n" +
+			"always @(posedge clock_2) if (clock_1) q <= 0;\n", "clock-tested-in-body", false},
+		{"clock as a reset", "always @(posedge clock_0 or posedge clock_1) begin\n  if (clock_1) begin\n    r <= 5;\n    q <= 5;\n" +
+			"  end else begin\n    r <= in0;\n  end\nend\n", "clock-tested-in-body", false},
+		{"distinct values under the clock", "always @(posedge clock_0 or posedge clock_1) begin\n  if (clock_1) begin\n    r <= 5;\n    q <= 6;\n" +
+			"  end else begin\n    r <= in0;\n  end\nend\n", "clock-tested-in-body", true},
+		{"commented out", "always @(posedge clock_0 or posedge clock_1) /* if (clock_1) */ r <= 1;\n", "clock-tested-in-body", false},
+		{"always block", "module m; always @(*) begin x = 1; end endmodule\n", "module-scope-block", false},
+		{"initial after a declaration", "module m; reg x; initial begin x = 0; end endmodule\n", "module-scope-block", false},
+		{"function", "module m; function f; input a; begin f = a; end endfunction endmodule\n", "module-scope-block", false},
+		{"generate if", "module m; generate if (1) begin : g wire w; end endgenerate endmodule\n", "module-scope-block", false},
+		{"block after a statement", "module m(input a); wire w; begin end endmodule\n", "module-scope-block", true},
+	}
+	for _, tt := range tests {
+		if got := fpConstructs[tt.construct](tt.program); got != tt.want {
+			t.Errorf("%s: %s = %v, want %v", tt.name, tt.construct, got, tt.want)
+		}
+	}
+
+	// generated designs are neither
+	f := &Fuzzer{TestFileName: "test.v", TestBenchName: "tb.v"}
+	for seed := int64(1); seed <= 20; seed++ {
+		program := f.NewTestCase("fuzz", seed, 0, nil).Generator.Design.String()
+		for name, detect := range fpConstructs {
+			if detect(program) {
+				t.Errorf("seed %d: generated design matches %s", seed, name)
+			}
+		}
+	}
+}
+
+func TestLoadFPRulesCachesBrokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fp_rules.json")
+	saved := fpRulesPath
+	fpRulesPath = path
+	fpRulesLoaded, fpRulesModTime = nil, time.Time{}
+	defer func() {
+		fpRulesPath = saved
+		fpRulesLoaded, fpRulesModTime = nil, time.Time{}
+	}()
+
+	modTime := time.Now().Add(-time.Hour)
+	write := func(text string, mod time.Time) {
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"rules": [`, modTime)
+	if rules := loadFPRules(); rules != nil {
+		t.Fatalf("broken file loaded: %+v", rules)
+	}
+	// fixed behind the cache's back: the broken file is not read again
+	write(`{"rules": [{"name": "r", "kind": "crash"}]}`, modTime)
+	if rules := loadFPRules(); rules != nil {
+		t.Errorf("broken file read again: %+v", rules)
+	}
+	write(`{"rules": [{"name": "r", "kind": "crash"}]}`, modTime.Add(time.Minute))
+	if rules := loadFPRules(); rules == nil || len(rules.Rules) != 1 {
+		t.Errorf("changed file not read: %+v", rules)
+	}
+	// a broken edit keeps the rules in force
+	write(`{"rules": [{"name": "../r"}]}`, modTime.Add(2*time.Minute))
+	if rules := loadFPRules(); rules == nil || rules.Rules[0].Name != "r" {
+		t.Errorf("rules after a broken edit: %+v", rules)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PhaseFrontend is the parse and elaboration of the design alone, without
+// testbench or code generation.
+const PhaseFrontend = "frontend"
+
+// rejectionFileName says which frontends rejected a case and why.
+const rejectionFileName = "rejection.txt"
+
+// frontendCommands give, for each frontend, the command that only parses
+// and elaborates the design file.
+var frontendCommands = map[string]func(design, work string) (string, []string){
+	"iverilog": func(design, work string) (string, []string) {
+		return toolConfig.IverilogPath, []string{"-t", "null", "-o", filepath.Join(work, "null"), design}
+	},
+	"verilator": func(design, work string) (string, []string) {
+		return toolConfig.VerilatorPath, []string{"--lint-only", "-Wno-fatal", "-Wno-lint", "-Wno-style", "-Mdir", work, design}
+	},
+	"yosys": func(design, work string) (string, []string) {
+		return toolConfig.YosysPath, []string{"-q", "-p", "read_verilog " + design + "; hierarchy -check"}
+	},
+}
+
+var defaultFrontends = []string{"iverilog", "verilator", "yosys"}
+
+func parseFrontends(list []string) ([]string, error) {
+	for _, name := range list {
+		if _, ok := frontendCommands[name]; !ok {
+			return nil, fmt.Errorf("unknown frontend: %s (have %s)", name, strings.Join(sortedKeys(frontendCommands), ", "))
+		}
+	}
+	return list, nil
+}
+
+// activeFrontends returns the frontends of the acceptance check, or nil
+// when -frontend-check is off.
+func activeFrontends() []string {
+	if !frontendCheckEnabled {
+		return nil
+	}
+	if len(toolConfig.Frontends) > 0 {
+		return toolConfig.Frontends
+	}
+	return defaultFrontends
+}
+
+// checkFrontends compiles the design of job with every frontend in
+// f.Frontends before anything is simulated. When fewer frontends reject it
+// than accept it, each rejection is filed as a bug of its own; when as many
+// or more reject it, the design is taken to be illegal and dropped. A
+// frontend that crashes, hangs or runs out of resources is filed as such.
+// stop is set when the case ended here, found when it reported a bug. A
+// design every frontend rejects is left to the simulators.
+func (f *Fuzzer) checkFrontends(job SimJob) (found, stop bool) {
+	if len(f.Frontends) < 2 {
+		return false, false
+	}
+	job.Tag = PhaseFrontend
+	messages := map[string]string{}
+	var accepted, rejected []string
+	for _, name := range f.Frontends {
+		bin, _ := frontendCommands[name](job.DesignFile, "")
+		if _, err := exec.LookPath(bin); err != nil {
+			missingFrontend(name, err)
+			continue
+		}
+		err := runFrontend(name, job)
+		if err == nil {
+			accepted = append(accepted, name)
+			continue
+		}
+		var toolErr *ToolError
+		if !errors.As(err, &toolErr) {
+			fmt.Println(err)
+			return false, true
+		}
+		msg, ok := rejection(toolErr)
+		if !ok {
+			handleToolFailure(f.CrashDir, job.Dir, toolErr)
+			return false, true
+		}
+		rejected = append(rejected, name)
+		messages[name] = msg
+	}
+	if len(rejected) == 0 || len(accepted) == 0 {
+		return false, false
+	}
+	if !rejectionMinority(accepted, rejected) {
+		PrettyWarn(job.Fuzzer, fmt.Sprintf("seed %d dropped: rejected by %s, accepted only by %s",
+			job.Seed, strings.Join(rejected, ", "), strings.Join(accepted, ", ")))
+		if err := os.RemoveAll(job.Dir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return false, true
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "rejected by %s, accepted by %s\n", strings.Join(rejected, ", "), strings.Join(accepted, ", "))
+	for _, name := range rejected {
+		fmt.Fprintf(&sb, "%s: %s\n", name, messages[name])
+	}
+	_ = os.WriteFile(filepath.Join(job.Dir, rejectionFileName), []byte(sb.String()), 0o644)
+	for _, name := range rejected {
+		if f.fileRejection(job, name, messages[name], accepted) {
+			found = true
+		}
+	}
+	if err := os.RemoveAll(job.Dir); err != nil {
+		fmt.Printf("%v\n", err)
+	}
+	return found, true
+}
+
+// rejectionMinority tells whether the frontends that rejected a design are
+// fewer than those that accepted it, so that the rejections are bugs rather
+// than the design being illegal.
+func rejectionMinority(accepted, rejected []string) bool {
+	return len(rejected) > 0 && len(rejected) < len(accepted)
+}
+
+// runFrontend parses and elaborates the design of job with one frontend.
+func runFrontend(name string, job SimJob) error {
+	job.Tag = PhaseFrontend
+	work := job.workDir(name)
+	if err := os.MkdirAll(work, 0755); err != nil {
+		return err
+	}
+	bin, args := frontendCommands[name](job.DesignFile, work)
+	return runTool(job, name, PhaseFrontend, job.Dir, work+".log", bin, args...)
+}
+
+var missingFrontends sync.Map
+
+// missingFrontend reports once that a frontend is not installed; the check
+// goes on with the others.
+func missingFrontend(name string, err error) {
+	if _, seen := missingFrontends.LoadOrStore(name, true); !seen {
+		PrettyErr("frontend", fmt.Sprintf("%s skipped: %v", name, err))
+	}
+}
+
+// rejection tells a frontend that reported an error in the design from one
+// that crashed: killed by a signal, a sanitizer report or an internal
+// error. It returns the normalized error message of a rejection.
+func rejection(toolErr *ToolError) (string, bool) {
+	if toolErr.Category() != "crash" || toolErr.Signal != 0 || toolErr.ExitCode <= 0 {
+		return "", false
+	}
+	text := toolErr.Stderr
+	if data, err := os.ReadFile(toolErr.Log); err == nil {
+		text += "\n" + string(data)
+	}
+	if checkSanitizerErrorFromStderr(text) || strings.Contains(text, "Internal Error") || strings.Contains(text, "Assertion") {
+		return "", false
+	}
+	if msg := errorMessage(text); msg != "" {
+		return msg, true
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return normalizeMessage(line), true
+		}
+	}
+	return fmt.Sprintf("exit code %d", toolErr.ExitCode), true
+}
+
+// fileRejection files the rejection of job's design by tool under
+// rejection/<tool>_frontend_<hash>/, unless a false-positive rule matches.
+func (f *Fuzzer) fileRejection(job SimJob, tool, msg string, accepted []string) bool {
+	fpCase := FPCase{Kind: "rejection", Tool: tool, Tools: f.Frontends, Dir: job.Dir, Report: msg}
+	if rule := matchFPRule(fpCase); rule != nil {
+		suppressCase(f.CrashDir, rule, fpCase, job.Fuzzer, job.Seed)
+		return false
+	}
+	atomic.AddInt64(&countRejections, 1)
+	emitEvent(Event{Type: EventRejection, Fuzzer: job.Fuzzer, Seed: job.Seed, Tool: tool, Phase: PhaseFrontend, Detail: msg})
+	sig := Signature{Kind: "rejection", Tool: tool, Phase: PhaseFrontend, Message: msg}
+	PrettyBug("rejection", tool+" rejects a design "+strings.Join(accepted, ", ")+" accept",
+		fmt.Sprintf("seed: %d", job.Seed), msg, "bucket: "+sig.Bucket())
+	curTimeStr := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	dir := fileCase(f.CrashDir, sig, "bug_"+curTimeStr+"_"+GetRandomFileName("", "", ""))
+	if dir != "" {
+		if err := copyCrashArtifacts(job.Dir, dir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		log := job.workDir(tool) + ".log"
+		_ = copyFile(log, filepath.Join(dir, filepath.Base(log)))
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestRejectionMinority(t *testing.T) {
+	tests := []struct {
+		accepted, rejected []string
+		want               bool
+	}{
+		{[]string{"iverilog", "verilator"}, []string{"yosys"}, true},
+		{[]string{"yosys"}, []string{"iverilog", "verilator"}, false},
+		{[]string{"iverilog"}, []string{"yosys"}, false},
+		{[]string{"iverilog", "verilator", "yosys"}, nil, false},
+		{nil, []string{"iverilog", "verilator", "yosys"}, false},
+		{[]string{"a", "b", "c"}, []string{"d", "e"}, true},
+		{[]string{"a", "b"}, []string{"c", "d"}, false},
+	}
+	for _, tt := range tests {
+		if got := rejectionMinority(tt.accepted, tt.rejected); got != tt.want {
+			t.Errorf("accepted by %v, rejected by %v: got %v, want %v", tt.accepted, tt.rejected, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TestEqualModules runs one equivalence case on target. Without diff-sim
+// every variant must print the same records as the first one in the
+// equivalence testbench; with diff-sim the first
+// variant must give the same outputs on target and on every backend in
+// f.Backends. With the reference check the first variant must also match
+// the reference evaluator. It returns true when a mismatch was reported.
+func (f *Fuzzer) TestEqualModules(target string, seed int64, equalNumber int) bool {
+	if equalNumber == 0 {
+		equalNumber = 10
+	}
+	curMillis := time.Now().UnixMilli()
+	curTimeStr := strconv.FormatInt(curMillis, 10)
+	subDir := strconv.FormatInt(curMillis%1000, 10)
+	tmpSubDir := filepath.Join(f.TmpDir, subDir)
+
+	if err := os.MkdirAll(tmpSubDir, 0755); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	realSubDir := filepath.Join(tmpSubDir, GetRandomFileName("tmp_"+target, "", ""))
+	if err := os.MkdirAll(realSubDir, 0755); err != nil {
+		fmt.Println(err)
+		return false
+	}
+
+	tc := f.NewTestCase(target, seed, equalNumber, f.Backends)
+	if err := tc.Write(realSubDir); err != nil {
+		fmt.Println(err)
+		return false
+	}
+	start := time.Now()
+	emitEvent(Event{Type: EventCaseStart, Fuzzer: target, Seed: seed})
+
+	shouldReport := false
+	suspect := ""
+	// the first divergence found, for the signature of the case
+	var firstDiff *OutputDiff
+	// what differs, for the mismatch event
+	var found []string
+	sims := append([]string{target}, f.Backends...)
+	job := tc.DiffJob(realSubDir)
+	if found, stop := f.checkFrontends(job); stop {
+		return found
+	}
+	if f.EnableDiffSim {
+		outputs := make([][]byte, len(sims))
+		for i, name := range sims {
+			data, err := f.simulate(name, job, tc.Input)
+			if err != nil {
+				return false
+			}
+			outputs[i] = data
+		}
+		for i := 1; i < len(sims); i++ {
+			if outputsMatch(outputs[0], outputs[i], tc.XInputs) {
+				continue
+			}
+			shouldReport = true
+			if firstDiff == nil {
+				firstDiff = tc.recordDiff(sims[0], outputs[0], sims[i], outputs[i])
+			}
+			found = append(found, fmt.Sprintf("%s vs %s", sims[0], sims[i]))
+			diffContent := fmt.Sprintf("==== %s vs %s Diff ====\n", sims[0], sims[i]) +
+				tc.outputDiff(sims[0], outputs[0], sims[i], outputs[i])
+			diffFile := filepath.Join(realSubDir, fmt.Sprintf("diff_%s_vs_%s.txt", sims[0], sims[i]))
+			_ = os.WriteFile(diffFile, []byte(diffContent), 0o644)
+		}
+		deviated := checkReference(tc, realSubDir, sims, outputs)
+		if !shouldReport && len(deviated) > 0 {
+			shouldReport = true
+			firstDiff = tc.recordDiff("reference", []byte(tc.Expected), sims[0], outputs[0])
+			found = append(found, "all simulators deviate from reference")
+		}
+		if shouldReport {
+			suspect = voteOnCase(tc, realSubDir, sims, outputs)
+		}
+	} else {
+		data, err := f.simulate(target, tc.EquivJob(realSubDir), tc.Input)
+		if err != nil {
+			return false
+		}
+		report, differing, d := diffVariants(data)
+		if len(differing) > 0 {
+			shouldReport = true
+			firstDiff = d
+			found = append(found, "variants differ from eq0: "+strings.Join(differing, ", "))
+			_ = os.WriteFile(filepath.Join(realSubDir, equivDiffFileName), []byte(report), 0o644)
+		}
+		if tc.Expected != "" {
+			data, err := f.simulate(target, job, tc.Input)
+			if err != nil {
+				return false
+			}
+			if len(checkReference(tc, realSubDir, []string{target}, [][]byte{data})) > 0 {
+				shouldReport = true
+				if firstDiff == nil {
+					firstDiff = tc.recordDiff("reference", []byte(tc.Expected), target, data)
+				}
+				found = append(found, "deviates from reference")
+			}
+		}
+	}
+
+	if !shouldReport {
+		if err := os.RemoveAll(realSubDir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		emitEvent(Event{Type: EventCleanup, Fuzzer: target, Seed: seed, Duration: time.Since(start).Seconds()})
+		PrettyOK(target, "finish")
+		return false
+	}
+	compared := []string{target}
+	if f.EnableDiffSim {
+		compared = sims
+	}
+	fpCase := FPCase{Kind: "mismatch", Tool: suspect, Tools: compared, Dir: realSubDir}
+	if rule := matchFPRule(fpCase); rule != nil {
+		suppressCase(f.CrashDir, rule, fpCase, target, seed)
+		_ = os.RemoveAll(realSubDir)
+		return false
+	}
+	atomic.AddInt64(&countBugs, 1)
+	addSuspect(suspect)
+	tool := suspect
+	if !f.EnableDiffSim {
+		// only the target ran
+		tool = target
+	}
+	emitEvent(Event{Type: EventMismatch, Fuzzer: target, Seed: seed, Tool: tool,
+		Duration: time.Since(start).Seconds(), Detail: strings.Join(found, "; ")})
+	sig := tc.mismatchSignature(suspect, firstDiff)
+	PrettyBug(target, "bug detected", fmt.Sprintf("seed: %d", seed), suspectDetail(suspect), "bucket: "+sig.Bucket())
+	uniqueCrashDir := fileCase(f.CrashDir, sig, bugDirName(curTimeStr, suspect))
+	if uniqueCrashDir == "" {
+		// the bucket is full
+		if err := os.RemoveAll(realSubDir); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return true
+	}
+	_ = copyCrashArtifacts(realSubDir, uniqueCrashDir)
+	if f.Waveform {
+		if err := tc.writeDiffTbs(realSubDir); err != nil {
+			fmt.Println(err)
+		} else {
+			f.dumpWaveforms(job, tc.Input, sims, uniqueCrashDir)
+		}
+	}
+	return true
+}
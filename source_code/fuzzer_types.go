@@ -1,5 +1,7 @@
 package main
 
+import "VeriEQ/CodeGenerator"
+
 type Fuzzer struct {
 	StartTime        int64
 	LogDir           string
@@ -9,4 +11,9 @@ type Fuzzer struct {
 	TestFileName     string
 	VerilatorOptions []string
 	EnableDiffSim    bool
+	Reference        bool
+	Waveform         bool
+	Frontends        []string
+	Backends         []string
+	GenOptions       CodeGenerator.GeneratorOptions
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// ResourceLimits caps one child process. MemoryMB/CPUSeconds/FileSizeMB are
+// applied as soft rlimits (ulimit -v/-t/-f); 0 leaves a limit unset. RLIMIT_AS
+// does not work with ASan builds, use Cgroup for those: the child is moved
+// into that cgroup (a directory with a writable cgroup.procs) before exec.
+type ResourceLimits struct {
+	MemoryMB   int    `json:"memory_mb,omitempty"`
+	CPUSeconds int    `json:"cpu_seconds,omitempty"`
+	FileSizeMB int    `json:"file_size_mb,omitempty"`
+	Cgroup     string `json:"cgroup,omitempty"`
+}
+
+func (l ResourceLimits) empty() bool {
+	return l == ResourceLimits{}
+}
+
+// wrap returns the command line that runs name under the limits.
+func (l ResourceLimits) wrap(name string, args []string) (string, []string) {
+	if l.empty() {
+		return name, args
+	}
+	script := ""
+	if l.Cgroup != "" {
+		script += fmt.Sprintf("echo $$ > '%s/cgroup.procs' && ", l.Cgroup)
+	}
+	if l.MemoryMB > 0 {
+		script += fmt.Sprintf("ulimit -S -v %d && ", l.MemoryMB*1024)
+	}
+	if l.CPUSeconds > 0 {
+		script += fmt.Sprintf("ulimit -S -t %d && ", l.CPUSeconds)
+	}
+	if l.FileSizeMB > 0 {
+		script += fmt.Sprintf("ulimit -S -f %d && ", l.FileSizeMB*1024)
+	}
+	script += `exec "$@"`
+	return "bash", append([]string{"-c", script, "bash", name}, args...)
+}
+
+// limitsFor returns the limits of tool, falling back to the "default" entry.
+func (c *ToolConfig) limitsFor(tool string) ResourceLimits {
+	if l, ok := c.Limits[tool]; ok {
+		return l
+	}
+	return c.Limits["default"]
+}
+
+// exitStatus reports how a finished child ended: the terminating signal, if
+// any, and the exit code. A shell reports a killed child as 128+signal, so
+// that is decoded too when viaShell is set.
+func exitStatus(err error, viaShell bool) (syscall.Signal, int) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, -1
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 0, exitErr.ExitCode()
+	}
+	if status.Signaled() {
+		return status.Signal(), -1
+	}
+	code := status.ExitStatus()
+	if viaShell && code > 128 && code < 128+65 {
+		return syscall.Signal(code - 128), code
+	}
+	return 0, code
+}
+
+// isResourceSignal tells resource exhaustion (OOM killer, CPU or file-size
+// limit) apart from a real crash.
+func isResourceSignal(sig syscall.Signal) bool {
+	switch sig {
+	case syscall.SIGKILL, syscall.SIGXCPU, syscall.SIGXFSZ:
+		return true
+	}
+	return false
+}
+
+func signalName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGSEGV:
+		return "SIGSEGV"
+	case syscall.SIGABRT:
+		return "SIGABRT"
+	case syscall.SIGBUS:
+		return "SIGBUS"
+	case syscall.SIGFPE:
+		return "SIGFPE"
+	case syscall.SIGILL:
+		return "SIGILL"
+	case syscall.SIGKILL:
+		return "SIGKILL"
+	case syscall.SIGXCPU:
+		return "SIGXCPU"
+	case syscall.SIGXFSZ:
+		return "SIGXFSZ"
+	case syscall.SIGTERM:
+		return "SIGTERM"
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
@@ -5,28 +5,163 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 )
 
 func main() {
 	//TestAllEquivalence()
+	if len(os.Args) > 1 && os.Args[1] == "stats" {
+		RunStats(os.Args[2:])
+		return
+	}
 	PrettyLogo()
-	fuzzer := flag.String("fuzzer", "verilator", "Which fuzzer to run: iverilog | verilator | yosys | cxxrtl")
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		RunReplay(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reduce" {
+		RunReduce(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "reduce-text" {
+		RunReduceText(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bisect" {
+		RunBisect(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		RunWorker(os.Args[2:])
+		return
+	}
+	// `coordinator` takes the campaign flags below and serves the cases to
+	// workers instead of running them
+	coordinator := len(os.Args) > 1 && os.Args[1] == "coordinator"
+	if coordinator {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
+	fuzzer := flag.String("fuzzer", "verilator", "Which fuzzer to run: iverilog | verilator | yosys | yosys-verilator | cxxrtl | fuzz, or several with thread counts, e.g. verilator:40,cxxrtl:20")
 	threads := flag.Int("threads", 30, "Number of threads")
 	count := flag.Int("count", 5, "Number of equivalent test cases")
 	configPath := flag.String("config", "", "Path to config file")
 	controlFlowEquiv := flag.Bool("control-flow-equiv", controlFlowEquivEnabled, "Enable control-flow equivalence transformations")
 	xInputs := flag.Bool("x-input", xInputEnabled, "Enable X-valued inputs in testbench")
+	observe := flag.Bool("observe", observeEnabled, "Also print every internal signal in the output testbenches to localize divergences")
+	reference := flag.Bool("reference", referenceEnabled, "Also check simulator outputs against the built-in reference evaluator")
+	waveform := flag.Bool("waveform", waveformEnabled, "Rerun reported cases with VCD dumps on every simulator and diff the waveforms")
+	frontendCheck := flag.Bool("frontend-check", frontendCheckEnabled, "Compile every case with all frontends first and report designs some reject and others accept")
+	duration := flag.Duration("duration", 0, "Stop the campaign after this long, e.g. 30m or 12h (0 = unbounded)")
+	maxCases := flag.Int("max-cases", 0, "Stop the campaign after this many test cases (0 = unbounded)")
+	backends := flag.String("backends", "", "Comma-separated simulators to compare against, e.g. iverilog,cxxrtl (default: from config)")
+	compileLimit := flag.Duration("compile-timeout", compileTimeout, "Default limit for elaboration and C++ builds; per-tool values come from the config")
+	runLimit := flag.Duration("run-timeout", runTimeout, "Default limit for one simulation run; per-tool values come from the config")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this localhost address, e.g. 127.0.0.1:9464")
+	adaptive := flag.Bool("adaptive", false, "Move workers between fuzzers toward the best bug yield per worker-second")
+	rebalance := flag.Duration("rebalance", time.Minute, "How often -adaptive recomputes the worker allocation")
+	seed := flag.Int64("seed", 0, "Campaign seed; every test case seed is derived from it (0 = from clock)")
+	listen := flag.String("listen", "127.0.0.1:7700", "coordinator: address to serve workers on")
+	token := flag.String("token", "", "coordinator: token workers must send; required off localhost")
+	leaseTimeout := flag.Duration("lease-timeout", time.Hour, "coordinator: hand a case out again if its worker has not reported back after this long")
+	resume := flag.String("resume", "", "Continue the campaign of this run directory, e.g. log/1712345678901; cases in flight at its last checkpoint run again")
+	keep := flag.Int("bucket-keep", bucketKeep, "Cases saved per signature bucket under bug/<ts>/ (0 = all)")
+	fpRules := flag.String("fp-rules", fpRulesPath, "False-positive rules; matching cases are counted as suppressed instead of reported (re-read when changed)")
 	flag.Parse()
 	cfg, err := LoadToolConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Config load warning: %v\n", err)
 	}
 	toolConfig = cfg
-	CodeGenerator.DefaultUsePaperInitGen = paperInitGenEnabled
-	CodeGenerator.DefaultEnableControlFlowEquiv = *controlFlowEquiv
-	CodeGenerator.DefaultEnableXInputs = *xInputs
-	if *xInputs {
-		diffSimEnabled = false
+	compileTimeout = *compileLimit
+	runTimeout = *runLimit
+	if err := toolConfig.validateTimeouts(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for target, list := range toolConfig.Backends {
+		if _, err := parseBackends(strings.Join(list, ",")); err != nil {
+			fmt.Fprintf(os.Stderr, "Config backends for %s: %v\n", target, err)
+			os.Exit(1)
+		}
+	}
+	if _, err := parseFrontends(toolConfig.Frontends); err != nil {
+		fmt.Fprintf(os.Stderr, "Config frontends: %v\n", err)
+		os.Exit(1)
+	}
+	if *backends != "" {
+		list, err := parseBackends(*backends)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		backendsOverride = list
+	}
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	var checkpoint *Checkpoint
+	if *resume != "" {
+		checkpoint, err = LoadCheckpoint(*resume)
+		if err == nil && set["seed"] && *seed != checkpoint.Summary.Seed {
+			err = fmt.Errorf("resume: run %d has seed %d, not %d", checkpoint.ID, checkpoint.Summary.Seed, *seed)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	targets, err := ParseTargets(*fuzzer, *threads)
+	if !set["fuzzer"] && checkpoint != nil {
+		targets, err = ParseTargets(checkpoint.Targets, *threads)
+	} else if !set["fuzzer"] && len(toolConfig.Targets) > 0 {
+		targets, err = targetsFromConfig(toolConfig.Targets)
+	}
+	if err == nil && *adaptive && *rebalance <= 0 {
+		err = fmt.Errorf("-rebalance must be positive")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	generatorOptions = CodeGenerator.GeneratorOptions{
+		UsePaperInitGen:        paperInitGenEnabled,
+		EnableControlFlowEquiv: *controlFlowEquiv,
+		EnableXInputs:          *xInputs,
+		EnableObservability:    *observe,
+	}
+	referenceEnabled = *reference
+	waveformEnabled = *waveform
+	frontendCheckEnabled = *frontendCheck
+	bucketKeep = *keep
+	fpRulesPath = *fpRules
+	var campaign *Campaign
+	if checkpoint != nil {
+		campaign = ResumeCampaign(checkpoint, *duration, int64(*maxCases))
+		PrettyInfo("main", fmt.Sprintf("resuming run %d at case %d", campaign.ID, checkpoint.Seq))
+	} else {
+		campaign = NewCampaign(*duration, int64(*maxCases), *seed)
+	}
+	campaign.HandleSignals()
+	eventLog, err = OpenEventLog(campaign.LogDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Event log: %v\n", err)
+	}
+	if *metricsAddr != "" {
+		metrics = NewMetrics()
+		if err := metrics.Serve(*metricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "Metrics: %v\n", err)
+			os.Exit(1)
+		}
+		PrettyInfo("main", "metrics on http://"+*metricsAddr+"/metrics")
+	}
+	// after metrics is set: the logger samples tmp/ for it
+	StartCounterLogger(campaign, formatTargets(targets), 30*time.Second)
+	if coordinator {
+		RunCoordinator(*listen, targets, *count, campaign, *adaptive, *rebalance, *token, *leaseTimeout)
+		return
 	}
-	RunSelectedFuzzer(*fuzzer, *count, *threads)
+	RunSelectedFuzzer(targets, *count, campaign, *adaptive, *rebalance)
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var latencyBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, upper := range latencyBuckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Metrics is fed from the event stream and served in the Prometheus text
+// format. The campaign counters themselves are read at scrape time; the size
+// of tmp/ is sampled by the counter logger, as walking it is too slow for
+// every scrape.
+type Metrics struct {
+	mu         sync.Mutex
+	start      time.Time
+	phases     map[[2]string]*histogram
+	failures   map[[2]string]uint64
+	mismatches map[string]uint64
+	tmpBytes   int64
+}
+
+var metrics *Metrics
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		start:      time.Now(),
+		phases:     map[[2]string]*histogram{},
+		failures:   map[[2]string]uint64{},
+		mismatches: map[string]uint64{},
+	}
+}
+
+func (m *Metrics) Observe(e Event) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch e.Type {
+	case EventPhase:
+		key := [2]string{e.Tool, e.Phase}
+		h, ok := m.phases[key]
+		if !ok {
+			h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+			m.phases[key] = h
+		}
+		h.observe(e.Duration)
+		if e.Detail != "" {
+			m.failures[key]++
+		}
+	case EventMismatch:
+		m.mismatches[e.Fuzzer]++
+	}
+}
+
+// sampleTmpDir records the disk used by tmp/ for the next scrapes.
+func (m *Metrics) sampleTmpDir() {
+	if m == nil {
+		return
+	}
+	atomic.StoreInt64(&m.tmpBytes, dirSize(TMPDIR))
+}
+
+// Serve starts the /metrics listener. Only loopback addresses are accepted.
+func (m *Metrics) Serve(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("metrics address %s is not on localhost", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	m.sampleTmpDir()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(m.render()))
+	})
+	go func() {
+		_ = http.Serve(listener, mux)
+	}()
+	return nil
+}
+
+func (m *Metrics) render() string {
+	var b strings.Builder
+	counter := func(name, help string, value int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("veq_cases_total", "Test cases generated.", atomic.LoadInt64(&countCases))
+	counter("veq_bugs_total", "Cases reported as mismatches.", atomic.LoadInt64(&countBugs))
+	counter("veq_crashes_total", "Tool crashes.", atomic.LoadInt64(&countCrashes))
+	counter("veq_timeouts_total", "Tool phases killed by their timeout.", atomic.LoadInt64(&countHangs))
+	counter("veq_resource_exhausted_total", "Tools killed by a resource limit.", atomic.LoadInt64(&countResource))
+	counter("veq_rejections_total", "Designs a frontend rejected and another accepted.", atomic.LoadInt64(&countRejections))
+	counter("veq_suppressed_total", "Cases matched by a false-positive rule.", atomic.LoadInt64(&countSuppressed))
+
+	b.WriteString("# HELP veq_variants_total Equivalent variants simulated, by tool.\n# TYPE veq_variants_total counter\n")
+	for _, v := range []struct {
+		tool  string
+		count *int64
+	}{
+		{"iverilog", &countIverilog},
+		{"verilator", &countVerilator},
+		{"yosys", &countYosysOpt},
+		{"cxxrtl", &countCXXRTL},
+	} {
+		fmt.Fprintf(&b, "veq_variants_total{tool=%q} %d\n", v.tool, atomic.LoadInt64(v.count))
+	}
+
+	suspects := suspectCounts()
+	b.WriteString("# HELP veq_suspected_bugs_total Mismatches by the tool the majority vote blamed.\n# TYPE veq_suspected_bugs_total counter\n")
+	for _, tool := range sortedKeys(suspects) {
+		fmt.Fprintf(&b, "veq_suspected_bugs_total{tool=%q} %d\n", tool, suspects[tool])
+	}
+
+	m.mu.Lock()
+	b.WriteString("# HELP veq_mismatches_total Reported mismatch cases, by fuzzer.\n# TYPE veq_mismatches_total counter\n")
+	for _, fuzzer := range sortedKeys(m.mismatches) {
+		fmt.Fprintf(&b, "veq_mismatches_total{fuzzer=%q} %d\n", fuzzer, m.mismatches[fuzzer])
+	}
+
+	keys := make([][2]string, 0, len(m.phases))
+	for key := range m.phases {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	b.WriteString("# HELP veq_tool_phase_failures_total Failed tool invocations, by tool and phase.\n# TYPE veq_tool_phase_failures_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "veq_tool_phase_failures_total{tool=%q,phase=%q} %d\n", key[0], key[1], m.failures[key])
+	}
+	b.WriteString("# HELP veq_tool_phase_seconds Tool invocation latency, by tool and phase.\n# TYPE veq_tool_phase_seconds histogram\n")
+	for _, key := range keys {
+		h := m.phases[key]
+		labels := fmt.Sprintf("tool=%q,phase=%q", key[0], key[1])
+		for i, upper := range latencyBuckets {
+			fmt.Fprintf(&b, "veq_tool_phase_seconds_bucket{%s,le=\"%g\"} %d\n", labels, upper, h.counts[i])
+		}
+		fmt.Fprintf(&b, "veq_tool_phase_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(&b, "veq_tool_phase_seconds_sum{%s} %g\n", labels, h.sum)
+		fmt.Fprintf(&b, "veq_tool_phase_seconds_count{%s} %d\n", labels, h.count)
+	}
+	m.mu.Unlock()
+
+	fmt.Fprintf(&b, "# HELP veq_tmp_dir_bytes Disk used by the tmp/ working tree, sampled every 30s.\n# TYPE veq_tmp_dir_bytes gauge\nveq_tmp_dir_bytes %d\n", atomic.LoadInt64(&m.tmpBytes))
+	fmt.Fprintf(&b, "# HELP veq_uptime_seconds Seconds since the campaign started.\n# TYPE veq_uptime_seconds gauge\nveq_uptime_seconds %g\n", time.Since(m.start).Seconds())
+	return b.String()
+}
+
+// dirSize sums the file sizes under dir, skipping files that vanish while
+// the workers clean up.
+func dirSize(dir string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"x": 10, "a/y": 20, "a/b/z": 30} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := dirSize(dir); got != 60 {
+		t.Errorf("dirSize = %d, want 60", got)
+	}
+	if got := dirSize(filepath.Join(dir, "missing")); got != 0 {
+		t.Errorf("dirSize of a missing directory = %d", got)
+	}
+}
+
+func TestMetricsServesSampledTmpSize(t *testing.T) {
+	m := NewMetrics()
+	m.tmpBytes = 1234
+	if !strings.Contains(m.render(), "\nveq_tmp_dir_bytes 1234\n") {
+		t.Errorf("render does not serve the sampled size:\n%s", m.render())
+	}
+	// a nil Metrics, as without -metrics-addr, ignores the sample
+	var none *Metrics
+	none.sampleTmpDir()
+}
+
+func TestMetricsCountsMismatchCases(t *testing.T) {
+	m := NewMetrics()
+	for _, e := range []Event{
+		{Type: EventCaseStart, Fuzzer: "fuzz", Seed: 1},
+		{Type: EventPhase, Fuzzer: "fuzz", Seed: 1, Tool: "cxxrtl", Phase: PhaseSimulation, Duration: 0.5},
+		{Type: EventSuppressed, Fuzzer: "fuzz", Seed: 1, Tool: "cxxrtl"},
+		{Type: EventCaseStart, Fuzzer: "fuzz", Seed: 2},
+		{Type: EventMismatch, Fuzzer: "fuzz", Seed: 2, Tool: "cxxrtl", Detail: "iverilog vs cxxrtl; verilator vs cxxrtl"},
+	} {
+		m.Observe(e)
+	}
+	if !strings.Contains(m.render(), "\nveq_mismatches_total{fuzzer=\"fuzz\"} 1\n") {
+		t.Errorf("want one mismatch for the one reported case:\n%s", m.render())
+	}
+}
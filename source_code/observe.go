@@ -0,0 +1,76 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// signalsFileName lists the internal signals of an -observe case with their
+// dependency level and definition.
+const signalsFileName = "signals.json"
+
+// outputDiff is diffOutputs for the outputs of tc. With -observe it also
+// names the topologically earliest signal that diverges.
+func (tc *TestCase) outputDiff(leftLabel string, left []byte, rightLabel string, right []byte) string {
+	report := diffOutputs(leftLabel, left, rightLabel, right, tc.XInputs)
+	if report == "" || len(tc.Signals) == 0 {
+		return report
+	}
+	return report + earliestDivergence(tc.recordDiff(leftLabel, left, rightLabel, right), tc.Signals)
+}
+
+// recordDiff compares the records of two outputs of tc.
+func (tc *TestCase) recordDiff(leftLabel string, left []byte, rightLabel string, right []byte) *OutputDiff {
+	leftRecords, _ := parseOutputs(left)
+	rightRecords, _ := parseOutputs(right)
+	return compareRecords(leftLabel, leftRecords, rightLabel, rightRecords, tc.XInputs)
+}
+
+// earliestDivergence reports the signal earliestSignal picks.
+func earliestDivergence(d *OutputDiff, signals []CodeGenerator.ObservedSignal) string {
+	first, others, ok := earliestSignal(d, signals)
+	if !ok {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\nearliest divergent signal at cycle %d: %s (level %d)\n", d.First, first.Name, first.Level)
+	fmt.Fprintf(&sb, "  %s\n", first.Definition)
+	if len(others) > 0 {
+		fmt.Fprintf(&sb, "also diverging then: %s\n", strings.Join(others, ", "))
+	}
+	return sb.String()
+}
+
+// earliestSignal picks, among the signals that diverge in the first
+// divergent cycle, the one with the lowest dependency level: none of the
+// signals it is computed from differ yet, so the divergence starts there.
+// others are the remaining signals diverging in that cycle.
+func earliestSignal(d *OutputDiff, signals []CodeGenerator.ObservedSignal) (CodeGenerator.ObservedSignal, []string, bool) {
+	if d.First < 0 {
+		return CodeGenerator.ObservedSignal{}, nil, false
+	}
+	byName := make(map[string]int, len(signals))
+	for i, s := range signals {
+		byName[s.Name] = i
+	}
+	var diverged []int
+	for _, s := range d.Signals {
+		i, ok := byName[s.Signal]
+		if ok && s.Cycles[0].Cycle == d.First {
+			diverged = append(diverged, i)
+		}
+	}
+	if len(diverged) == 0 {
+		return CodeGenerator.ObservedSignal{}, nil, false
+	}
+	sort.SliceStable(diverged, func(a, b int) bool {
+		return signals[diverged[a]].Level < signals[diverged[b]].Level
+	})
+	var others []string
+	for _, i := range diverged[1:] {
+		others = append(others, signals[i].Name)
+	}
+	return signals[diverged[0]], others, true
+}
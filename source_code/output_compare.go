@@ -0,0 +1,382 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// equivDiffFileName holds the variants that differ from the first one in
+// an equivalence run.
+const equivDiffFileName = "equiv_diff.txt"
+
+// maxListedCycles bounds the per-cycle lines of one signal in a report.
+const maxListedCycles = 16
+
+// OutputRecord is one line of a testbench output: the value of one output
+// signal after one input vector, as
+// "cycle=3 signal=out0 width=22 signed=1 value=3ffff4".
+type OutputRecord struct {
+	Cycle  int
+	Signal string
+	Width  int
+	Signed bool
+	Value  string
+}
+
+func parseRecord(line string) (OutputRecord, bool) {
+	var rec OutputRecord
+	seen := 0
+	for _, field := range strings.Fields(line) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return rec, false
+		}
+		var err error
+		switch key {
+		case "cycle":
+			rec.Cycle, err = strconv.Atoi(value)
+		case "signal":
+			rec.Signal = value
+		case "width":
+			rec.Width, err = strconv.Atoi(value)
+		case "signed":
+			rec.Signed = value == "1"
+		case "value":
+			rec.Value = value
+		default:
+			return rec, false
+		}
+		if err != nil {
+			return rec, false
+		}
+		seen++
+	}
+	return rec, seen == 5
+}
+
+// parseOutputs splits an output file into its records and the remaining
+// non-empty lines.
+func parseOutputs(data []byte) ([]OutputRecord, []string) {
+	var records []OutputRecord
+	var other []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if rec, ok := parseRecord(line); ok {
+			records = append(records, rec)
+		} else {
+			other = append(other, line)
+		}
+	}
+	return records, other
+}
+
+// CycleDiff is one cycle in which a signal differs. A side without a
+// record for it has an empty value.
+type CycleDiff struct {
+	Cycle       int
+	Left, Right string
+}
+
+// SignalDiff collects the cycles in which one signal differs. Bits is the
+// union of the differing bits over all of them.
+type SignalDiff struct {
+	Signal string
+	Width  int
+	Signed bool
+	Cycles []CycleDiff
+	Bits   *big.Int
+}
+
+// OutputDiff is the result of comparing two outputs record by record.
+// First is the first divergent cycle, or -1 when they agree. Compatible
+// counts the records that differ only where one side is X or Z.
+type OutputDiff struct {
+	LeftLabel, RightLabel string
+	Signals               []*SignalDiff
+	Cycles                int
+	Diverged              int
+	First                 int
+	Compatible            int
+}
+
+type recordKey struct {
+	cycle  int
+	signal string
+}
+
+// compareRecords compares two record lists. Records of observed internal
+// signals only count when both sides have them. With fourState an X or Z digit
+// printed by a 4-state simulator matches any digit on the other side, so
+// Icarus' X against the concrete value of a 2-state tool is no mismatch;
+// concrete digits must still agree.
+func compareRecords(leftLabel string, left []OutputRecord, rightLabel string, right []OutputRecord, fourState bool) *OutputDiff {
+	d := &OutputDiff{LeftLabel: leftLabel, RightLabel: rightLabel, First: -1}
+	rightByKey := make(map[recordKey]OutputRecord, len(right))
+	for _, rec := range right {
+		rightByKey[recordKey{rec.Cycle, rec.Signal}] = rec
+	}
+
+	signals := map[string]*SignalDiff{}
+	cycles := map[int]bool{}
+	diverged := map[int]bool{}
+	note := func(meta OutputRecord, c CycleDiff) {
+		s, ok := signals[meta.Signal]
+		if !ok {
+			s = &SignalDiff{Signal: meta.Signal, Width: meta.Width, Signed: meta.Signed, Bits: new(big.Int)}
+			signals[meta.Signal] = s
+			d.Signals = append(d.Signals, s)
+		}
+		s.Cycles = append(s.Cycles, c)
+		if l, ok := hexValue(c.Left); ok {
+			if r, ok := hexValue(c.Right); ok {
+				s.Bits.Or(s.Bits, l.Xor(l, r))
+			}
+		} else {
+			s.Bits.Or(s.Bits, knownDiff(c.Left, c.Right))
+		}
+		diverged[c.Cycle] = true
+		if d.First < 0 || c.Cycle < d.First {
+			d.First = c.Cycle
+		}
+	}
+
+	matched := map[recordKey]bool{}
+	for _, l := range left {
+		key := recordKey{l.Cycle, l.Signal}
+		cycles[l.Cycle] = true
+		r, ok := rightByKey[key]
+		matched[key] = ok
+		if !ok {
+			if observed(l.Signal) {
+				continue
+			}
+			note(l, CycleDiff{Cycle: l.Cycle, Left: l.Value})
+		} else if l.Value != r.Value {
+			if fourState && compatible(l.Value, r.Value) {
+				d.Compatible++
+				continue
+			}
+			note(l, CycleDiff{Cycle: l.Cycle, Left: l.Value, Right: r.Value})
+		}
+	}
+	for _, r := range right {
+		cycles[r.Cycle] = true
+		if !matched[recordKey{r.Cycle, r.Signal}] && !observed(r.Signal) {
+			note(r, CycleDiff{Cycle: r.Cycle, Right: r.Value})
+		}
+	}
+	d.Cycles = len(cycles)
+	d.Diverged = len(diverged)
+	return d
+}
+
+// observed reports an internal signal printed with -observe. A backend
+// that optimised it away prints no record for it, which is no divergence.
+func observed(signal string) bool {
+	return strings.HasPrefix(signal, CodeGenerator.ObservePrefix)
+}
+
+func unknownDigit(c byte) bool {
+	switch c {
+	case 'x', 'X', 'z', 'Z':
+		return true
+	}
+	return false
+}
+
+// compatible reports whether two %h values of the same width agree on
+// every digit that is known on both sides.
+func compatible(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if !unknownDigit(a[i]) && !unknownDigit(b[i]) && !strings.EqualFold(a[i:i+1], b[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// knownDiff returns the differing bits of two %h values, skipping the
+// digits that are X or Z on either side.
+func knownDiff(a, b string) *big.Int {
+	mask := new(big.Int)
+	if len(a) != len(b) {
+		return mask
+	}
+	for i := 0; i < len(a); i++ {
+		l, lok := hexValue(a[i : i+1])
+		r, rok := hexValue(b[i : i+1])
+		if lok && rok {
+			mask.Or(mask, new(big.Int).Lsh(l.Xor(l, r), uint(4*(len(a)-1-i))))
+		}
+	}
+	return mask
+}
+
+func hexValue(s string) (*big.Int, bool) {
+	if s == "" {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 16)
+}
+
+// formatValue shows a printed value with its decimal reading.
+func formatValue(s string, width int, signed bool) string {
+	if s == "" {
+		return "<missing>"
+	}
+	v, ok := hexValue(s)
+	if !ok {
+		return s
+	}
+	if signed && width > 0 && v.Bit(width-1) == 1 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(width)))
+	}
+	return fmt.Sprintf("%s (%s)", s, v)
+}
+
+// bitRanges lists the set bits of mask from the top, e.g. "7:4,1".
+func bitRanges(mask *big.Int) string {
+	var parts []string
+	for i := mask.BitLen() - 1; i >= 0; i-- {
+		if mask.Bit(i) == 0 {
+			continue
+		}
+		j := i
+		for j > 0 && mask.Bit(j-1) == 1 {
+			j--
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(i))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d:%d", i, j))
+		}
+		i = j
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d *OutputDiff) String() string {
+	if d.First < 0 {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d cycles diverge, first at cycle %d\n", d.Diverged, d.Cycles, d.First)
+	if d.Compatible > 0 {
+		fmt.Fprintf(&sb, "%d records differ only in X/Z bits\n", d.Compatible)
+	}
+	for _, s := range d.Signals {
+		sign := "unsigned"
+		if s.Signed {
+			sign = "signed"
+		}
+		fmt.Fprintf(&sb, "%s (%d bits, %s): %d cycles differ, first at cycle %d", s.Signal, s.Width, sign, len(s.Cycles), s.Cycles[0].Cycle)
+		if s.Bits.Sign() != 0 {
+			fmt.Fprintf(&sb, ", bits %s", bitRanges(s.Bits))
+		}
+		sb.WriteString("\n")
+		for i, c := range s.Cycles {
+			if i == maxListedCycles {
+				fmt.Fprintf(&sb, "  ... %d more cycles\n", len(s.Cycles)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "  cycle %d: %s=%s %s=%s", c.Cycle,
+				d.LeftLabel, formatValue(c.Left, s.Width, s.Signed),
+				d.RightLabel, formatValue(c.Right, s.Width, s.Signed))
+			if l, ok := hexValue(c.Left); ok {
+				if r, ok := hexValue(c.Right); ok {
+					fmt.Fprintf(&sb, " bits %s", bitRanges(l.Xor(l, r)))
+				}
+			} else if mask := knownDiff(c.Left, c.Right); mask.Sign() != 0 {
+				fmt.Fprintf(&sb, " known bits %s", bitRanges(mask))
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// outputsMatch reports whether two output files agree record by record,
+// see compareRecords: observed signals one side left out do not count, and
+// with fourState X and Z digits match anything.
+func outputsMatch(left, right []byte, fourState bool) bool {
+	if bytes.Equal(left, right) {
+		return true
+	}
+	leftRecords, leftOther := parseOutputs(left)
+	rightRecords, rightOther := parseOutputs(right)
+	return compareRecords("", leftRecords, "", rightRecords, fourState).First < 0 &&
+		strings.Join(leftOther, "\n") == strings.Join(rightOther, "\n")
+}
+
+// diffOutputs reports how two output files differ, per signal and per bit.
+// Lines that are not records are compared as plain lines.
+func diffOutputs(leftLabel string, left []byte, rightLabel string, right []byte, fourState bool) string {
+	leftRecords, leftOther := parseOutputs(left)
+	rightRecords, rightOther := parseOutputs(right)
+	report := compareRecords(leftLabel, leftRecords, rightLabel, rightRecords, fourState).String()
+	if strings.Join(leftOther, "\n") != strings.Join(rightOther, "\n") {
+		report += diffLinesWithLabels(leftLabel, []byte(strings.Join(leftOther, "\n")),
+			rightLabel, []byte(strings.Join(rightOther, "\n")))
+	}
+	return report
+}
+
+// diffVariants checks the output of the equivalence testbench, where every
+// variant's signals carry an _eq<i> suffix, and reports the variants that
+// differ from the first one, with the comparison against the first of them.
+func diffVariants(data []byte) (string, []string, *OutputDiff) {
+	records, _ := parseOutputs(data)
+	variants := map[string][]OutputRecord{}
+	var order []string
+	for _, rec := range records {
+		name, variant, ok := cutVariant(rec.Signal)
+		if !ok {
+			continue
+		}
+		rec.Signal = name
+		if _, seen := variants[variant]; !seen {
+			order = append(order, variant)
+		}
+		variants[variant] = append(variants[variant], rec)
+	}
+
+	var sb strings.Builder
+	var differing []string
+	var first *OutputDiff
+	for _, variant := range order {
+		if variant == "eq0" {
+			continue
+		}
+		d := compareRecords("eq0", variants["eq0"], variant, variants[variant], false)
+		if d.First < 0 {
+			continue
+		}
+		differing = append(differing, variant)
+		if first == nil {
+			first = d
+		}
+		fmt.Fprintf(&sb, "\n==== eq0 vs %s ====\n%s", variant, d)
+	}
+	return sb.String(), differing, first
+}
+
+// cutVariant splits "out0_eq3" into "out0" and "eq3".
+func cutVariant(signal string) (string, string, bool) {
+	i := strings.LastIndex(signal, "_eq")
+	if i < 0 {
+		return "", "", false
+	}
+	if _, err := strconv.Atoi(signal[i+3:]); err != nil {
+		return "", "", false
+	}
+	return signal[:i], signal[i+1:], true
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func records(lines ...string) []OutputRecord {
+	out, _ := parseOutputs([]byte(strings.Join(lines, "\n")))
+	return out
+}
+
+func TestParseOutputs(t *testing.T) {
+	data := "cycle=3 signal=out0 width=22 signed=1 value=3ffff4\n\n" +
+		"mismatch at 3\n" +
+		"cycle=x signal=out0 width=22 signed=1 value=0\n" +
+		"cycle=4 signal=out0 width=22 signed=0\n" +
+		"cycle=4 signal=uut.r width=4 signed=0 value=xz\n"
+	recs, other := parseOutputs([]byte(data))
+	want := []OutputRecord{
+		{Cycle: 3, Signal: "out0", Width: 22, Signed: true, Value: "3ffff4"},
+		{Cycle: 4, Signal: "uut.r", Width: 4, Value: "xz"},
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("got %d records, want %d: %+v", len(recs), len(want), recs)
+	}
+	for i := range want {
+		if recs[i] != want[i] {
+			t.Errorf("record %d: got %+v, want %+v", i, recs[i], want[i])
+		}
+	}
+	wantOther := []string{
+		"mismatch at 3",
+		"cycle=x signal=out0 width=22 signed=1 value=0",
+		"cycle=4 signal=out0 width=22 signed=0",
+	}
+	if strings.Join(other, "\n") != strings.Join(wantOther, "\n") {
+		t.Errorf("other lines: got %q, want %q", other, wantOther)
+	}
+}
+
+func TestCompareRecords(t *testing.T) {
+	tests := []struct {
+		name        string
+		left, right []OutputRecord
+		fourState   bool
+		first       int
+		diverged    int
+		compatible  int
+		signals     []string
+	}{
+		{
+			name:  "equal",
+			left:  records("cycle=0 signal=a width=4 signed=0 value=3", "cycle=1 signal=a width=4 signed=0 value=4"),
+			right: records("cycle=1 signal=a width=4 signed=0 value=4", "cycle=0 signal=a width=4 signed=0 value=3"),
+			first: -1,
+		},
+		{
+			name:     "first divergence is the earliest cycle",
+			left:     records("cycle=2 signal=a width=4 signed=0 value=1", "cycle=5 signal=b width=4 signed=0 value=1", "cycle=7 signal=a width=4 signed=0 value=1"),
+			right:    records("cycle=2 signal=a width=4 signed=0 value=1", "cycle=5 signal=b width=4 signed=0 value=2", "cycle=7 signal=a width=4 signed=0 value=2"),
+			first:    5,
+			diverged: 2,
+			signals:  []string{"b", "a"},
+		},
+		{
+			name:     "missing on the right",
+			left:     records("cycle=0 signal=a width=4 signed=0 value=1", "cycle=1 signal=a width=4 signed=0 value=1"),
+			right:    records("cycle=0 signal=a width=4 signed=0 value=1"),
+			first:    1,
+			diverged: 1,
+			signals:  []string{"a"},
+		},
+		{
+			name:     "extra on the right",
+			left:     records("cycle=0 signal=a width=4 signed=0 value=1"),
+			right:    records("cycle=0 signal=a width=4 signed=0 value=1", "cycle=0 signal=b width=4 signed=0 value=1"),
+			first:    0,
+			diverged: 1,
+			signals:  []string{"b"},
+		},
+		{
+			name:       "X matches a concrete digit with fourState",
+			left:       records("cycle=0 signal=a width=8 signed=0 value=x3"),
+			right:      records("cycle=0 signal=a width=8 signed=0 value=53"),
+			fourState:  true,
+			first:      -1,
+			compatible: 1,
+		},
+		{
+			name:       "Z matches Z",
+			left:       records("cycle=0 signal=a width=8 signed=0 value=zZ"),
+			right:      records("cycle=0 signal=a width=8 signed=0 value=Zz"),
+			fourState:  true,
+			first:      -1,
+			compatible: 1,
+		},
+		{
+			name:      "known digits still differ",
+			left:      records("cycle=0 signal=a width=8 signed=0 value=x3"),
+			right:     records("cycle=0 signal=a width=8 signed=0 value=54"),
+			fourState: true,
+			first:     0,
+			diverged:  1,
+			signals:   []string{"a"},
+		},
+		{
+			name:     "X is a mismatch without fourState",
+			left:     records("cycle=0 signal=a width=8 signed=0 value=x3"),
+			right:    records("cycle=0 signal=a width=8 signed=0 value=53"),
+			first:    0,
+			diverged: 1,
+			signals:  []string{"a"},
+		},
+		{
+			name:  "observed signal left out by one side",
+			left:  records("cycle=0 signal=a width=4 signed=0 value=1", "cycle=0 signal=uut.r width=4 signed=0 value=7"),
+			right: records("cycle=0 signal=a width=4 signed=0 value=1"),
+			first: -1,
+		},
+		{
+			name:     "observed signal printed by both sides is compared",
+			left:     records("cycle=0 signal=uut.r width=4 signed=0 value=7"),
+			right:    records("cycle=0 signal=uut.r width=4 signed=0 value=6"),
+			first:    0,
+			diverged: 1,
+			signals:  []string{"uut.r"},
+		},
+	}
+	for _, tt := range tests {
+		d := compareRecords("l", tt.left, "r", tt.right, tt.fourState)
+		if d.First != tt.first || d.Diverged != tt.diverged || d.Compatible != tt.compatible {
+			t.Errorf("%s: first %d, diverged %d, compatible %d; want %d, %d, %d",
+				tt.name, d.First, d.Diverged, d.Compatible, tt.first, tt.diverged, tt.compatible)
+		}
+		var signals []string
+		for _, s := range d.Signals {
+			signals = append(signals, s.Signal)
+		}
+		if strings.Join(signals, ",") != strings.Join(tt.signals, ",") {
+			t.Errorf("%s: signals %v, want %v", tt.name, signals, tt.signals)
+		}
+	}
+}
+
+// The reference evaluator prints every observed signal; CXXRTL prints only
+// those it kept. That must not be a mismatch in a 2-state comparison.
+func TestOutputsMatchObservedOmitted(t *testing.T) {
+	reference := []byte("cycle=0 signal=out width=4 signed=0 value=3\n" +
+		"cycle=0 signal=uut.n1 width=4 signed=0 value=2\n" +
+		"cycle=1 signal=out width=4 signed=0 value=5\n" +
+		"cycle=1 signal=uut.n1 width=4 signed=0 value=4\n")
+	cxxrtl := []byte("cycle=0 signal=out width=4 signed=0 value=3\n" +
+		"cycle=1 signal=out width=4 signed=0 value=5\n")
+	if !outputsMatch(reference, cxxrtl, false) {
+		t.Error("omitted observed records count as a mismatch")
+	}
+	wrong := []byte("cycle=0 signal=out width=4 signed=0 value=3\n" +
+		"cycle=1 signal=out width=4 signed=0 value=6\n")
+	if outputsMatch(reference, wrong, false) {
+		t.Error("a differing output matches")
+	}
+	if outputsMatch(append([]byte("fatal\n"), cxxrtl...), cxxrtl, false) {
+		t.Error("differing plain lines match")
+	}
+}
+
+func TestOutputDiffString(t *testing.T) {
+	d := compareRecords("icarus", records(
+		"cycle=0 signal=out width=8 signed=1 value=fe",
+		"cycle=1 signal=out width=8 signed=1 value=10",
+		"cycle=1 signal=flag width=1 signed=0 value=1",
+	), "verilator", records(
+		"cycle=0 signal=out width=8 signed=1 value=fe",
+		"cycle=1 signal=out width=8 signed=1 value=80",
+	), false)
+	want := "1 of 2 cycles diverge, first at cycle 1\n" +
+		"out (8 bits, signed): 1 cycles differ, first at cycle 1, bits 7,4\n" +
+		"  cycle 1: icarus=10 (16) verilator=80 (-128) bits 7,4\n" +
+		"flag (1 bits, unsigned): 1 cycles differ, first at cycle 1\n" +
+		"  cycle 1: icarus=1 (1) verilator=<missing>\n"
+	if got := d.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value  string
+		width  int
+		signed bool
+		want   string
+	}{
+		{"ff", 8, false, "ff (255)"},
+		{"ff", 8, true, "ff (-1)"},
+		{"7f", 8, true, "7f (127)"},
+		{"3ffff4", 22, true, "3ffff4 (-12)"},
+		{"8", 4, true, "8 (-8)"},
+		{"x4", 8, true, "x4"},
+		{"", 8, true, "<missing>"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value, tt.width, tt.signed); got != tt.want {
+			t.Errorf("formatValue(%q, %d, %v) = %q, want %q", tt.value, tt.width, tt.signed, got, tt.want)
+		}
+	}
+}
+
+func TestBitRanges(t *testing.T) {
+	tests := []struct {
+		mask int64
+		want string
+	}{
+		{0, ""},
+		{1, "0"},
+		{0xf0, "7:4"},
+		{0xf2, "7:4,1"},
+		{0x5, "2,0"},
+	}
+	for _, tt := range tests {
+		if got := bitRanges(big.NewInt(tt.mask)); got != tt.want {
+			t.Errorf("bitRanges(%#x) = %q, want %q", tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestDiffVariants(t *testing.T) {
+	data := []byte("cycle=0 signal=out_eq0 width=4 signed=0 value=1\n" +
+		"cycle=0 signal=out_eq1 width=4 signed=0 value=1\n" +
+		"cycle=0 signal=out_eq2 width=4 signed=0 value=1\n" +
+		"cycle=1 signal=out_eq0 width=4 signed=0 value=2\n" +
+		"cycle=1 signal=out_eq1 width=4 signed=0 value=2\n" +
+		"cycle=1 signal=out_eq2 width=4 signed=0 value=3\n" +
+		"cycle=1 signal=other width=4 signed=0 value=9\n" +
+		"cycle=2 signal=out_eq0 width=4 signed=0 value=4\n" +
+		"cycle=2 signal=out_eq2 width=4 signed=0 value=4\n")
+	report, differing, first := diffVariants(data)
+	// eq1 has no record for cycle 2
+	if strings.Join(differing, ",") != "eq1,eq2" {
+		t.Fatalf("differing %v, want [eq1 eq2]", differing)
+	}
+	if first == nil || first.RightLabel != "eq1" || first.First != 2 {
+		t.Errorf("first diff %+v, want eq1 diverging at cycle 2", first)
+	}
+	for _, want := range []string{"==== eq0 vs eq1 ====", "==== eq0 vs eq2 ====", "cycle 1: eq0=2 (2) eq2=3 (3) bits 0"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+
+	if report, differing, first := diffVariants([]byte("cycle=0 signal=out_eq0 width=4 signed=0 value=1\n" +
+		"cycle=0 signal=out_eq1 width=4 signed=0 value=1\n")); report != "" || differing != nil || first != nil {
+		t.Errorf("equal variants: got %q, %v, %v", report, differing, first)
+	}
+}
+
+func TestCutVariant(t *testing.T) {
+	tests := []struct {
+		signal, name, variant string
+		ok                    bool
+	}{
+		{"out0_eq3", "out0", "eq3", true},
+		{"a_eq1_eq12", "a_eq1", "eq12", true},
+		{"out_equal", "", "", false},
+		{"out", "", "", false},
+	}
+	for _, tt := range tests {
+		name, variant, ok := cutVariant(tt.signal)
+		if name != tt.name || variant != tt.variant || ok != tt.ok {
+			t.Errorf("cutVariant(%q) = %q, %q, %v", tt.signal, name, variant, ok)
+		}
+	}
+}
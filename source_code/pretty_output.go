@@ -153,6 +153,10 @@ func PrettyBug(scope, msg string, details ...string) {
 	prettyBlock("BUG", ansiRed, formatScope(scope)+": "+msg, body)
 }
 
+func PrettySummary(title, body string) {
+	prettyBlock("DONE", ansiGreen, title, body)
+}
+
 func StartPrettyTicker(label string, interval time.Duration) {
 	if interval <= 0 {
 		interval = 10 * time.Second
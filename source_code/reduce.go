@@ -0,0 +1,638 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// reduceReportFileName says how a reduced case was obtained.
+const reduceReportFileName = "reduce.txt"
+
+// inlineTbFileName is the testbench of a reduced case with its stimulus
+// written out, for bug reports.
+const inlineTbFileName = "tb_inline.v"
+
+// Oracle is what a reduced case must keep doing to still show its bug:
+//
+//	pair:A,B       A and B give different outputs
+//	equiv:T        the variants differ in T's equivalence testbench
+//	reference:T    T's outputs differ from the reference evaluator
+//	crash[:T,...]  one of the tools fails with the signature in Bucket
+//	reject:T,...   T rejects the design with the message in Bucket and the
+//	               other frontends accept it
+type Oracle struct {
+	Kind  string
+	Tools []string
+	// Bucket is the signature bucket a crash or rejection must keep.
+	Bucket string
+	// Frontend runs the tools of a crash as frontends.
+	Frontend bool
+}
+
+func (o Oracle) String() string {
+	if len(o.Tools) == 0 {
+		return o.Kind
+	}
+	return o.Kind + ":" + strings.Join(o.Tools, ",")
+}
+
+func parseOracle(spec string) (Oracle, error) {
+	kind, list, _ := strings.Cut(spec, ":")
+	o := Oracle{Kind: kind}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			o.Tools = append(o.Tools, name)
+		}
+	}
+	switch kind {
+	case "pair", "equiv", "reference":
+		want := map[string]int{"pair": 2, "equiv": 1, "reference": 1}[kind]
+		if len(o.Tools) != want {
+			return o, fmt.Errorf("oracle %s takes %d simulator(s)", kind, want)
+		}
+	case "crash":
+	case "reject":
+		if len(o.Tools) < 2 {
+			return o, errors.New("oracle reject takes the rejecting frontend and at least one that accepts")
+		}
+		if _, err := parseFrontends(o.Tools); err != nil {
+			return o, err
+		}
+		return o, nil
+	default:
+		return o, fmt.Errorf("unknown oracle: %s (have pair, equiv, reference, crash, reject)", kind)
+	}
+	if _, err := parseBackends(strings.Join(o.Tools, ",")); err != nil {
+		return o, err
+	}
+	return o, nil
+}
+
+// RunReduce implements `VeriEQ reduce`: it rebuilds a saved case from its
+// seed and shrinks it by editing the generated AST, keeping every edit after
+// which the oracle still holds. The reduced files go to -out.
+func RunReduce(args []string) {
+	fs := flag.NewFlagSet("reduce", flag.ExitOnError)
+	casePath := fs.String("case", "", "case.json of a saved bug, or its directory")
+	oracleSpec := fs.String("oracle", "", "What the reduced case must keep doing: pair:A,B | equiv:T | reference:T | crash[:T,...] | reject:T,U,... (default: what the saved case did)")
+	configPath := fs.String("config", "", "Path to config file")
+	compileLimit := fs.Duration("compile-timeout", compileTimeout, "Default limit for elaboration and C++ builds")
+	runLimit := fs.Duration("run-timeout", runTimeout, "Default limit for one simulation run")
+	maxTests := fs.Int("max-tests", 0, "Stop after this many oracle runs (0 = until no edit is kept)")
+	passList := fs.String("passes", strings.Join(CodeGenerator.ReducePasses, ","), "Comma-separated passes to run, e.g. cycles,stimulus to only reduce the input vectors")
+	outDir := fs.String("out", "", "Directory for the reduced case (default: reduced/ next to case.json)")
+	_ = fs.Parse(args)
+
+	path, base, orig := loadSavedCase("reduce", *casePath)
+	caseDir := filepath.Dir(path)
+	design := orig.Generator.Design
+	cfg, err := LoadToolConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config load warning: %v\n", err)
+	}
+	toolConfig = cfg
+	compileTimeout = *compileLimit
+	runTimeout = *runLimit
+	if err := toolConfig.validateTimeouts(); err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	if *outDir == "" {
+		*outDir = filepath.Join(caseDir, "reduced")
+	}
+
+	work, err := os.MkdirTemp("", "veq_reduce_")
+	if err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	defer os.RemoveAll(work)
+
+	r := &reducer{base: base, design: design, work: work, maxTests: *maxTests, results: map[string]bool{}}
+	for _, name := range strings.Split(*passList, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !containsString(CodeGenerator.ReducePasses, name) {
+			PrettyErr("reduce", fmt.Sprintf("unknown pass: %s (have %s)", name, strings.Join(CodeGenerator.ReducePasses, ", ")))
+			os.Exit(1)
+		}
+		r.passes = append(r.passes, name)
+	}
+	if *oracleSpec != "" {
+		r.oracle, err = parseOracle(*oracleSpec)
+	} else {
+		r.oracle, err = r.detectOracle(caseDir)
+	}
+	if err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	r.check = r.oracle.holds
+	PrettyInfo("reduce", fmt.Sprintf("seed %d, oracle %s", base.Seed, r.oracle))
+	ok, err := r.start()
+	if err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	if !ok {
+		PrettyErr("reduce", fmt.Sprintf("the regenerated case does not satisfy oracle %s", r.oracle))
+		os.Exit(1)
+	}
+	before, beforeText, beforeVectors := design.Size(), len(design.String()), len(design.Stimulus)
+	if err := r.reduce(); err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	// no case.json: its seed would rebuild the unreduced case
+	if err := r.write(*outDir); err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "case: %s\nseed: %d\noracle: %s\n", path, base.Seed, r.oracle)
+	if r.oracle.Bucket != "" {
+		fmt.Fprintf(&sb, "bucket: %s\n", r.oracle.Bucket)
+	}
+	fmt.Fprintf(&sb, "tests: %d\nverilog: %d -> %d bytes\nsize: %d -> %d\nvectors: %d -> %d\n", r.tests, beforeText, len(design.String()), before, design.Size(), beforeVectors, len(design.Stimulus))
+	sb.WriteString("kept edits:\n")
+	for _, desc := range r.kept {
+		fmt.Fprintf(&sb, "  %s\n", desc)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, reduceReportFileName), []byte(sb.String()), 0o644); err != nil {
+		PrettyErr("reduce", err.Error())
+		os.Exit(1)
+	}
+	PrettyOK("reduce", fmt.Sprintf("%d -> %d bytes of Verilog in %d tests, written to %s", beforeText, len(design.String()), r.tests, *outDir))
+}
+
+// loadSavedCase reads the case.json at path, or in the directory path, and
+// rebuilds the case from its seed, with the stimulus set in its design.
+func loadSavedCase(cmd, path string) (string, *TestCase, *TestCase) {
+	if path == "" {
+		PrettyErr(cmd, "need -case")
+		os.Exit(1)
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, caseFileName)
+	}
+	base, err := LoadTestCase(path)
+	if err != nil {
+		PrettyErr(cmd, err.Error())
+		os.Exit(1)
+	}
+	if !isFuzzTarget(base.Fuzzer) {
+		PrettyErr(cmd, fmt.Sprintf("unknown fuzzer: %s", base.Fuzzer))
+		os.Exit(1)
+	}
+	f := &Fuzzer{
+		EnableDiffSim: base.DiffSim,
+		Reference:     base.Reference,
+		Frontends:     base.Frontends,
+		Backends:      base.Backends,
+		GenOptions: CodeGenerator.GeneratorOptions{
+			UsePaperInitGen:        base.PaperInitGen,
+			EnableControlFlowEquiv: base.ControlFlowEquiv,
+			EnableXInputs:          base.XInputs,
+			EnableObservability:    base.Observe,
+		},
+		TestFileName:  "test.v",
+		TestBenchName: "tb.v",
+	}
+	orig := f.NewTestCase(base.Fuzzer, base.Seed, base.EqualNumber, base.Backends)
+	if err := orig.Generator.Design.SetInput(orig.Input); err != nil {
+		PrettyErr(cmd, err.Error())
+		os.Exit(1)
+	}
+	return path, base, orig
+}
+
+// reducer holds the design being reduced. Edits are made in place and
+// taken back when the oracle stops holding.
+type reducer struct {
+	base   *TestCase
+	design *CodeGenerator.Design
+	oracle Oracle
+	// check decides the oracle on a case written into a directory.
+	check    func(tc *TestCase, dir string) (ok, unknown bool)
+	work     string
+	tests    int
+	maxTests int
+	// results caches the oracle by rendered case.
+	results map[string]bool
+	// unknown is set when the unreduced outputs hold X or Z digits; if not,
+	// a candidate whose outputs gain them does not count.
+	unknown bool
+	size    int
+	kept    []string
+	passes  []string
+}
+
+// render prints the current design with the testbenches and files of the
+// case being reduced.
+func (r *reducer) render() *TestCase {
+	g := CodeGenerator.NewExpressionGeneratorWithSeed(r.base.Seed, CodeGenerator.GeneratorOptions{
+		UsePaperInitGen:        r.base.PaperInitGen,
+		EnableControlFlowEquiv: r.base.ControlFlowEquiv,
+		EnableXInputs:          r.base.XInputs,
+		EnableObservability:    r.base.Observe,
+	})
+	g.LoadDesign(r.design)
+	tc := &TestCase{
+		Seed:             r.base.Seed,
+		Fuzzer:           r.base.Fuzzer,
+		EqualNumber:      len(r.design.Variants),
+		DiffSim:          r.base.DiffSim || (r.oracle.Kind == "pair" && r.base.Fuzzer != "fuzz"),
+		Backends:         r.base.Backends,
+		PaperInitGen:     r.base.PaperInitGen,
+		ControlFlowEquiv: r.base.ControlFlowEquiv,
+		XInputs:          r.base.XInputs,
+		Observe:          r.base.Observe,
+		Reference:        r.base.Reference || r.oracle.Kind == "reference",
+		Frontends:        r.base.Frontends,
+		Generator:        g,
+	}
+	tc.add("test.v", r.design.String())
+	tc.addBenches("tb.v")
+	tc.finish(r.design.Input())
+	return tc
+}
+
+// write puts the current design with its files into dir, and a testbench
+// with the stimulus inlined that runs the modules the oracle looks at.
+func (r *reducer) write(dir string) error {
+	tc := r.render()
+	var tops []string
+	switch {
+	case r.design.Single:
+		tops = []string{r.design.Name}
+	case r.oracle.Kind == "pair" || r.oracle.Kind == "reference":
+		tops = []string{r.design.Name + "_eq0"}
+	default:
+		for i := range r.design.Variants {
+			tops = append(tops, fmt.Sprintf("%s_eq%d", r.design.Name, i))
+		}
+	}
+	tc.add(inlineTbFileName, tc.Generator.GenerateInlineTb(tops...))
+	return tc.writeFiles(dir)
+}
+
+// start checks the oracle on the unreduced design.
+func (r *reducer) start() (bool, error) {
+	tc := r.render()
+	ok, unknown, err := r.run(tc)
+	if err != nil {
+		return false, err
+	}
+	r.unknown = unknown
+	r.size = r.design.Size()
+	r.results[caseKey(tc)] = ok
+	return ok, nil
+}
+
+func caseKey(tc *TestCase) string {
+	var sb strings.Builder
+	for _, file := range tc.Files {
+		sb.WriteString(file.Name + "\x00" + file.Data + "\x00")
+	}
+	return sb.String()
+}
+
+func (r *reducer) budgetSpent() bool {
+	return r.maxTests > 0 && r.tests >= r.maxTests
+}
+
+// test reports whether the current design is smaller than the last one kept
+// and still satisfies the oracle.
+func (r *reducer) test() (bool, error) {
+	if r.design.Size() >= r.size {
+		return false, nil
+	}
+	return r.holds()
+}
+
+// holds reports whether the current design satisfies the oracle.
+func (r *reducer) holds() (bool, error) {
+	tc := r.render()
+	key := caseKey(tc)
+	if ok, seen := r.results[key]; seen {
+		return ok, nil
+	}
+	ok, unknown, err := r.run(tc)
+	if err != nil {
+		return false, err
+	}
+	if unknown && !r.unknown {
+		ok = false
+	}
+	r.results[key] = ok
+	return ok, nil
+}
+
+// run writes tc into a scratch directory and checks the oracle on it. A
+// case that cannot be written is an error, not an uninteresting case.
+func (r *reducer) run(tc *TestCase) (ok, unknown bool, err error) {
+	r.tests++
+	dir := filepath.Join(r.work, strconv.Itoa(r.tests))
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, false, err
+	}
+	if err := tc.writeFiles(dir); err != nil {
+		return false, false, err
+	}
+	ok, unknown = r.check(tc, dir)
+	return ok, unknown, nil
+}
+
+// reduce runs the passes in turn until a round keeps no edit or the test
+// budget is spent.
+func (r *reducer) reduce() error {
+	for round := 1; ; round++ {
+		progress := false
+		for _, pass := range r.passes {
+			kept, err := r.pass(pass)
+			if err != nil {
+				return err
+			}
+			if kept {
+				progress = true
+			}
+			if r.budgetSpent() {
+				return nil
+			}
+		}
+		if !progress {
+			return nil
+		}
+	}
+}
+
+// pass applies the edits of one pass in chunks, halving the chunk size down
+// to single edits, and keeps every chunk after which the oracle holds.
+func (r *reducer) pass(name string) (bool, error) {
+	edits := r.design.Edits(name)
+	kept := 0
+	for size := max(len(edits)/2, 1); len(edits) > 0; size /= 2 {
+		for start := 0; start < len(edits) && !r.budgetSpent(); start += size {
+			var undos []func()
+			var descs []string
+			for _, e := range edits[start:min(start+size, len(edits))] {
+				if undo := e.Apply(); undo != nil {
+					undos = append(undos, undo)
+					descs = append(descs, name+": "+e.Desc)
+				}
+			}
+			if len(undos) == 0 {
+				continue
+			}
+			ok, err := r.test()
+			if ok {
+				r.size = r.design.Size()
+				r.kept = append(r.kept, descs...)
+				kept += len(undos)
+				continue
+			}
+			for i := len(undos) - 1; i >= 0; i-- {
+				undos[i]()
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		if size == 1 || r.budgetSpent() {
+			break
+		}
+	}
+	PrettyInfo("reduce", fmt.Sprintf("%s: kept %d of %d edits, %d bytes, %d tests", name, kept, len(edits), len(r.design.String()), r.tests))
+	return kept > 0, nil
+}
+
+// detectOracle works out what the saved case did. The signature it was
+// filed under tells crashes and rejections; a mismatch is looked for again
+// the way the fuzzer looked for it.
+func (r *reducer) detectOracle(caseDir string) (Oracle, error) {
+	if data, err := os.ReadFile(filepath.Join(caseDir, signatureFileName)); err == nil {
+		var sig Signature
+		if err := json.Unmarshal(data, &sig); err != nil {
+			return Oracle{}, fmt.Errorf("%s: %w", signatureFileName, err)
+		}
+		switch sig.Kind {
+		case "crash", "hang", "resource":
+			o := Oracle{Kind: "crash", Bucket: sig.Bucket()}
+			if sig.Phase == PhaseFrontend {
+				o.Tools, o.Frontend = []string{sig.Tool}, true
+			} else if _, ok := simulators[sig.Tool]; ok {
+				o.Tools = []string{sig.Tool}
+			}
+			return o, nil
+		case "rejection":
+			o := Oracle{Kind: "reject", Tools: []string{sig.Tool}, Bucket: sig.Bucket()}
+			frontends := r.base.Frontends
+			if len(frontends) == 0 {
+				frontends = defaultFrontends
+			}
+			for _, name := range frontends {
+				if name != sig.Tool {
+					o.Tools = append(o.Tools, name)
+				}
+			}
+			return o, nil
+		}
+	}
+
+	tc := r.render()
+	r.tests++
+	dir := filepath.Join(r.work, "detect")
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Oracle{}, err
+	}
+	if err := tc.writeFiles(dir); err != nil {
+		return Oracle{}, err
+	}
+	sims := r.base.Backends
+	if tc.Fuzzer != "fuzz" {
+		sims = append([]string{tc.Fuzzer}, sims...)
+	}
+	job := tc.outputJob(dir)
+	if tc.Fuzzer == "fuzz" || tc.DiffSim {
+		outputs := make([][]byte, len(sims))
+		for i, name := range sims {
+			data, err := simulateNamed(name, job, tc.Input)
+			if err != nil {
+				return Oracle{}, fmt.Errorf("%s fails on the case (%v); reduce it with -oracle crash", name, err)
+			}
+			outputs[i] = data
+		}
+		for i := range sims {
+			for j := i + 1; j < len(sims); j++ {
+				if !outputsMatch(outputs[i], outputs[j], tc.XInputs) {
+					return Oracle{Kind: "pair", Tools: []string{sims[i], sims[j]}}, nil
+				}
+			}
+		}
+		for i, name := range sims {
+			if tc.Expected != "" && !outputsMatch([]byte(tc.Expected), outputs[i], false) {
+				return Oracle{Kind: "reference", Tools: []string{name}}, nil
+			}
+		}
+		return Oracle{}, errors.New("no mismatch: the case does not reproduce")
+	}
+	data, err := simulateNamed(tc.Fuzzer, tc.EquivJob(dir), tc.Input)
+	if err != nil {
+		return Oracle{}, fmt.Errorf("%s fails on the case (%v); reduce it with -oracle crash", tc.Fuzzer, err)
+	}
+	if _, differing, _ := diffVariants(data); len(differing) > 0 {
+		return Oracle{Kind: "equiv", Tools: []string{tc.Fuzzer}}, nil
+	}
+	if tc.Expected != "" {
+		if data, err := simulateNamed(tc.Fuzzer, job, tc.Input); err == nil && !outputsMatch([]byte(tc.Expected), data, false) {
+			return Oracle{Kind: "reference", Tools: []string{tc.Fuzzer}}, nil
+		}
+	}
+	return Oracle{}, errors.New("no mismatch: the case does not reproduce")
+}
+
+// outputJob is the job whose output the simulators are compared on.
+func (tc *TestCase) outputJob(dir string) SimJob {
+	if tc.Fuzzer == "fuzz" {
+		return tc.FuzzJob(dir)
+	}
+	return tc.DiffJob(dir)
+}
+
+// crashJobs are the jobs the fuzzer runs the case's simulators on.
+func (tc *TestCase) crashJobs(dir string) []SimJob {
+	if tc.Fuzzer == "fuzz" {
+		return []SimJob{tc.FuzzJob(dir)}
+	}
+	var jobs []SimJob
+	if !tc.DiffSim {
+		jobs = append(jobs, tc.EquivJob(dir))
+	}
+	if tc.DiffSim || tc.Reference {
+		jobs = append(jobs, tc.DiffJob(dir))
+	}
+	return jobs
+}
+
+// simulateNamed runs job on the named simulator without filing failures.
+func simulateNamed(name string, job SimJob, input string) ([]byte, error) {
+	sim, err := NewSimulator(name)
+	if err != nil {
+		return nil, err
+	}
+	return runSimulator(sim, job, input)
+}
+
+// holds checks the oracle on the case written into dir. unknown is set when
+// compared outputs hold X or Z digits. A tool failure the oracle is not
+// about means it does not hold.
+func (o Oracle) holds(tc *TestCase, dir string) (ok, unknown bool) {
+	switch o.Kind {
+	case "pair":
+		job := tc.outputJob(dir)
+		a, err := simulateNamed(o.Tools[0], job, tc.Input)
+		if err != nil {
+			return false, false
+		}
+		b, err := simulateNamed(o.Tools[1], job, tc.Input)
+		if err != nil {
+			return false, false
+		}
+		return !outputsMatch(a, b, tc.XInputs), anyUnknown(a) || anyUnknown(b)
+	case "equiv":
+		data, err := simulateNamed(o.Tools[0], tc.EquivJob(dir), tc.Input)
+		if err != nil {
+			return false, false
+		}
+		_, differing, _ := diffVariants(data)
+		return len(differing) > 0, anyUnknown(data)
+	case "reference":
+		if tc.Expected == "" {
+			return false, false
+		}
+		data, err := simulateNamed(o.Tools[0], tc.outputJob(dir), tc.Input)
+		if err != nil {
+			return false, false
+		}
+		return !outputsMatch([]byte(tc.Expected), data, false), anyUnknown(data)
+	case "crash":
+		return o.crashes(tc, dir), false
+	case "reject":
+		job := tc.outputJob(dir)
+		for i, name := range o.Tools {
+			err := runFrontend(name, job)
+			if i > 0 {
+				if err != nil {
+					return false, false
+				}
+				continue
+			}
+			var toolErr *ToolError
+			if !errors.As(err, &toolErr) {
+				return false, false
+			}
+			msg, ok := rejection(toolErr)
+			if !ok || (o.Bucket != "" && (Signature{Kind: "rejection", Tool: name, Phase: PhaseFrontend, Message: msg}).Bucket() != o.Bucket) {
+				return false, false
+			}
+		}
+		return true, false
+	}
+	return false, false
+}
+
+// crashes reports whether a tool of the oracle, or of the case's flow when
+// it names none, fails with the signature of the oracle.
+func (o Oracle) crashes(tc *TestCase, dir string) bool {
+	bucket := func(err error) string {
+		var toolErr *ToolError
+		if !errors.As(err, &toolErr) {
+			return ""
+		}
+		return crashSignature(toolErr).Bucket()
+	}
+	if o.Frontend {
+		b := bucket(runFrontend(o.Tools[0], tc.outputJob(dir)))
+		return b != "" && (o.Bucket == "" || b == o.Bucket)
+	}
+	tools := o.Tools
+	if len(tools) == 0 {
+		tools = tc.Backends
+		if tc.Fuzzer != "fuzz" {
+			tools = append([]string{tc.Fuzzer}, tools...)
+		}
+	}
+	for _, job := range tc.crashJobs(dir) {
+		for _, name := range tools {
+			_, err := simulateNamed(name, job, tc.Input)
+			if b := bucket(err); b != "" && (o.Bucket == "" || b == o.Bucket) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyUnknown(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		if hasUnknown(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestReducer(t *testing.T, check func(tc *TestCase, dir string) (ok, unknown bool)) *reducer {
+	t.Helper()
+	f := &Fuzzer{TestFileName: "test.v", TestBenchName: "tb.v"}
+	tc := f.NewTestCase("fuzz", 1, 0, nil)
+	if err := tc.Generator.Design.SetInput(tc.Input); err != nil {
+		t.Fatal(err)
+	}
+	return &reducer{
+		base:    tc,
+		design:  tc.Generator.Design,
+		check:   check,
+		work:    t.TempDir(),
+		passes:  CodeGenerator.ReducePasses,
+		results: map[string]bool{},
+	}
+}
+
+// The stub oracle holds while test.v still uses wire_4, as if the bug
+// were in its definition.
+func TestReduceWithStubOracle(t *testing.T) {
+	check := func(tc *TestCase, dir string) (bool, bool) {
+		data, err := os.ReadFile(filepath.Join(dir, "test.v"))
+		return err == nil && strings.Contains(string(data), "wire_4"), false
+	}
+	r := newTestReducer(t, check)
+	before := len(r.design.String())
+	if ok, err := r.start(); err != nil || !ok {
+		t.Fatalf("start: %v, %v", ok, err)
+	}
+	if err := r.reduce(); err != nil {
+		t.Fatal(err)
+	}
+	after := r.design.String()
+	t.Logf("%d -> %d bytes in %d tests", before, len(after), r.tests)
+	if !strings.Contains(after, "wire_4") {
+		t.Errorf("the reduced design lost wire_4:\n%s", after)
+	}
+	if len(after) > before/4 || len(r.kept) == 0 {
+		t.Errorf("%d -> %d bytes with %d kept edits", before, len(after), len(r.kept))
+	}
+	// nothing the oracle could not tell apart is left to cut
+	if ok, err := r.holds(); err != nil || !ok {
+		t.Errorf("the reduced design does not hold: %v, %v", ok, err)
+	}
+	if kept, err := r.pass("statements"); err != nil || kept {
+		t.Errorf("another statements pass keeps edits: %v, %v", kept, err)
+	}
+
+	out := t.TempDir()
+	if err := r.write(out); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"test.v", "tb.v", "input.txt", inlineTbFileName} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReduceScratchError(t *testing.T) {
+	checked := false
+	r := newTestReducer(t, func(*TestCase, string) (bool, bool) {
+		checked = true
+		return true, false
+	})
+	// the scratch directory cannot be created below a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r.work = file
+	if ok, err := r.start(); err == nil || ok {
+		t.Errorf("start: %v, %v; want an error", ok, err)
+	}
+	if checked {
+		t.Error("the oracle ran without the case written")
+	}
+}
+
+func TestReduceKeepsObservability(t *testing.T) {
+	f := &Fuzzer{TestFileName: "test.v", TestBenchName: "tb.v",
+		GenOptions: CodeGenerator.GeneratorOptions{EnableObservability: true}}
+	tc := f.NewTestCase("fuzz", 1, 0, nil)
+	if len(tc.Signals) == 0 {
+		t.Fatal("the -observe case has no observed signals")
+	}
+	r := &reducer{base: tc, design: tc.Generator.Design}
+	if got := r.render(); !got.Observe || len(got.Signals) != len(tc.Signals) {
+		t.Errorf("rendered with observe=%v and %d signals, want true and %d", got.Observe, len(got.Signals), len(tc.Signals))
+	}
+}
+
+// The reference oracle compares like the fuzzer does: an output that only
+// differs from the expected one by blank lines is not a mismatch.
+func TestReferenceOracle(t *testing.T) {
+	withCampaignDirs(t)
+	tc := (&Fuzzer{TestFileName: "test.v", TestBenchName: "tb.v"}).NewTestCase("fuzz", 1, 0, nil)
+	tc.Expected = "cycle=0 signal=out0 width=8 signed=0 value=1\n\n"
+	tests := []struct {
+		tool string
+		want bool
+	}{
+		{"stub-a", false},
+		{"stub-c", true},
+	}
+	for _, tt := range tests {
+		if ok, _ := (Oracle{Kind: "reference", Tools: []string{tt.tool}}).holds(tc, t.TempDir()); ok != tt.want {
+			t.Errorf("%s: holds = %v, want %v", tt.tool, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const referenceFileName = "reference_output.txt"
+
+// checkReference compares the output of every simulator in sims with what
+// the reference evaluator expects. When some deviate it writes
+// reference_diff.txt naming them and returns them. This catches the bugs
+// every simulator shares, which no pairwise comparison can see.
+func checkReference(tc *TestCase, dir string, sims []string, outputs [][]byte) []string {
+	if tc.Expected == "" {
+		return nil
+	}
+	expected := []byte(tc.Expected)
+	var deviated []string
+	var sb strings.Builder
+	for i, name := range sims {
+		// the evaluator prints every observed signal, CXXRTL only those it
+		// kept
+		if outputsMatch(expected, outputs[i], false) {
+			continue
+		}
+		deviated = append(deviated, name)
+		fmt.Fprintf(&sb, "\n==== reference vs %s Diff ====\n", name)
+		sb.WriteString(tc.outputDiff("reference", expected, name, outputs[i]))
+	}
+	if len(deviated) > 0 {
+		content := fmt.Sprintf("deviating from reference: %s\n", strings.Join(deviated, ", ")) + sb.String()
+		_ = os.WriteFile(filepath.Join(dir, "reference_diff.txt"), []byte(content), 0o644)
+	}
+	return deviated
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// RunReplay implements `VeriEQ replay`: it rebuilds one test case from its
+// seed and either writes the files out or reruns it against its backend.
+func RunReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	seed := fs.Int64("seed", 0, "Seed of the test case to rebuild")
+	fuzzer := fs.String("fuzzer", "verilator", "Flow the case came from: a simulator name or fuzz")
+	count := fs.Int("count", 5, "Number of equivalent test cases")
+	casePath := fs.String("case", "", "case.json of a saved bug; overrides -seed, -fuzzer, -count and the generator flags")
+	configPath := fs.String("config", "", "Path to config file")
+	controlFlowEquiv := fs.Bool("control-flow-equiv", controlFlowEquivEnabled, "Enable control-flow equivalence transformations")
+	xInputs := fs.Bool("x-input", xInputEnabled, "Enable X-valued inputs in testbench")
+	diffSim := fs.Bool("diff-sim", diffSimEnabled, "Also cross-check the first module on the backends")
+	observe := fs.Bool("observe", observeEnabled, "Also print every internal signal in the output testbenches")
+	reference := fs.Bool("reference", referenceEnabled, "Also check outputs against the reference evaluator")
+	waveform := fs.Bool("waveform", waveformEnabled, "Dump and diff VCD waveforms when the case reproduces")
+	backends := fs.String("backends", "", "Comma-separated simulators to compare against (default: from config)")
+	compileLimit := fs.Duration("compile-timeout", compileTimeout, "Default limit for elaboration and C++ builds")
+	runLimit := fs.Duration("run-timeout", runTimeout, "Default limit for one simulation run")
+	outDir := fs.String("out", "", "Only write the regenerated files into this directory")
+	_ = fs.Parse(args)
+
+	seedSet := false
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "seed" {
+			seedSet = true
+		}
+	})
+	tc := &TestCase{
+		Seed:             *seed,
+		Fuzzer:           *fuzzer,
+		EqualNumber:      *count,
+		DiffSim:          *diffSim,
+		PaperInitGen:     paperInitGenEnabled,
+		ControlFlowEquiv: *controlFlowEquiv,
+		XInputs:          *xInputs,
+		Observe:          *observe,
+		Reference:        *reference && !*xInputs,
+	}
+	if *casePath != "" {
+		loaded, err := LoadTestCase(*casePath)
+		if err != nil {
+			PrettyErr("replay", err.Error())
+			os.Exit(1)
+		}
+		tc = loaded
+	} else if !seedSet {
+		PrettyErr("replay", "need -seed or -case")
+		os.Exit(1)
+	}
+	if !isFuzzTarget(tc.Fuzzer) {
+		PrettyErr("replay", fmt.Sprintf("unknown fuzzer: %s", tc.Fuzzer))
+		os.Exit(1)
+	}
+
+	cfg, err := LoadToolConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config load warning: %v\n", err)
+	}
+	toolConfig = cfg
+	compileTimeout = *compileLimit
+	runTimeout = *runLimit
+	if err := toolConfig.validateTimeouts(); err != nil {
+		PrettyErr("replay", err.Error())
+		os.Exit(1)
+	}
+	if *backends != "" {
+		list, err := parseBackends(*backends)
+		if err != nil {
+			PrettyErr("replay", err.Error())
+			os.Exit(1)
+		}
+		backendsOverride = list
+	}
+	if *casePath == "" || *backends != "" {
+		tc.Backends = backendsFor(tc.Fuzzer)
+	}
+	generatorOptions = CodeGenerator.GeneratorOptions{
+		UsePaperInitGen:        tc.PaperInitGen,
+		EnableControlFlowEquiv: tc.ControlFlowEquiv,
+		EnableXInputs:          tc.XInputs,
+		EnableObservability:    tc.Observe,
+	}
+
+	if *outDir != "" {
+		f := &Fuzzer{
+			EnableDiffSim: tc.DiffSim,
+			Reference:     tc.Reference,
+			Frontends:     tc.Frontends,
+			Backends:      tc.Backends,
+			GenOptions:    generatorOptions,
+			TestFileName:  "test.v",
+			TestBenchName: "tb.v",
+		}
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			PrettyErr("replay", err.Error())
+			os.Exit(1)
+		}
+		if err := f.NewTestCase(tc.Fuzzer, tc.Seed, tc.EqualNumber, tc.Backends).Write(*outDir); err != nil {
+			PrettyErr("replay", err.Error())
+			os.Exit(1)
+		}
+		PrettyOK("replay", fmt.Sprintf("seed %d written to %s", tc.Seed, *outDir))
+		return
+	}
+
+	f := &Fuzzer{
+		StartTime:     time.Now().UnixMilli(),
+		EnableDiffSim: tc.DiffSim,
+		Reference:     tc.Reference,
+		Waveform:      *waveform,
+		Frontends:     tc.Frontends,
+		Backends:      tc.Backends,
+		GenOptions:    generatorOptions,
+	}
+	f.Init()
+	bugsBefore := atomic.LoadInt64(&countBugs) + atomic.LoadInt64(&countRejections)
+	crashesBefore := atomic.LoadInt64(&countCrashes)
+	hangsBefore := atomic.LoadInt64(&countHangs) + atomic.LoadInt64(&countResource)
+	PrettyInfo("replay", fmt.Sprintf("fuzzer=%s seed=%d count=%d", tc.Fuzzer, tc.Seed, tc.EqualNumber))
+	f.RunCase(tc.Fuzzer, tc.Seed, tc.EqualNumber)
+	if err := os.RemoveAll(f.TmpDir); err != nil {
+		PrettyErr("replay", err.Error())
+	}
+	if atomic.LoadInt64(&countBugs)+atomic.LoadInt64(&countRejections) > bugsBefore || atomic.LoadInt64(&countCrashes) > crashesBefore ||
+		atomic.LoadInt64(&countHangs)+atomic.LoadInt64(&countResource) > hangsBefore {
+		PrettyBug("replay", "reproduced", "saved: "+f.CrashDir)
+		os.Exit(1)
+	}
+	PrettyOK("replay", "not reproduced")
+}
@@ -1,111 +1,43 @@
 package main
 
-import (
-	"fmt"
-	"os"
-	"sync/atomic"
-	"time"
-)
-
-func RunSelectedFuzzer(name string, count, threads int) {
-	PrettyRunHeader(name, count, threads)
-	switch name {
-	case "iverilog":
-		go EqualFuzzIverilog(threads, count, diffSimEnabled)
-	case "verilator":
-		go EqualFuzzVerilator(threads, count, diffSimEnabled)
-	case "yosys":
-		go EqualFuzzYosysOpt(threads, count, diffSimEnabled)
-	case "cxxrtl":
-		go EqualFuzzCXXRTL(threads, count, diffSimEnabled)
-	default:
-		fmt.Fprintf(os.Stdout, "Unknown fuzzer: %s\n", name)
-		os.Exit(1)
-	}
-	for {
-
-	}
+import "time"
+
+// RunSelectedFuzzer runs the targets on one shared worker pool until the
+// campaign stops.
+func RunSelectedFuzzer(targets []TargetSpec, count int, campaign *Campaign, adaptive bool, rebalance time.Duration) {
+	name := formatTargets(targets)
+	scheduler := NewScheduler(targets, diffSimEnabled, campaign.ID)
+	PrettyRunHeader(name, count, scheduler.workers)
+	scheduler.Run(campaign, count, adaptive, rebalance)
+	campaign.finish(name, scheduler.Fuzzers()...)
 }
 
-func EqualFuzzIverilog(workersPerType, equalNumber int, diffSim bool) {
-	fuzzerIcarus := &Fuzzer{
-		StartTime:     time.Now().UnixMilli(),
-		EnableDiffSim: diffSim,
-	}
-	fuzzerIcarus.Init()
-	tasks := make(chan struct{})
-	for i := 0; i < workersPerType; i++ {
-		go func() {
-			for range tasks {
-				fuzzerIcarus.TestEqualModulesIcarus(equalNumber)
-				atomic.AddInt64(&countIverilog, int64(equalNumber))
-			}
-		}()
-	}
-	for {
-		tasks <- struct{}{}
-	}
+// isFuzzTarget reports whether name is a registered simulator or "fuzz".
+func isFuzzTarget(name string) bool {
+	_, ok := simulators[name]
+	return ok || name == "fuzz"
 }
 
-func EqualFuzzVerilator(workersPerType, equalNumber int, diffSim bool) {
-	fuzzerVerilator := &Fuzzer{
-		StartTime:     time.Now().UnixMilli(),
-		EnableDiffSim: diffSim,
-	}
-	fuzzerVerilator.Init()
-	tasks := make(chan struct{})
-	for i := 0; i < workersPerType; i++ {
-		go func() {
-			for range tasks {
-				fuzzerVerilator.TestEqualModulesVerilator(equalNumber)
-				atomic.AddInt64(&countVerilator, int64(equalNumber))
-			}
-		}()
-	}
-	for {
-		tasks <- struct{}{}
+// RunCase runs a single test case of the named flow with the given seed and
+// reports whether it found a mismatch.
+func (f *Fuzzer) RunCase(name string, seed int64, equalNumber int) bool {
+	if name == "fuzz" {
+		return f.Fuzz(seed, f.Backends)
 	}
+	return f.TestEqualModules(name, seed, equalNumber)
 }
 
-func EqualFuzzYosysOpt(workersPerType, equalNumber int, diffSim bool) {
-
-	fuzzerYosysOpt := &Fuzzer{
-		StartTime:     time.Now().UnixMilli(),
-		EnableDiffSim: diffSim,
-	}
-	fuzzerYosysOpt.Init()
-
-	tasks := make(chan struct{})
-	for i := 0; i < workersPerType; i++ {
-		go func() {
-			for range tasks {
-				fuzzerYosysOpt.TestEqualModulesYosysOpt(equalNumber)
-				atomic.AddInt64(&countYosysOpt, int64(equalNumber))
-			}
-		}()
-	}
-	for {
-		tasks <- struct{}{}
-	}
-}
-
-func EqualFuzzCXXRTL(workersPerType, equalNumber int, diffSim bool) {
-	fuzzerCXXRTL := &Fuzzer{
-		StartTime:     time.Now().UnixMilli(),
-		EnableDiffSim: diffSim,
-	}
-	fuzzerCXXRTL.Init()
-
-	tasks := make(chan struct{})
-	for i := 0; i < workersPerType; i++ {
-		go func() {
-			for range tasks {
-				fuzzerCXXRTL.TestEqualModulesCXXRTL(equalNumber)
-				atomic.AddInt64(&countCXXRTL, int64(equalNumber))
-			}
-		}()
-	}
-	for {
-		tasks <- struct{}{}
+// variantCounter is the per-tool counter bumped with each case's variants.
+func variantCounter(name string) *int64 {
+	switch name {
+	case "iverilog":
+		return &countIverilog
+	case "verilator", "yosys-verilator":
+		return &countVerilator
+	case "yosys":
+		return &countYosysOpt
+	case "cxxrtl":
+		return &countCXXRTL
 	}
+	return nil
 }
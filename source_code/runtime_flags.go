@@ -1,6 +1,36 @@
 package main
 
+import (
+	"VeriEQ/CodeGenerator"
+	"time"
+)
+
 var diffSimEnabled = true
 var paperInitGenEnabled = false
 var controlFlowEquivEnabled = false
 var xInputEnabled = false
+var observeEnabled = false
+
+// referenceEnabled checks every case against the Go reference evaluator too.
+var referenceEnabled = true
+
+// waveformEnabled reruns every reported case with VCD dumps on its simulators.
+var waveformEnabled = true
+
+// frontendCheckEnabled compiles every case with all frontends first and
+// reports designs some reject and others accept.
+var frontendCheckEnabled = true
+
+var generatorOptions = CodeGenerator.GeneratorOptions{
+	UsePaperInitGen:        paperInitGenEnabled,
+	EnableControlFlowEquiv: controlFlowEquivEnabled,
+	EnableXInputs:          xInputEnabled,
+	EnableObservability:    observeEnabled,
+}
+
+// backendsOverride is set by -backends and takes precedence over the config.
+var backendsOverride []string
+
+// Default per-phase limits for tools without an entry in the config.
+var compileTimeout = 20 * time.Minute
+var runTimeout = 5 * time.Minute
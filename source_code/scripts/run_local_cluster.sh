@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+# Runs a coordinator and N workers on this machine, each in its own
+# directory under cluster/. Extra arguments go to the coordinator.
+set -euo pipefail
+
+ROOT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")/.." && pwd)"
+cd "$ROOT_DIR"
+mkdir -p .gocache
+
+WORKERS="${1:-2}"
+THREADS="${2:-8}"
+COUNT="${3:-2}"
+CONFIG_PATH="${4:-$ROOT_DIR/config.json}"
+shift $(( $# < 4 ? $# : 4 ))
+ADDR="127.0.0.1:7700"
+
+GOCACHE="$ROOT_DIR/.gocache" go build -o "$ROOT_DIR/.gocache/veq" .
+BIN="$ROOT_DIR/.gocache/veq"
+
+mkdir -p cluster/coordinator
+(cd cluster/coordinator && "$BIN" coordinator -listen "$ADDR" -count "$COUNT" -config "$CONFIG_PATH" "$@") &
+COORDINATOR=$!
+trap 'kill $COORDINATOR 2>/dev/null || true' EXIT
+sleep 1
+
+for i in $(seq 1 "$WORKERS"); do
+  mkdir -p "cluster/worker$i"
+  (cd "cluster/worker$i" && "$BIN" worker -coordinator "http://$ADDR" -threads "$THREADS" -config "$CONFIG_PATH" -name "worker$i" > worker.out 2>&1) &
+done
+wait
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// maxSignatureFrames is how many stack frames of a sanitizer report go
+// into a crash signature.
+const maxSignatureFrames = 3
+
+// Signature identifies the bug behind a saved case, so that one bug fills
+// one bucket instead of thousands of bug directories. Crashes are told
+// apart by the tool, phase, sanitizer frames and error message; mismatches
+// by the suspected tool and the operator and width features of the signal
+// that diverges first.
+type Signature struct {
+	Kind     string   `json:"kind"`
+	Tool     string   `json:"tool,omitempty"`
+	Phase    string   `json:"phase,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Frames   []string `json:"frames,omitempty"`
+	Signal   string   `json:"signal,omitempty"`
+	Features []string `json:"features,omitempty"`
+}
+
+// Bucket is the directory, relative to the campaign's bug directory, that
+// collects the cases of s. Hangs and resource exhaustion keep their
+// hang/<tool>_<phase> and resource/<tool>_<signal> buckets, and the cases a
+// false-positive rule matched go to suppressed/<rule>.
+func (s Signature) Bucket() string {
+	switch s.Kind {
+	case "hang":
+		return "hang/" + s.Tool + "_" + s.Phase
+	case "resource":
+		return "resource/" + s.Tool + "_" + s.Message
+	case "suppressed":
+		return "suppressed/" + s.Tool
+	}
+	tool := s.Tool
+	if tool == "" && s.Kind == "mismatch" {
+		tool = "undecided"
+	} else if tool == "" {
+		tool = "unknown"
+	}
+	if s.Phase != "" {
+		tool += "_" + s.Phase
+	}
+	return s.Kind + "/" + tool + "_" + s.hash()
+}
+
+func (s Signature) hash() string {
+	h := sha1.New()
+	for _, part := range append(append([]string{s.Kind, s.Tool, s.Phase, s.Message}, s.Frames...), s.Features...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:8]
+}
+
+// crashSignature describes a failed tool run.
+func crashSignature(toolErr *ToolError) Signature {
+	sig := Signature{Kind: toolErr.Category(), Tool: toolErr.Tool, Phase: toolErr.Phase}
+	switch sig.Kind {
+	case "hang":
+		return sig
+	case "resource":
+		sig.Message = signalName(toolErr.Signal)
+		return sig
+	}
+	text := toolErr.Stderr
+	if !checkSanitizerErrorFromStderr(text) && errorMessage(text) == "" {
+		// yosys and the simulators report on stdout, which went to the log
+		if data, err := os.ReadFile(toolErr.Log); err == nil {
+			text = string(data)
+		}
+	}
+	sig.Message, sig.Frames = messageSignature(text)
+	if sig.Message == "" && toolErr.Signal != 0 {
+		sig.Message = signalName(toolErr.Signal)
+	}
+	return sig
+}
+
+// messageSignature extracts the sanitizer error and its top frames from a
+// tool's output, or else the first assertion or error message.
+func messageSignature(text string) (string, []string) {
+	if checkSanitizerErrorFromStderr(text) {
+		if msg, frames := sanitizerReport(text); msg != "" || len(frames) > 0 {
+			return msg, frames
+		}
+	}
+	return errorMessage(text), nil
+}
+
+var (
+	sanitizerErrorLine = regexp.MustCompile(`ERROR: \w+Sanitizer: (.*)|(\S+: runtime error: .*)`)
+	stackFrame         = regexp.MustCompile(`^\s*#\d+ 0x[0-9a-fA-F]+ in (\S+)`)
+	errorLine          = regexp.MustCompile(`(Assertion .*|%Error.*|Internal Error.*|ERROR:.*|[Ee]rror: .*|terminate called.*|panic: .*)`)
+
+	hexNumber = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	number    = regexp.MustCompile(`\d+`)
+	dirPrefix = regexp.MustCompile(`(?:[\w.+\-]*/)+`)
+)
+
+// sanitizerReport returns the normalized sanitizer error and the top
+// frames of its stack, leaving out the sanitizer runtime and libc.
+func sanitizerReport(text string) (string, []string) {
+	msg := ""
+	var frames []string
+	for _, line := range strings.Split(text, "\n") {
+		if msg == "" {
+			if m := sanitizerErrorLine.FindStringSubmatch(line); m != nil {
+				// UBSan keeps its source location: "file.cc:1:2: runtime error: ..."
+				msg = normalizeMessage(m[1] + m[2])
+				// ASan: "heap-buffer-overflow on address 0x... at pc ...",
+				// "SEGV on unknown address ..."
+				if i := strings.Index(msg, " on "); m[1] != "" && i >= 0 {
+					msg = msg[:i]
+				}
+			}
+			continue
+		}
+		m := stackFrame.FindStringSubmatch(line)
+		if m == nil {
+			if len(frames) > 0 {
+				break
+			}
+			continue
+		}
+		if runtimeFrame(m[1]) {
+			continue
+		}
+		frames = append(frames, m[1])
+		if len(frames) == maxSignatureFrames {
+			break
+		}
+	}
+	return msg, frames
+}
+
+func runtimeFrame(fn string) bool {
+	for _, prefix := range []string{"__asan", "__ubsan", "__sanitizer", "__interceptor", "__libc", "__GI_", "abort", "raise", "__assert"} {
+		if strings.HasPrefix(fn, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorMessage returns the first assertion or error line, normalized.
+func errorMessage(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if m := errorLine.FindString(line); m != "" {
+			return normalizeMessage(m)
+		}
+	}
+	return ""
+}
+
+// normalizeMessage drops what differs between two reports of the same
+// bug: directories, addresses and numbers (lines, widths, signal indices).
+func normalizeMessage(msg string) string {
+	msg = dirPrefix.ReplaceAllString(msg, "")
+	msg = hexNumber.ReplaceAllString(msg, "0x?")
+	msg = number.ReplaceAllString(msg, "N")
+	return strings.TrimSpace(msg)
+}
+
+// mismatchSignature describes a mismatch by the suspect and the signal that
+// diverges first in d: the operators of its definition, the width class of
+// its highest differing bit and whether its sign bit differs. With -observe
+// the signal is the topologically earliest divergent one, whose inputs
+// still agree, so its operators are where the bug is; without it the signal
+// is an output, whose operators at least keep structurally different
+// designs apart.
+func (tc *TestCase) mismatchSignature(suspect string, d *OutputDiff) Signature {
+	sig := Signature{Kind: "mismatch", Tool: suspect}
+	if d == nil || d.First < 0 {
+		return sig
+	}
+	var diverged *SignalDiff
+	for _, s := range d.Signals {
+		if s.Cycles[0].Cycle == d.First {
+			diverged = s
+			break
+		}
+	}
+	first, _, localized := earliestSignal(d, tc.Signals)
+	if localized {
+		for _, s := range d.Signals {
+			if s.Signal == first.Name {
+				diverged = s
+			}
+		}
+	}
+	if diverged == nil {
+		return sig
+	}
+	sig.Signal = strings.TrimPrefix(diverged.Signal, CodeGenerator.ObservePrefix)
+	// the variants of an equivalence case share the definitions of eq0
+	name := sig.Signal
+	if base, _, ok := cutVariant(name); ok {
+		name = base
+	}
+	sig.Features = tc.Generator.Features(name)
+	if n := diverged.Bits.BitLen(); n > 0 {
+		sig.Features = append(sig.Features, "diff:"+CodeGenerator.WidthClass(n))
+		if diverged.Width > 0 && diverged.Bits.Bit(diverged.Width-1) == 1 {
+			sig.Features = append(sig.Features, "diff:msb")
+		}
+	}
+	return sig
+}
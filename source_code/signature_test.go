@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func asanReport(addr, pc, file string, frames ...string) string {
+	text := "==1234==ERROR: AddressSanitizer: heap-buffer-overflow on address " + addr + " at pc " + pc + "\n" +
+		"READ of size 8 at " + addr + " thread T0\n" +
+		"    #0 " + pc + " in __asan_memcpy\n"
+	for i, fn := range frames {
+		text += "    #" + string(rune('1'+i)) + " " + pc + " in " + fn + " " + file + "\n"
+	}
+	return text + "\nSUMMARY: AddressSanitizer: heap-buffer-overflow\n"
+}
+
+func crashBucket(tool, text string) string {
+	msg, frames := messageSignature(text)
+	return Signature{Kind: "crash", Tool: tool, Phase: PhaseElaboration, Message: msg, Frames: frames}.Bucket()
+}
+
+func TestCrashBuckets(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{
+			name: "addresses and source paths",
+			a:    asanReport("0x602000000010", "0x4a1b2c", "/build/a/V3Width.cpp:120", "V3Width::visit", "AstNode::iterate"),
+			b:    asanReport("0x6020000000f0", "0x4a9999", "/home/b/src/V3Width.cpp:131", "V3Width::visit", "AstNode::iterate"),
+			same: true,
+		},
+		{
+			name: "different frames",
+			a:    asanReport("0x602000000010", "0x4a1b2c", "x.cpp:1", "V3Width::visit", "AstNode::iterate"),
+			b:    asanReport("0x602000000010", "0x4a1b2c", "x.cpp:1", "V3Const::visit", "AstNode::iterate"),
+		},
+		{
+			name: "line numbers and widths in an assertion",
+			a:    "iverilog: /src/net_link.cc:241: void Link::unlink(): Assertion `width == 32' failed.\n",
+			b:    "iverilog: /tmp/x/net_link.cc:250: void Link::unlink(): Assertion `width == 8' failed.\n",
+			same: true,
+		},
+		{
+			name: "different assertions",
+			a:    "Assertion `width == 32' failed.\n",
+			b:    "Assertion `sig.size() == 32' failed.\n",
+		},
+		{
+			name: "internal errors of different passes",
+			a:    "%Error: Internal Error: test.v:5:3: ../V3Width.cpp:4513: Unsupported\n",
+			b:    "%Error: Internal Error: test.v:5:3: ../V3Const.cpp:4513: Unsupported\n",
+		},
+		{
+			name: "UBSan locations",
+			a:    "/src/kernel/rtlil.cc:12:3: runtime error: shift exponent 40 is too large for 32-bit type 'int'\n",
+			b:    "/build/kernel/rtlil.cc:14:9: runtime error: shift exponent 33 is too large for 32-bit type 'int'\n",
+			same: true,
+		},
+	}
+	for _, tt := range tests {
+		a, b := crashBucket("verilator", tt.a), crashBucket("verilator", tt.b)
+		if (a == b) != tt.same {
+			t.Errorf("%s: buckets %s and %s, same = %v", tt.name, a, b, a == b)
+		}
+	}
+}
+
+func TestSignatureHash(t *testing.T) {
+	base := Signature{Kind: "crash", Tool: "yosys", Phase: PhaseElaboration, Message: "m", Frames: []string{"f"}}
+	tests := []struct {
+		name  string
+		other Signature
+		same  bool
+	}{
+		{"identical", Signature{Kind: "crash", Tool: "yosys", Phase: PhaseElaboration, Message: "m", Frames: []string{"f"}}, true},
+		{"tool", Signature{Kind: "crash", Tool: "iverilog", Phase: PhaseElaboration, Message: "m", Frames: []string{"f"}}, false},
+		{"frame", Signature{Kind: "crash", Tool: "yosys", Phase: PhaseElaboration, Message: "m", Frames: []string{"g"}}, false},
+		{"message split", Signature{Kind: "crash", Tool: "yosys", Phase: PhaseElaboration, Message: "mf"}, false},
+	}
+	for _, tt := range tests {
+		if (base.hash() == tt.other.hash()) != tt.same {
+			t.Errorf("%s: hashes %s and %s", tt.name, base.hash(), tt.other.hash())
+		}
+	}
+}
+
+func TestSignatureHashKeepsFrames(t *testing.T) {
+	// Frames with spare capacity must not be written to by hash
+	frames := make([]string, 1, 4)
+	frames[0] = "f"
+	spare := frames[:2]
+	spare[1] = "kept"
+	s := Signature{Kind: "crash", Frames: frames, Features: []string{"feature"}}
+	before := s.hash()
+	if spare[1] != "kept" {
+		t.Errorf("hash overwrote the frames' backing array with %q", spare[1])
+	}
+	if s.hash() != before {
+		t.Error("hash is not stable")
+	}
+}
+
+func TestMismatchBucketsWithoutObserve(t *testing.T) {
+	f := &Fuzzer{TestFileName: "test.v", TestBenchName: "tb.v"}
+	bucket := func(seed int64, signal string) string {
+		tc := f.NewTestCase("fuzz", seed, 0, nil)
+		d := &OutputDiff{First: 0, Signals: []*SignalDiff{{
+			Signal: signal,
+			Width:  64,
+			Cycles: []CycleDiff{{Cycle: 0, Left: "1", Right: "0"}},
+			Bits:   big.NewInt(1 << 40),
+		}}}
+		return tc.mismatchSignature("verilator", d).Bucket()
+	}
+	// seed 1 adds a wide operand into out0, seed 2 does not
+	if a, b := bucket(1, "out0"), bucket(2, "out0"); a == b {
+		t.Errorf("structurally different designs share bucket %s", a)
+	}
+	if a, b := bucket(1, "out0"), bucket(1, "out0"); a != b {
+		t.Errorf("one design has buckets %s and %s", a, b)
+	}
+	if a, b := bucket(1, "out0"), bucket(1, "out0_eq2"); a != b {
+		t.Errorf("a variant of out0 has bucket %s, out0 %s", b, a)
+	}
+}
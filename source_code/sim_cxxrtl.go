@@ -1,67 +1,86 @@
 package main
 
 import (
-	"VeriEQ/CodeGenerator"
-	"bytes"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
-func (f *Fuzzer) RunCXXRTL(inputData string, generator *CodeGenerator.ExpressionGenerator, realSubDir, tmpFileName, tbFileName string) ([]byte, error) {
-	//printDirTree(realSubDir)
-	//_ = os.Remove(generator.TestBenchOutputFileName)
+// CXXRTLSim translates each of job.DesignTops with write_cxxrtl and builds
+// job.CXXTbFile against them: test.cpp for a single top, test<i>.cpp
+// otherwise.
+type CXXRTLSim struct {
+	simBase
+}
 
-	cxxrtlLog := filepath.Join(realSubDir, GetRandomFileName("cxxrtl", ".log", ""))
+func (s *CXXRTLSim) Name() string { return "cxxrtl" }
 
-	logFile, err := os.Create(cxxrtlLog)
-	defer logFile.Close()
-	if err != nil {
-		return nil, err
+func (s *CXXRTLSim) Compile(job SimJob) error {
+	if err := s.prepare(s.Name(), job); err != nil {
+		return err
 	}
-
-	var cxxrtlStderr bytes.Buffer
-
-	compileCmd := fmt.Sprintf("%s -w -g -O3 -std=c++14 -I $(%s --datdir)/include/backends/cxxrtl/runtime main.cpp -o cxxsim",
-		toolConfig.ClangXXPath, toolConfig.YosysConfigPath)
-	build := exec.Command("bash", "-c", compileCmd)
-	build.Dir = realSubDir
-	build.Stdout = logFile
-	build.Stderr = &cxxrtlStderr
-	cxxrtlStderr.Reset()
-
-	if err := build.Run(); err != nil {
-		handleFailure(f.CrashDir, realSubDir, cxxrtlLog, cxxrtlStderr.String())
-		return nil, err
+	errs := make([]error, len(job.DesignTops))
+	var wg sync.WaitGroup
+	for i, top := range job.DesignTops {
+		outputFile := "test.cpp"
+		if len(job.DesignTops) > 1 {
+			outputFile = fmt.Sprintf("test%d.cpp", i)
+		}
+		wg.Add(1)
+		go func(i int, top, outputFile string) {
+			defer wg.Done()
+			errs[i] = s.writeCXXRTL(top, outputFile)
+		}(i, top, outputFile)
 	}
-
-	tbInputPath := filepath.Join(realSubDir, generator.TestBenchInputFileName)
-	if err := os.WriteFile(tbInputPath, []byte(inputData), 0o644); err != nil {
-		fmt.Println("写入 CXXRTL testbench 输入失败:", err)
-		return nil, err
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
 	}
 
-	sim := exec.Command("./cxxsim")
-	sim.Dir = realSubDir
-	sim.Stdout = logFile
-	sim.Stderr = &cxxrtlStderr
-	cxxrtlStderr.Reset()
-
-	if err := sim.Run(); err != nil {
-		handleFailure(f.CrashDir, realSubDir, cxxrtlLog, cxxrtlStderr.String())
-		return nil, err
+	if err := copyFile(job.CXXTbFile, filepath.Join(s.work, "main.cpp")); err != nil {
+		return err
+	}
+	logCommand(s.job, ToolCommand{Tool: s.Name(), Phase: PhaseCXXCompile, Dir: s.work, Args: []string{"cp", job.CXXTbFile, "main.cpp"}, Result: "ok"})
+	defines := ""
+	if job.Trace {
+		defines = "-DVEQ_VCD "
 	}
+	compileCmd := fmt.Sprintf("%s -w -g -O3 -std=c++14 %s-I $(%s --datdir)/include/backends/cxxrtl/runtime main.cpp -o cxxsim",
+		toolConfig.ClangXXPath, defines, toolConfig.YosysConfigPath)
+	return runTool(s.job, s.Name(), PhaseCXXCompile, s.work, s.log, "bash", "-c", compileCmd)
+}
 
-	cxxrtlData, err := os.ReadFile(filepath.Join(realSubDir, "output.txt"))
+func (s *CXXRTLSim) writeCXXRTL(top, outputFile string) error {
+	script := fmt.Sprintf("read_verilog %s; hierarchy -top %s; write_cxxrtl %s", s.job.DesignFile, top, outputFile)
+	if err := runTool(s.job, s.Name(), PhaseElaboration, s.work, s.log, toolConfig.YosysPath, "-p", script); err != nil {
+		return err
+	}
+	// Drop the trailing cxxrtl_design_create() entry point; the multi-module
+	// testbench includes several designs and it would be defined twice.
+	outputPath := filepath.Join(s.work, outputFile)
+	data, err := os.ReadFile(outputPath)
 	if err != nil {
-		handleFailure(f.CrashDir, realSubDir, cxxrtlLog, err.Error())
-		return nil, err
+		return err
 	}
-	//printDirTree(realSubDir)
-	//_ = os.Remove(generator.TestBenchOutputFileName)
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > 5 {
+		lines = lines[:len(lines)-5]
+	}
+	logCommand(s.job, ToolCommand{Tool: s.Name(), Phase: PhaseElaboration, Dir: s.work, Result: "ok",
+		Args: []string{"sed", "-i", "-e", ":a", "-e", "$d;N;2,4ba", "-e", "P;D", outputFile}})
+	return os.WriteFile(outputPath, []byte(strings.Join(lines, "\n")), 0644)
+}
+
+func (s *CXXRTLSim) Run(input string) error {
+	if err := s.writeInput(input); err != nil {
+		return err
+	}
+	return runTool(s.job, s.Name(), PhaseSimulation, s.work, s.log, "./cxxsim")
+}
 
-	cxxrtlOut := filepath.Join(realSubDir, "cxxrtl_output.txt")
-	_ = os.WriteFile(cxxrtlOut, cxxrtlData, 0o644)
-	return cxxrtlData, nil
+func (s *CXXRTLSim) Output() ([]byte, error) {
+	return s.readOutput(s.Name())
 }
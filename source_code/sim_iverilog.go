@@ -1,61 +1,29 @@
 package main
 
-import (
-	"VeriEQ/CodeGenerator"
-	"bytes"
-	"os"
-	"os/exec"
-	"path/filepath"
-)
+import "path/filepath"
 
-func (f *Fuzzer) RunIVerilog(inputData string, generator *CodeGenerator.ExpressionGenerator, realSubDir, tmpFileName, tbFileName string) ([]byte, error) {
-	iverilogDir := filepath.Join(realSubDir, "iverilog")
-	if err := os.MkdirAll(iverilogDir, 0755); err != nil {
-		return nil, err
-	}
-	aoutPath := filepath.Join(iverilogDir, "a.out")
-	args := []string{tmpFileName, tbFileName, "-o", aoutPath}
-	cmd := exec.Command(toolConfig.IverilogPath, args...)
-	cmd.Env = append(os.Environ(), "ASAN_OPTIONS=detect_leaks=0")
-	cmd.Dir = realSubDir
-
-	iverilogLogFileName := filepath.Join(realSubDir, GetRandomFileName("iverilog", ".log", ""))
-	logFile, err := os.Create(iverilogLogFileName)
-	defer logFile.Close()
-	if err != nil {
-		return nil, err
-	}
-	var stderrBuffer bytes.Buffer
-	cmd.Stdout = logFile
-	cmd.Stderr = &stderrBuffer
+type IverilogSim struct {
+	simBase
+}
 
-	if err := cmd.Run(); err != nil {
-		handleFailure(f.CrashDir, iverilogLogFileName, stderrBuffer.String(), err.Error())
-		return nil, err
-	}
+func (s *IverilogSim) Name() string { return "iverilog" }
 
-	testbenchInputPath := filepath.Join(iverilogDir, generator.TestBenchInputFileName)
-	if err := os.WriteFile(testbenchInputPath, []byte(inputData), 0644); err != nil {
-		return nil, err
+func (s *IverilogSim) Compile(job SimJob) error {
+	if err := s.prepare(s.Name(), job); err != nil {
+		return err
 	}
-	cmd = exec.Command("./a.out")
-	cmd.Env = append(os.Environ(), "ASAN_OPTIONS=detect_leaks=0")
-	cmd.Dir = iverilogDir
-	cmd.Stdout = logFile
-	cmd.Stderr = &stderrBuffer
-	stderrBuffer.Reset()
-	if err := cmd.Run(); err != nil {
-		handleFailure(f.CrashDir, iverilogLogFileName, stderrBuffer.String(), err.Error())
-		return nil, err
+	args := []string{job.DesignFile, job.TbFile, "-o", filepath.Join(s.work, "a.out")}
+	if job.Trace {
+		args = append([]string{"-DVEQ_VCD"}, args...)
 	}
+	return runTool(s.job, s.Name(), PhaseElaboration, job.Dir, s.log, toolConfig.IverilogPath, args...)
+}
 
-	iverilogData, err := os.ReadFile(filepath.Join(iverilogDir, generator.TestBenchOutputFileName))
-	if err != nil {
-		handleFailure(f.CrashDir, realSubDir, iverilogLogFileName, err.Error())
-		return nil, err
+func (s *IverilogSim) Run(input string) error {
+	if err := s.writeInput(input); err != nil {
+		return err
 	}
-
-	iverilogOut := filepath.Join(realSubDir, "iverilog_output.txt")
-	_ = os.WriteFile(iverilogOut, iverilogData, 0o644)
-	return iverilogData, nil
+	return runTool(s.job, s.Name(), PhaseSimulation, s.work, s.log, "./a.out")
 }
+
+func (s *IverilogSim) Output() ([]byte, error) { return s.readOutput(s.Name()) }
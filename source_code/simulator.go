@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	PhaseElaboration = "elaboration"
+	PhaseCXXCompile  = "cxx-compile"
+	PhaseSimulation  = "simulation"
+)
+
+// SimJob describes one design + testbench to simulate. Every simulator
+// builds in its own <Dir>/<tool>_<Tag> directory so several backends can
+// share a case directory.
+type SimJob struct {
+	Dir        string
+	Tag        string
+	DesignFile string
+	DesignTops []string
+	TbFile     string
+	TbTop      string
+	CXXTbFile  string
+	InputFile  string
+	OutputFile string
+
+	// Trace builds the testbench with VEQ_VCD defined, so that it dumps
+	// waves.vcd next to its output.
+	Trace bool
+
+	// Seed and Fuzzer identify the case in events and failure records.
+	Seed   int64
+	Fuzzer string
+
+	// Case is the case directory the commands are logged in, when the job
+	// builds in a directory below it.
+	Case string
+}
+
+func (j SimJob) caseDir() string {
+	if j.Case != "" {
+		return j.Case
+	}
+	return j.Dir
+}
+
+func (j SimJob) workDir(tool string) string {
+	if j.Tag == "" {
+		return filepath.Join(j.Dir, tool)
+	}
+	return filepath.Join(j.Dir, tool+"_"+j.Tag)
+}
+
+type Simulator interface {
+	Name() string
+	Compile(job SimJob) error
+	Run(input string) error
+	Output() ([]byte, error)
+	Waveform() string
+}
+
+var simulators = map[string]func() Simulator{
+	"iverilog":        func() Simulator { return &IverilogSim{} },
+	"verilator":       func() Simulator { return &VerilatorSim{} },
+	"cxxrtl":          func() Simulator { return &CXXRTLSim{} },
+	"yosys":           func() Simulator { return &YosysOptSim{Inner: &IverilogSim{}} },
+	"yosys-verilator": func() Simulator { return &YosysOptSim{Inner: &VerilatorSim{}} },
+}
+
+func NewSimulator(name string) (Simulator, error) {
+	newSim, ok := simulators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown simulator: %s", name)
+	}
+	return newSim(), nil
+}
+
+func SimulatorNames() []string {
+	names := make([]string, 0, len(simulators))
+	for name := range simulators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ToolError is a failed tool invocation; Log is the file its stdout went to.
+// Hung is set when the phase ran into its timeout and was killed; Signal is
+// the signal that terminated the tool, if any.
+type ToolError struct {
+	Tool     string
+	Phase    string
+	Log      string
+	Stderr   string
+	Err      error
+	Hung     bool
+	Timeout  time.Duration
+	Signal   syscall.Signal
+	ExitCode int
+	Seed     int64
+	Fuzzer   string
+}
+
+func (e *ToolError) Error() string {
+	switch {
+	case e.Hung:
+		return fmt.Sprintf("%s %s: timed out after %s", e.Tool, e.Phase, e.Timeout)
+	case e.Signal != 0:
+		return fmt.Sprintf("%s %s: killed by %s", e.Tool, e.Phase, signalName(e.Signal))
+	}
+	return fmt.Sprintf("%s %s: %v", e.Tool, e.Phase, e.Err)
+}
+
+// Category is "hang", "resource" (killed by the OOM killer or a CPU or
+// file-size limit) or "crash".
+func (e *ToolError) Category() string {
+	switch {
+	case e.Hung:
+		return "hang"
+	case isResourceSignal(e.Signal):
+		return "resource"
+	}
+	return "crash"
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// runTool runs one tool phase under its configured timeout and resource
+// limits. The child gets its own process group so a hung
+// bash/clang++/simulator tree is killed as a whole.
+func runTool(job SimJob, tool, phase, dir, logPath, name string, args ...string) error {
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	ctx := context.Background()
+	timeout := toolConfig.timeout(tool, phase)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	viaShell := name == "bash"
+	argv := append([]string{name}, args...)
+	name, args = toolConfig.limitsFor(tool).wrap(name, args)
+
+	var stderrBuffer bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "ASAN_OPTIONS=detect_leaks=0")
+	cmd.Dir = dir
+	cmd.Stdout = logFile
+	cmd.Stderr = &stderrBuffer
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	start := time.Now()
+	err = cmd.Run()
+	logged := ToolCommand{Tool: tool, Phase: phase, Dir: dir, Args: argv, Log: logPath, Timeout: timeout.Seconds(), Result: "ok"}
+	if phase == PhaseSimulation {
+		logged.Input = job.InputFile
+	}
+	event := Event{
+		Type:     EventPhase,
+		Fuzzer:   job.Fuzzer,
+		Seed:     job.Seed,
+		Tool:     tool,
+		Phase:    phase,
+		Duration: time.Since(start).Seconds(),
+	}
+	if err == nil {
+		logCommand(job, logged)
+		emitEvent(event)
+		return nil
+	}
+	toolErr := &ToolError{
+		Tool:   tool,
+		Phase:  phase,
+		Log:    logPath,
+		Stderr: stderrBuffer.String(),
+		Err:    err,
+		Seed:   job.Seed,
+		Fuzzer: job.Fuzzer,
+	}
+	toolErr.Signal, toolErr.ExitCode = exitStatus(err, viaShell)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		toolErr.Hung = true
+		toolErr.Timeout = timeout
+	}
+	event.Detail = toolErr.Error()
+	logged.Result = toolErr.Error()
+	logCommand(job, logged)
+	emitEvent(event)
+	return toolErr
+}
+
+// simBase holds the bookkeeping shared by the simulators.
+type simBase struct {
+	job  SimJob
+	work string
+	log  string
+}
+
+func (s *simBase) prepare(tool string, job SimJob) error {
+	if job.InputFile == "" {
+		job.InputFile = "input.txt"
+	}
+	if job.OutputFile == "" {
+		job.OutputFile = "output.txt"
+	}
+	s.job = job
+	s.work = job.workDir(tool)
+	s.log = s.work + ".log"
+	return os.MkdirAll(s.work, 0755)
+}
+
+func (s *simBase) writeInput(input string) error {
+	return os.WriteFile(filepath.Join(s.work, s.job.InputFile), []byte(input), 0644)
+}
+
+// runLog is the file the simulation of sim prints to.
+func runLog(sim Simulator) string {
+	switch s := sim.(type) {
+	case *YosysOptSim:
+		return runLog(s.Inner)
+	case interface{ logPath() string }:
+		return s.logPath()
+	}
+	return ""
+}
+
+func (s *simBase) logPath() string { return s.log }
+
+// Waveform is the VCD file a Trace job writes.
+func (s *simBase) Waveform() string {
+	return filepath.Join(s.work, "waves.vcd")
+}
+
+func (s *simBase) readOutput(tool string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.work, s.job.OutputFile))
+	if err != nil {
+		return nil, &ToolError{
+			Tool:   tool,
+			Phase:  PhaseSimulation,
+			Log:    s.log,
+			Stderr: err.Error(),
+			Err:    err,
+			Seed:   s.job.Seed,
+			Fuzzer: s.job.Fuzzer,
+		}
+	}
+	return data, nil
+}
+
+func runSimulator(sim Simulator, job SimJob, input string) ([]byte, error) {
+	if err := sim.Compile(job); err != nil {
+		return nil, err
+	}
+	if err := sim.Run(input); err != nil {
+		return nil, err
+	}
+	return sim.Output()
+}
+
+// simulate runs job on the named backend. A failing tool is saved as a
+// crash; otherwise the output is kept as <tool>_<tag>_output.txt in the
+// case directory.
+func (f *Fuzzer) simulate(name string, job SimJob, input string) ([]byte, error) {
+	sim, err := NewSimulator(name)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	return f.simulateWith(sim, job, input)
+}
+
+func (f *Fuzzer) simulateWith(sim Simulator, job SimJob, input string) ([]byte, error) {
+	data, err := runSimulator(sim, job, input)
+	if err != nil {
+		f.reportToolError(job.Dir, err)
+		return nil, err
+	}
+	outName := filepath.Base(job.workDir(sim.Name())) + "_output.txt"
+	_ = os.WriteFile(filepath.Join(job.Dir, outName), data, 0o644)
+	return data, nil
+}
+
+// reportToolError saves dir as a crash or hang when err came from a tool.
+func (f *Fuzzer) reportToolError(dir string, err error) {
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) {
+		handleToolFailure(f.CrashDir, dir, toolErr)
+		return
+	}
+	fmt.Println(err)
+}
+
+// backendsFor returns the reference simulators a target is compared
+// against: -backends first, then the config file, then the defaults.
+func backendsFor(target string) []string {
+	list := defaultBackends[target]
+	if len(backendsOverride) > 0 {
+		list = backendsOverride
+	} else if configured := toolConfig.Backends[target]; len(configured) > 0 {
+		list = configured
+	}
+	var backends []string
+	for _, name := range list {
+		if name != target {
+			backends = append(backends, name)
+		}
+	}
+	return backends
+}
+
+var defaultBackends = map[string][]string{
+	"iverilog":        {"verilator"},
+	"verilator":       {"iverilog"},
+	"yosys":           {"iverilog"},
+	"yosys-verilator": {"verilator"},
+	"cxxrtl":          {"iverilog"},
+	"fuzz":            {"verilator", "iverilog", "cxxrtl"},
+}
+
+func parseBackends(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := simulators[name]; !ok {
+			return nil, fmt.Errorf("unknown simulator: %s (have %s)", name, strings.Join(SimulatorNames(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
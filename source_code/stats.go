@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+type FuzzerStats struct {
+	Cases      int64   `json:"cases"`
+	CasesPerH  float64 `json:"cases_per_hour"`
+	Mismatches int64   `json:"mismatches"`
+	BugRate    float64 `json:"bug_rate"`
+	Crashes    int64   `json:"crashes"`
+	Hangs      int64   `json:"hangs"`
+	Resource   int64   `json:"resource_exhausted"`
+	Rejections int64   `json:"rejections"`
+	Suppressed int64   `json:"suppressed"`
+}
+
+type PhaseStats struct {
+	Count   int64   `json:"count"`
+	Failed  int64   `json:"failed"`
+	Seconds float64 `json:"seconds"`
+}
+
+type StatsReport struct {
+	Runs    int                               `json:"runs"`
+	Elapsed float64                           `json:"elapsed_seconds"`
+	Fuzzers map[string]*FuzzerStats           `json:"fuzzers"`
+	Tools   map[string]map[string]*PhaseStats `json:"tools"`
+}
+
+// RunStats implements `VeriEQ stats`: it summarizes the events.jsonl of one
+// or more runs (log directories or the files themselves).
+func RunStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		PrettyErr("stats", "usage: stats [-json] <log dir | events.jsonl>...")
+		os.Exit(1)
+	}
+
+	report := &StatsReport{
+		Fuzzers: map[string]*FuzzerStats{},
+		Tools:   map[string]map[string]*PhaseStats{},
+	}
+	for _, path := range fs.Args() {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, eventsFileName)
+		}
+		if err := report.addRun(path); err != nil {
+			PrettyErr("stats", err.Error())
+			os.Exit(1)
+		}
+	}
+	report.finish()
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	report.print()
+}
+
+func (r *StatsReport) addRun(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var first, last time.Time
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if first.IsZero() || e.Time.Before(first) {
+			first = e.Time
+		}
+		if e.Time.After(last) {
+			last = e.Time
+		}
+		r.add(e)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	r.Runs++
+	r.Elapsed += last.Sub(first).Seconds()
+	return nil
+}
+
+func (r *StatsReport) fuzzer(name string) *FuzzerStats {
+	if name == "" {
+		name = "-"
+	}
+	s, ok := r.Fuzzers[name]
+	if !ok {
+		s = &FuzzerStats{}
+		r.Fuzzers[name] = s
+	}
+	return s
+}
+
+func (r *StatsReport) add(e Event) {
+	switch e.Type {
+	case EventCaseStart:
+		r.fuzzer(e.Fuzzer).Cases++
+	case EventMismatch:
+		r.fuzzer(e.Fuzzer).Mismatches++
+	case EventCrash:
+		r.fuzzer(e.Fuzzer).Crashes++
+	case EventHang:
+		r.fuzzer(e.Fuzzer).Hangs++
+	case EventResource:
+		r.fuzzer(e.Fuzzer).Resource++
+	case EventRejection:
+		r.fuzzer(e.Fuzzer).Rejections++
+	case EventSuppressed:
+		r.fuzzer(e.Fuzzer).Suppressed++
+	case EventPhase:
+		phases, ok := r.Tools[e.Tool]
+		if !ok {
+			phases = map[string]*PhaseStats{}
+			r.Tools[e.Tool] = phases
+		}
+		p, ok := phases[e.Phase]
+		if !ok {
+			p = &PhaseStats{}
+			phases[e.Phase] = p
+		}
+		p.Count++
+		p.Seconds += e.Duration
+		if e.Detail != "" {
+			p.Failed++
+		}
+	}
+}
+
+func (r *StatsReport) finish() {
+	hours := r.Elapsed / 3600
+	for _, s := range r.Fuzzers {
+		if hours > 0 {
+			s.CasesPerH = float64(s.Cases) / hours
+		}
+		if s.Cases > 0 {
+			s.BugRate = float64(s.Mismatches) / float64(s.Cases)
+		}
+	}
+}
+
+func (r *StatsReport) print() {
+	fmt.Printf("runs=%d elapsed=%.0fs\n\n", r.Runs, r.Elapsed)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FUZZER\tCASES\tCASES/H\tMISMATCHES\tBUG RATE\tCRASHES\tHANGS\tRESOURCE\tREJECTIONS\tSUPPRESSED")
+	for _, name := range sortedKeys(r.Fuzzers) {
+		s := r.Fuzzers[name]
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t%d\t%.4f\t%d\t%d\t%d\t%d\t%d\n",
+			name, s.Cases, s.CasesPerH, s.Mismatches, s.BugRate, s.Crashes, s.Hangs, s.Resource, s.Rejections, s.Suppressed)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "TOOL\tPHASE\tRUNS\tRUNS/H\tFAILED\tTOTAL S\tMEAN S")
+	for _, tool := range sortedKeys(r.Tools) {
+		for _, phase := range sortedKeys(r.Tools[tool]) {
+			p := r.Tools[tool][phase]
+			perHour := 0.0
+			if r.Elapsed > 0 {
+				perHour = float64(p.Count) / (r.Elapsed / 3600)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\t%d\t%.1f\t%.3f\n",
+				tool, phase, p.Count, perHour, p.Failed, p.Seconds, p.Seconds/float64(p.Count))
+		}
+	}
+	w.Flush()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestStatsBugRate(t *testing.T) {
+	r := &StatsReport{Fuzzers: map[string]*FuzzerStats{}, Tools: map[string]map[string]*PhaseStats{}}
+	for _, e := range []Event{
+		{Type: EventCaseStart, Fuzzer: "fuzz", Seed: 1},
+		{Type: EventCaseStart, Fuzzer: "fuzz", Seed: 2},
+		{Type: EventCaseStart, Fuzzer: "fuzz", Seed: 3},
+		{Type: EventCaseStart, Fuzzer: "fuzz", Seed: 4},
+		{Type: EventSuppressed, Fuzzer: "fuzz", Seed: 2, Tool: "cxxrtl", Detail: "cxxrtl-clock-tested-in-body"},
+		{Type: EventMismatch, Fuzzer: "fuzz", Seed: 3, Tool: "cxxrtl", Detail: "iverilog vs cxxrtl; verilator vs cxxrtl"},
+	} {
+		r.add(e)
+	}
+	r.finish()
+	s := r.Fuzzers["fuzz"]
+	if s.Cases != 4 || s.Mismatches != 1 || s.Suppressed != 1 || s.BugRate != 0.25 {
+		t.Errorf("got %+v, want 4 cases, 1 mismatch, 1 suppressed, bug rate 0.25", s)
+	}
+}
@@ -15,7 +15,7 @@ import (
 var Commands []string
 
 func (f *Fuzzer) TestSynth() {
-	generator := CodeGenerator.NewExpressionGenerator()
+	generator := CodeGenerator.NewExpressionGeneratorWithOptions(f.GenOptions)
 	generator.Name = "top"
 	tmpFileName := f.TmpDir + GetRandomFileName("tmp", ".v", "")
 
@@ -45,24 +45,25 @@ func (f *Fuzzer) TestSynth() {
 			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
 			defer cancel()
 
-			cmd := exec.CommandContext(ctx, toolConfig.YosysPath, "-l", logFileName, "-p", realCmd)
+			name, args := toolConfig.limitsFor("yosys").wrap(toolConfig.YosysPath, []string{"-l", logFileName, "-p", realCmd})
+			cmd := exec.CommandContext(ctx, name, args...)
 
 			var stderrBuffer bytes.Buffer
 			cmd.Stderr = &stderrBuffer
 
 			err := cmd.Run()
 
-			exitErr, isExitErr := err.(*exec.ExitError)
+			sig, _ := exitStatus(err, false)
 
 			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 				reason := "Yosys timeout"
-				saveCrashArtifacts(f, logFileName, tmpFileName, reason)
+				saveCrashArtifacts(f, "yosys", logFileName, tmpFileName, reason)
 				return
 			}
 
-			if isExitErr && exitErr.ExitCode() == 137 {
-				reason := "Yosys OOM Kill"
-				saveCrashArtifacts(f, logFileName, tmpFileName, reason)
+			if isResourceSignal(sig) {
+				reason := "Yosys killed by " + signalName(sig)
+				saveCrashArtifacts(f, "yosys", logFileName, tmpFileName, reason)
 				return
 			}
 
@@ -72,7 +73,7 @@ func (f *Fuzzer) TestSynth() {
 				if sanitizerError {
 					appendToLogFile(logFileName, stderrBuffer.String())
 					reason := "Sanitizer (ASan/UBSan)"
-					saveCrashArtifacts(f, logFileName, tmpFileName, reason)
+					saveCrashArtifacts(f, "yosys", logFileName, tmpFileName, reason)
 				}
 
 			} else {
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TargetSpec is one entry of -fuzzer verilator:40,cxxrtl:20.
+type TargetSpec struct {
+	Name    string
+	Threads int
+}
+
+// ParseTargets parses "name[:threads],..."; entries without a thread count
+// get defaultThreads.
+func ParseTargets(spec string, defaultThreads int) ([]TargetSpec, error) {
+	var targets []TargetSpec
+	seen := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, threadsStr, hasThreads := strings.Cut(item, ":")
+		threads := defaultThreads
+		if hasThreads {
+			n, err := strconv.Atoi(threadsStr)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("bad thread count in %q", item)
+			}
+			threads = n
+		}
+		if !isFuzzTarget(name) {
+			return nil, fmt.Errorf("unknown fuzzer: %s", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("fuzzer %s listed twice", name)
+		}
+		seen[name] = true
+		targets = append(targets, TargetSpec{Name: name, Threads: threads})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no fuzzer given")
+	}
+	return targets, nil
+}
+
+// targetsFromConfig turns the config's "targets" section into specs.
+func targetsFromConfig(cfg map[string]int) ([]TargetSpec, error) {
+	var targets []TargetSpec
+	for _, name := range sortedKeys(cfg) {
+		if !isFuzzTarget(name) {
+			return nil, fmt.Errorf("config targets: unknown fuzzer: %s", name)
+		}
+		if cfg[name] <= 0 {
+			return nil, fmt.Errorf("config targets: bad thread count for %s", name)
+		}
+		targets = append(targets, TargetSpec{Name: name, Threads: cfg[name]})
+	}
+	return targets, nil
+}
+
+func formatTargets(targets []TargetSpec) string {
+	parts := make([]string, len(targets))
+	for i, t := range targets {
+		parts[i] = fmt.Sprintf("%s:%d", t.Name, t.Threads)
+	}
+	return strings.Join(parts, ",")
+}
+
+type targetState struct {
+	name    string
+	fuzzer  *Fuzzer
+	want    int
+	running int
+	cases   int64
+	bugs    int64
+	busy    time.Duration
+}
+
+// Scheduler shares one pool of workers between several targets. Each worker
+// takes the target furthest below its allocation before every case, so
+// changing the allocations moves workers as soon as their case finishes.
+type Scheduler struct {
+	mu      sync.Mutex
+	targets []*targetState
+	workers int
+}
+
+func NewScheduler(specs []TargetSpec, diffSim bool, startTime int64) *Scheduler {
+	s := &Scheduler{}
+	for _, spec := range specs {
+		s.targets = append(s.targets, &targetState{
+			name:   spec.Name,
+			fuzzer: newFuzzer(startTime, diffSim, backendsFor(spec.Name)),
+			want:   spec.Threads,
+		})
+		s.workers += spec.Threads
+	}
+	return s
+}
+
+func newFuzzer(startTime int64, diffSim bool, backends []string) *Fuzzer {
+	f := &Fuzzer{
+		StartTime:     startTime,
+		EnableDiffSim: diffSim,
+		Reference:     referenceEnabled,
+		Waveform:      waveformEnabled,
+		Frontends:     activeFrontends(),
+		Backends:      backends,
+		GenOptions:    generatorOptions,
+	}
+	f.Init()
+	return f
+}
+
+// runTargetCase runs one case of the named target and updates the campaign
+// counters.
+func runTargetCase(f *Fuzzer, name string, seed int64, equalNumber int) (bool, time.Duration) {
+	start := time.Now()
+	found := f.RunCase(name, seed, equalNumber)
+	if counter := variantCounter(name); counter != nil {
+		atomic.AddInt64(counter, int64(equalNumber))
+	}
+	atomic.AddInt64(&countCases, 1)
+	return found, time.Since(start)
+}
+
+func (s *Scheduler) target(name string) *targetState {
+	for _, t := range s.targets {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) acquire() *targetState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best := s.targets[0]
+	for _, t := range s.targets[1:] {
+		if t.want-t.running > best.want-best.running {
+			best = t
+		}
+	}
+	best.running++
+	return best
+}
+
+func (s *Scheduler) release(t *targetState, elapsed time.Duration, found bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.running--
+	t.cases++
+	if found {
+		t.bugs++
+	}
+	t.busy += elapsed
+}
+
+// rebalance reallocates the workers in proportion to each target's smoothed
+// bugs per worker-second, i.e. bug yield times throughput. Every target
+// keeps at least one worker so it can still be measured.
+func (s *Scheduler) rebalance() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scores := make([]float64, len(s.targets))
+	total := 0.0
+	for i, t := range s.targets {
+		busy := t.busy.Seconds()
+		if t.cases == 0 || busy == 0 {
+			return ""
+		}
+		yield := (float64(t.bugs) + 1) / (float64(t.cases) + 10)
+		throughput := float64(t.cases) / busy
+		scores[i] = yield * throughput
+		total += scores[i]
+	}
+	spare := s.workers - len(s.targets)
+	assigned := 0
+	for i, t := range s.targets {
+		t.want = 1 + int(math.Floor(float64(spare)*scores[i]/total))
+		assigned += t.want
+	}
+	// hand out the rounding remainder, best score first
+	order := make([]int, len(s.targets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	for i := 0; assigned < s.workers; i = (i + 1) % len(order) {
+		s.targets[order[i]].want++
+		assigned++
+	}
+
+	parts := make([]string, len(s.targets))
+	for i, t := range s.targets {
+		parts[i] = fmt.Sprintf("%s:%d", t.name, t.want)
+	}
+	return strings.Join(parts, ",")
+}
+
+// startRebalancer recomputes the allocation every interval until the
+// campaign stops.
+func (s *Scheduler) startRebalancer(campaign *Campaign, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-campaign.Context().Done():
+				return
+			case <-ticker.C:
+				if allocation := s.rebalance(); allocation != "" {
+					emitEvent(Event{Type: EventAllocation, Detail: allocation})
+					PrettyInfo("adaptive", allocation)
+				}
+			}
+		}
+	}()
+}
+
+// Run drives the workers until the campaign stops. With adaptive set the
+// allocation is recomputed every interval.
+func (s *Scheduler) Run(campaign *Campaign, equalNumber int, adaptive bool, interval time.Duration) {
+	if adaptive {
+		s.startRebalancer(campaign, interval)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for campaign.Next() {
+				seed := campaign.NextSeed()
+				t := s.acquire()
+				found, elapsed := runTargetCase(t.fuzzer, t.name, seed, equalNumber)
+				s.release(t, elapsed, found)
+				// a case cut short by SIGINT runs again after -resume
+				if !campaign.Interrupted() {
+					campaign.Done(seed)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) Fuzzers() []*Fuzzer {
+	fuzzers := make([]*Fuzzer, len(s.targets))
+	for i, t := range s.targets {
+		fuzzers[i] = t.fuzzer
+	}
+	return fuzzers
+}
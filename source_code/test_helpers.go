@@ -3,13 +3,12 @@ package main
 import (
 	"VeriEQ/CodeGenerator"
 	"fmt"
-	"math/rand"
 	"os"
 	"time"
 )
 
 func TestExpressionGenerator() {
-	g := CodeGenerator.NewExpressionGenerator()
+	g := CodeGenerator.NewExpressionGeneratorWithOptions(generatorOptions)
 	data := []byte(g.GenerateLoopFreeModule())
 	err := os.WriteFile("test.v", data, 0644)
 	if err != nil {
@@ -25,7 +24,10 @@ func TestExpressionGenerator() {
 }
 
 func TestOfSimulator() {
-	rand.Seed(time.Now().UnixNano())
+	// case seeds are derived from the campaign seed as in a campaign run,
+	// so a case found here can be rebuilt from its seed
+	campaign := NewCampaign(0, 0, 0)
+	PrettyInfo("test", fmt.Sprintf("campaign seed %d", campaign.Seed))
 	fuzzer := &Fuzzer{
 		StartTime: time.Now().UnixMilli(),
 	}
@@ -35,7 +37,7 @@ func TestOfSimulator() {
 	for i := 0; i < 100; i++ {
 		go func() {
 			for range tasks {
-				fuzzer.Fuzz()
+				fuzzer.Fuzz(campaign.NextSeed(), backendsFor("fuzz"))
 			}
 		}()
 	}
@@ -47,12 +49,12 @@ func TestOfSimulator() {
 }
 
 func TestWidthAndDepth() {
-	generator := CodeGenerator.NewExpressionGenerator()
+	generator := CodeGenerator.NewExpressionGeneratorWithOptions(generatorOptions)
 	generator.OutputNums = 1
 	generator.MaxDepth = 3
 	generator.AssignCount = 32
 	widthContent := generator.GenerateLoopFreeModule()
-	generator = CodeGenerator.NewExpressionGenerator()
+	generator = CodeGenerator.NewExpressionGeneratorWithOptions(generatorOptions)
 	generator.OutputNums = 1
 	generator.MaxDepth = 8
 	generator.AssignCount = 1
@@ -67,7 +69,7 @@ func TestWidthAndDepth() {
 }
 
 func TestEqualExpressionGenerator() {
-	g := CodeGenerator.NewExpressionGenerator()
+	g := CodeGenerator.NewExpressionGeneratorWithOptions(generatorOptions)
 	g.Name = "top"
 
 	equalNumber := 3
@@ -90,12 +92,16 @@ func TestEqualExpressionGenerator() {
 }
 
 func TestAllEquivalence() {
-	StartCounterLogger("cxxrtl_verilator_task_counter.txt")
-
-	//go EqualFuzzIverilog(50, 10)
-	go EqualFuzzVerilator(50, 10, true)
-	//go EqualFuzzYosysOpt(30, 10)
-	go EqualFuzzCXXRTL(50, 10, true)
-
-	select {}
+	campaign := NewCampaign(0, 0, 0)
+	campaign.HandleSignals()
+	eventLog, _ = OpenEventLog(campaign.LogDir())
+	StartCounterLogger(campaign, "verilator+cxxrtl", 30*time.Second)
+	targets := []TargetSpec{
+		//{Name: "iverilog", Threads: 50},
+		{Name: "verilator", Threads: 50},
+		//{Name: "yosys", Threads: 30},
+		{Name: "cxxrtl", Threads: 50},
+	}
+	diffSimEnabled = true
+	RunSelectedFuzzer(targets, 10, campaign, false, time.Minute)
 }
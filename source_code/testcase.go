@@ -0,0 +1,214 @@
+package main
+
+import (
+	"VeriEQ/CodeGenerator"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const caseFileName = "case.json"
+
+// TestCase is everything generated for one fuzzing iteration. All files come
+// from a single generator seeded with Seed and are produced in a fixed order,
+// so the same seed and options always give the same bytes.
+type TestCase struct {
+	Seed             int64    `json:"seed"`
+	Fuzzer           string   `json:"fuzzer"`
+	EqualNumber      int      `json:"count"`
+	DiffSim          bool     `json:"diff_sim"`
+	Backends         []string `json:"backends,omitempty"`
+	PaperInitGen     bool     `json:"paper_init_gen"`
+	ControlFlowEquiv bool     `json:"control_flow_equiv"`
+	XInputs          bool     `json:"x_input"`
+	Observe          bool     `json:"observe,omitempty"`
+	Reference        bool     `json:"reference"`
+	Frontends        []string `json:"frontends,omitempty"`
+
+	Generator *CodeGenerator.ExpressionGenerator `json:"-"`
+	Files     []CaseFile                         `json:"-"`
+	Input     string                             `json:"-"`
+	Expected  string                             `json:"-"`
+	Signals   []CodeGenerator.ObservedSignal     `json:"-"`
+}
+
+type CaseFile struct {
+	Name string
+	Data string
+}
+
+func (f *Fuzzer) NewTestCase(fuzzer string, seed int64, equalNumber int, backends []string) *TestCase {
+	generator := CodeGenerator.NewExpressionGeneratorWithSeed(seed, f.GenOptions)
+	tc := &TestCase{
+		Seed:             seed,
+		Fuzzer:           fuzzer,
+		EqualNumber:      equalNumber,
+		DiffSim:          f.EnableDiffSim,
+		Backends:         backends,
+		PaperInitGen:     f.GenOptions.UsePaperInitGen,
+		ControlFlowEquiv: f.GenOptions.EnableControlFlowEquiv,
+		XInputs:          f.GenOptions.EnableXInputs,
+		Observe:          f.GenOptions.EnableObservability,
+		Reference:        f.Reference && !f.GenOptions.EnableXInputs,
+		Frontends:        f.Frontends,
+		Generator:        generator,
+	}
+
+	if fuzzer == "fuzz" {
+		tc.add(f.TestFileName, generator.GenerateLoopFreeModule())
+	} else {
+		tc.add(f.TestFileName, generator.GenerateLoopFreeEquivalentModules(equalNumber))
+		tc.add(rewritesFileName, generator.Design.RewriteLog())
+	}
+	tc.addBenches(f.TestBenchName)
+	tc.finish(generator.GenerateInputFile())
+	return tc
+}
+
+// addBenches adds the testbenches the case's jobs need for the module last
+// generated.
+func (tc *TestCase) addBenches(tbName string) {
+	generator := tc.Generator
+	if tc.Fuzzer == "fuzz" {
+		tc.add(tbName, generator.GenerateTb())
+		if containsString(tc.Backends, "cxxrtl") {
+			tc.add("main.cpp", generator.GenerateCXXRTLTestBench())
+		}
+		return
+	}
+	tc.add(tbName, generator.GenerateEquivalenceCheckTb(tc.EqualNumber))
+	if tc.Fuzzer == "cxxrtl" && !tc.DiffSim {
+		tc.add("main_eq.cpp", generator.GenerateCXXRTLMultiModuleTestBench(tc.EqualNumber))
+	}
+	// the reference check needs the eq0 outputs even without diff-sim
+	if tc.DiffSim || tc.Reference {
+		tc.add("tb_diff.v", generateEq0Tb(generator))
+		if tc.Fuzzer == "cxxrtl" || containsString(tc.Backends, "cxxrtl") {
+			tc.add("main.cpp", generateEq0CXXTb(generator))
+		}
+	}
+}
+
+// finish adds the input file and what is derived from the module and its
+// input: the expected outputs and the observed signals.
+func (tc *TestCase) finish(input string) {
+	generator := tc.Generator
+	tc.Input = input
+	tc.add(generator.TestBenchInputFileName, tc.Input)
+	if tc.Reference {
+		// constructs the evaluator does not model just skip the check
+		if expected, err := generator.ReferenceOutput(tc.Input); err == nil {
+			tc.Expected = expected
+			tc.add(referenceFileName, expected)
+		}
+	}
+	if tc.Signals = generator.ObservedSignals(); len(tc.Signals) > 0 {
+		// definitions are Verilog; keep their < > & readable
+		var sb strings.Builder
+		enc := json.NewEncoder(&sb)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(tc.Signals)
+		tc.add(signalsFileName, sb.String())
+	}
+}
+
+// EquivJob checks all variants against each other in one testbench.
+func (tc *TestCase) EquivJob(dir string) SimJob {
+	tops := make([]string, tc.EqualNumber)
+	for i := range tops {
+		tops[i] = fmt.Sprintf("%s_eq%d", tc.Generator.Name, i)
+	}
+	return tc.job(dir, "equiv", tops, "tb.v", "tb_equiv_check", "main_eq.cpp")
+}
+
+// DiffJob dumps the outputs of the first variant for cross-simulator
+// comparison.
+func (tc *TestCase) DiffJob(dir string) SimJob {
+	top := fmt.Sprintf("%s_eq0", tc.Generator.Name)
+	return tc.job(dir, "diff", []string{top}, "tb_diff.v", "tb_dut_module", "main.cpp")
+}
+
+// FuzzJob dumps the outputs of the single module of a "fuzz" case.
+func (tc *TestCase) FuzzJob(dir string) SimJob {
+	return tc.job(dir, "", []string{tc.Generator.Name}, "tb.v", "tb_dut_module", "main.cpp")
+}
+
+func (tc *TestCase) job(dir, tag string, tops []string, tb, tbTop, cxxTb string) SimJob {
+	return SimJob{
+		Dir:        dir,
+		Tag:        tag,
+		DesignFile: filepath.Join(dir, "test.v"),
+		DesignTops: tops,
+		TbFile:     filepath.Join(dir, tb),
+		TbTop:      tbTop,
+		CXXTbFile:  filepath.Join(dir, cxxTb),
+		InputFile:  tc.Generator.TestBenchInputFileName,
+		OutputFile: tc.Generator.TestBenchOutputFileName,
+		Seed:       tc.Seed,
+		Fuzzer:     tc.Fuzzer,
+	}
+}
+
+// writeDiffTbs writes the testbenches of DiffJob into dir when the case
+// was generated without them, so eq0 can still be rerun on its own.
+func (tc *TestCase) writeDiffTbs(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "tb_diff.v")); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tb_diff.v"), []byte(generateEq0Tb(tc.Generator)), 0644); err != nil {
+		return err
+	}
+	if tc.Fuzzer == "cxxrtl" || containsString(tc.Backends, "cxxrtl") {
+		return os.WriteFile(filepath.Join(dir, "main.cpp"), []byte(generateEq0CXXTb(tc.Generator)), 0644)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (tc *TestCase) add(name, data string) {
+	tc.Files = append(tc.Files, CaseFile{Name: name, Data: data})
+}
+
+// Write puts the generated files and case.json into dir.
+func (tc *TestCase) Write(dir string) error {
+	if err := tc.writeFiles(dir); err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(tc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, caseFileName), meta, 0644)
+}
+
+func (tc *TestCase) writeFiles(dir string) error {
+	for _, file := range tc.Files {
+		if err := os.WriteFile(filepath.Join(dir, file.Name), []byte(file.Data), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func LoadTestCase(path string) (*TestCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tc := &TestCase{}
+	if err := json.Unmarshal(data, tc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return tc, nil
+}
@@ -0,0 +1,692 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RunReduceText implements `VeriEQ reduce-text`: it shrinks any Verilog
+// file by deleting balanced blocks, lines and tokens, keeping a deletion
+// when the file stays interesting. That is decided by a script, which
+// exits 0 for an interesting file, or by a built-in oracle. Candidates are
+// tried -jobs at a time.
+func RunReduceText(args []string) {
+	fs := flag.NewFlagSet("reduce-text", flag.ExitOnError)
+	file := fs.String("file", "", "Verilog file to reduce")
+	script := fs.String("test", "", "Interestingness script: run in a directory holding the candidate under the file's name, with that name as argument; exit 0 means interesting")
+	oracleSpec := fs.String("oracle", "", "Built-in oracle instead of -test: pair:A,B | crash[:T,...] | reject:T,U,...")
+	tb := fs.String("tb", "", "Testbench that reads input.txt and writes output.txt (default: the file prints its own results)")
+	inputPath := fs.String("input", "", "input.txt for -tb")
+	top := fs.String("top", "", "Top module for verilator (default: the first module of -tb, or the module of the file no other instantiates)")
+	with := fs.String("with", "", "Comma-separated files copied next to every candidate, e.g. for the -test script")
+	jobs := fs.Int("jobs", runtime.NumCPU(), "Candidates tried at once")
+	configPath := fs.String("config", "", "Path to config file")
+	compileLimit := fs.Duration("compile-timeout", compileTimeout, "Default limit for elaboration and C++ builds")
+	runLimit := fs.Duration("run-timeout", runTimeout, "Default limit for one simulation run, and for one run of -test")
+	maxTests := fs.Int("max-tests", 0, "Stop after this many tests (0 = until no deletion is kept)")
+	outPath := fs.String("out", "", "Reduced file (default: <file>.reduced.v)")
+	_ = fs.Parse(args)
+
+	if *file == "" || (*script == "") == (*oracleSpec == "") {
+		PrettyErr("reduce-text", "need -file and one of -test or -oracle")
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		PrettyErr("reduce-text", err.Error())
+		os.Exit(1)
+	}
+	cfg, err := LoadToolConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config load warning: %v\n", err)
+	}
+	toolConfig = cfg
+	compileTimeout = *compileLimit
+	runTimeout = *runLimit
+	if err := toolConfig.validateTimeouts(); err != nil {
+		PrettyErr("reduce-text", err.Error())
+		os.Exit(1)
+	}
+	if *outPath == "" {
+		*outPath = strings.TrimSuffix(*file, filepath.Ext(*file)) + ".reduced.v"
+	}
+	work, err := os.MkdirTemp("", "veq_reduce_text_")
+	if err != nil {
+		PrettyErr("reduce-text", err.Error())
+		os.Exit(1)
+	}
+	defer os.RemoveAll(work)
+
+	r := &textReducer{
+		name:     filepath.Base(*file),
+		text:     string(data),
+		jobs:     max(*jobs, 1),
+		work:     work,
+		maxTests: *maxTests,
+		results:  map[[sha256.Size]byte]bool{},
+	}
+	if *tb != "" {
+		r.with = append(r.with, *tb)
+	}
+	for _, path := range strings.Split(*with, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			r.with = append(r.with, path)
+		}
+	}
+	for _, path := range r.with {
+		if _, err := os.Stat(path); err != nil {
+			PrettyErr("reduce-text", err.Error())
+			os.Exit(1)
+		}
+	}
+	if *script != "" {
+		path, err := filepath.Abs(*script)
+		if err != nil {
+			PrettyErr("reduce-text", err.Error())
+			os.Exit(1)
+		}
+		r.test = func(dir string) bool {
+			return runTool(SimJob{Dir: dir}, "test", PhaseSimulation, dir, filepath.Join(dir, "test.log"), path, r.name) == nil
+		}
+	} else {
+		o, err := parseTextOracle(*oracleSpec, *tb != "")
+		if err != nil {
+			PrettyErr("reduce-text", err.Error())
+			os.Exit(1)
+		}
+		input := ""
+		if *inputPath != "" {
+			data, err := os.ReadFile(*inputPath)
+			if err != nil {
+				PrettyErr("reduce-text", err.Error())
+				os.Exit(1)
+			}
+			input = string(data)
+		}
+		t := &textOracle{Oracle: o, input: input, top: *top}
+		if *tb != "" {
+			t.tb = filepath.Base(*tb)
+			if t.top == "" {
+				data, _ := os.ReadFile(*tb)
+				if modules := moduleNames(string(data)); len(modules) > 0 {
+					t.top = modules[0]
+				}
+			}
+		}
+		r.oracle = t
+		r.test = func(dir string) bool {
+			return t.holds(dir, r.name)
+		}
+	}
+
+	PrettyInfo("reduce-text", fmt.Sprintf("%s: %d bytes, %s", *file, len(r.text), r.describe()))
+	ok, err := r.start()
+	if err != nil {
+		PrettyErr("reduce-text", err.Error())
+		os.Exit(1)
+	}
+	if !ok {
+		PrettyErr("reduce-text", "the file is not interesting to begin with")
+		os.Exit(1)
+	}
+	before := len(r.text)
+	if err := r.reduce(); err != nil {
+		PrettyErr("reduce-text", err.Error())
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*outPath, []byte(r.text), 0o644); err != nil {
+		PrettyErr("reduce-text", err.Error())
+		os.Exit(1)
+	}
+	PrettyOK("reduce-text", fmt.Sprintf("%d -> %d bytes in %d tests, written to %s", before, len(r.text), r.tests, *outPath))
+}
+
+// textReducer holds the text being reduced.
+type textReducer struct {
+	name string
+	text string
+	// with are copied next to every candidate.
+	with     []string
+	test     func(dir string) bool
+	oracle   *textOracle
+	jobs     int
+	work     string
+	tests    int
+	maxTests int
+	// results caches test by candidate.
+	results map[[sha256.Size]byte]bool
+}
+
+func (r *textReducer) describe() string {
+	if r.oracle == nil {
+		return "script"
+	}
+	return "oracle " + r.oracle.String()
+}
+
+func (r *textReducer) budgetSpent() bool {
+	return r.maxTests > 0 && r.tests >= r.maxTests
+}
+
+// start tests the unreduced text. A crash or rejection oracle without a
+// bucket takes that of the first tool that fails, so that the reduced
+// file keeps failing the same way.
+func (r *textReducer) start() (bool, error) {
+	if r.oracle != nil && (r.oracle.Kind == "crash" || r.oracle.Kind == "reject") {
+		r.oracle.pin = true
+		defer func() { r.oracle.pin = false }()
+	}
+	i, err := r.first([]string{r.text})
+	return i == 0, err
+}
+
+// first tests candidates, up to jobs at a time, and returns the index of
+// the first interesting one, or -1. A candidate that cannot be written is
+// an error, not an uninteresting candidate.
+func (r *textReducer) first(candidates []string) (int, error) {
+	ok := make([]bool, len(candidates))
+	errs := make([]error, len(candidates))
+	keys := make([][sha256.Size]byte, len(candidates))
+	tested := make([]bool, len(candidates))
+	var wg sync.WaitGroup
+	for i, text := range candidates {
+		keys[i] = sha256.Sum256([]byte(text))
+		if cached, seen := r.results[keys[i]]; seen {
+			ok[i] = cached
+			continue
+		}
+		if r.budgetSpent() {
+			break
+		}
+		r.tests++
+		tested[i] = true
+		dir := filepath.Join(r.work, strconv.Itoa(r.tests))
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			defer os.RemoveAll(dir)
+			if errs[i] = r.prepare(dir, text); errs[i] == nil {
+				ok[i] = r.test(dir)
+			}
+		}(i, text)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return -1, err
+		}
+	}
+	first := -1
+	for i := range candidates {
+		if tested[i] {
+			r.results[keys[i]] = ok[i]
+		}
+		if ok[i] && first < 0 {
+			first = i
+		}
+	}
+	return first, nil
+}
+
+// prepare writes a candidate and the files that go with it into dir.
+func (r *textReducer) prepare(dir, text string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, path := range r.with {
+		if err := copyFile(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, r.name), []byte(text), 0o644)
+}
+
+// reduce runs the passes in turn until a round keeps no deletion or the
+// test budget is spent.
+func (r *textReducer) reduce() error {
+	passes := []struct {
+		name    string
+		units   func(string) []cut
+		chunked bool
+	}{
+		{"blocks", blockCuts, false},
+		{"lines", lineCuts, true},
+		{"tokens", tokenCuts, true},
+	}
+	for progress := true; progress && !r.budgetSpent(); {
+		progress = false
+		for _, p := range passes {
+			before := len(r.text)
+			kept, err := r.pass(p.units, p.chunked)
+			if err != nil {
+				return err
+			}
+			if kept {
+				progress = true
+			}
+			PrettyInfo("reduce-text", fmt.Sprintf("%s: %d -> %d bytes, %d tests", p.name, before, len(r.text), r.tests))
+			if r.budgetSpent() {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// pass deletes the units of one kind. Chunked passes delete runs of units,
+// halving their length down to single units; a batch of jobs neighbouring
+// runs is tested at once and the first interesting one is kept.
+func (r *textReducer) pass(units func(string) []cut, chunked bool) (bool, error) {
+	kept := false
+	size := 1
+	if chunked {
+		size = max(len(units(r.text))/2, 1)
+	}
+	for ; ; size /= 2 {
+		for i := 0; !r.budgetSpent(); {
+			cuts := units(r.text)
+			if i >= len(cuts) {
+				break
+			}
+			var candidates []string
+			for j := i; j < len(cuts) && len(candidates) < r.jobs; j += size {
+				candidates = append(candidates, applyCuts(r.text, cuts[j:min(j+size, len(cuts))]))
+			}
+			k, err := r.first(candidates)
+			if err != nil {
+				return kept, err
+			}
+			if k < 0 {
+				i += size * len(candidates)
+				continue
+			}
+			// the runs before k stay; the one after them is now at i+k*size
+			r.text = candidates[k]
+			kept = true
+			i += k * size
+		}
+		if size == 1 || r.budgetSpent() {
+			return kept, nil
+		}
+	}
+}
+
+// span is a byte range of the text; a cut deletes one or more spans.
+type span struct{ start, end int }
+
+type cut []span
+
+// applyCuts deletes the spans of cuts, which may overlap.
+func applyCuts(text string, cuts []cut) string {
+	drop := make([]bool, len(text))
+	for _, c := range cuts {
+		for _, s := range c {
+			for i := s.start; i < s.end; i++ {
+				drop[i] = true
+			}
+		}
+	}
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if !drop[i] {
+			sb.WriteByte(text[i])
+		}
+	}
+	return sb.String()
+}
+
+func lineCuts(text string) []cut {
+	var cuts []cut
+	for start := 0; start < len(text); {
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += start + 1
+		}
+		if strings.TrimSpace(text[start:end]) != "" {
+			cuts = append(cuts, cut{{start, end}})
+		}
+		start = end
+	}
+	return cuts
+}
+
+func tokenCuts(text string) []cut {
+	var cuts []cut
+	for _, t := range tokenize(text) {
+		cuts = append(cuts, cut{t})
+	}
+	return cuts
+}
+
+// blockPairs close the keywords that open a block.
+var blockPairs = map[string][]string{
+	"module":      {"endmodule"},
+	"macromodule": {"endmodule"},
+	"begin":       {"end"},
+	"case":        {"endcase"},
+	"casex":       {"endcase"},
+	"casez":       {"endcase"},
+	"fork":        {"join", "join_any", "join_none"},
+	"function":    {"endfunction"},
+	"task":        {"endtask"},
+	"generate":    {"endgenerate"},
+	"specify":     {"endspecify"},
+	"(":           {")"},
+	"{":           {"}"},
+	"[":           {"]"},
+}
+
+// unwrapped are the blocks whose delimiters alone are worth deleting.
+var unwrapped = map[string]bool{"begin": true, "fork": true, "(": true}
+
+// blockCuts deletes each balanced block, and for some takes away only the
+// delimiters.
+func blockCuts(text string) []cut {
+	type open struct {
+		word string
+		tok  span
+	}
+	var stack []open
+	var cuts []cut
+	for _, t := range tokenize(text) {
+		word := text[t.start:t.end]
+		if _, ok := blockPairs[word]; ok {
+			stack = append(stack, open{word, t})
+			continue
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			if !containsString(blockPairs[stack[i].word], word) {
+				continue
+			}
+			o := stack[i]
+			stack = stack[:i]
+			cuts = append(cuts, cut{{o.tok.start, t.end}})
+			if unwrapped[o.word] {
+				cuts = append(cuts, cut{o.tok, t})
+			}
+			break
+		}
+	}
+	// outer blocks first
+	sortCuts(cuts)
+	return cuts
+}
+
+func sortCuts(cuts []cut) {
+	for i := 1; i < len(cuts); i++ {
+		for j := i; j > 0 && cuts[j][0].start < cuts[j-1][0].start; j-- {
+			cuts[j], cuts[j-1] = cuts[j-1], cuts[j]
+		}
+	}
+}
+
+// operators are the Verilog operators of more than one character, longest
+// first.
+var operators = []string{
+	"<<<=", ">>>=", "<<<", ">>>", "===", "!==",
+	"==", "!=", "<=", ">=", "&&", "||", "<<", ">>", "**", "~&", "~|", "~^", "^~", "->", "+:", "-:", "::",
+}
+
+// tokenize splits Verilog text into tokens: comments, strings, names,
+// numbers with their base, directives and operators. Whitespace is left
+// out.
+func tokenize(text string) []span {
+	isName := func(c byte) bool {
+		return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	var tokens []span
+	for i := 0; i < len(text); {
+		c := text[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case strings.HasPrefix(text[i:], "//"):
+			i = len(text)
+			if end := strings.IndexByte(text[start:], '\n'); end >= 0 {
+				i = start + end
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			i = len(text)
+			if end := strings.Index(text[start+2:], "*/"); end >= 0 {
+				i = start + 2 + end + 2
+			}
+		case c == '"':
+			for i++; i < len(text) && text[i] != '"' && text[i] != '\n'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+			i = min(i+1, len(text))
+		case c == '\\':
+			for i++; i < len(text) && text[i] != ' ' && text[i] != '\t' && text[i] != '\n'; i++ {
+			}
+		case isName(c) || c == '`' || c == '\'':
+			for i++; i < len(text) && isName(text[i]); i++ {
+			}
+			// a size and its based value are one number: 8'sb1010, 'hff
+			if c == '\'' || c >= '0' && c <= '9' && i < len(text) && text[i] == '\'' {
+				if c != '\'' {
+					i++
+				}
+				for i < len(text) && strings.IndexByte("sS", text[i]) >= 0 {
+					i++
+				}
+				if i < len(text) && strings.IndexByte("bBoOdDhH", text[i]) >= 0 {
+					i++
+				}
+				for i < len(text) && (isName(text[i]) || text[i] == '?') {
+					i++
+				}
+			}
+		default:
+			i++
+			for _, op := range operators {
+				if strings.HasPrefix(text[start:], op) {
+					i = start + len(op)
+					break
+				}
+			}
+		}
+		tokens = append(tokens, span{start, i})
+	}
+	return tokens
+}
+
+// moduleNames lists the modules text declares, in order.
+func moduleNames(text string) []string {
+	var names []string
+	tokens := tokenize(text)
+	for i := 0; i+1 < len(tokens); i++ {
+		if word := text[tokens[i].start:tokens[i].end]; word == "module" || word == "macromodule" {
+			names = append(names, text[tokens[i+1].start:tokens[i+1].end])
+		}
+	}
+	return names
+}
+
+// topModule is the module of text no other module instantiates.
+func topModule(text string) string {
+	names := moduleNames(text)
+	used := map[string]bool{}
+	tokens := tokenize(text)
+	for i := 0; i+1 < len(tokens); i++ {
+		word := text[tokens[i].start:tokens[i].end]
+		if containsString(names, word) && text[tokens[max(i-1, 0)].start:tokens[max(i-1, 0)].end] != "module" {
+			used[word] = true
+		}
+	}
+	for _, name := range names {
+		if !used[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// textOracle checks an Oracle on a plain file. With a testbench it
+// compares output.txt like the fuzzer; without one the file prints its own
+// results and the simulators' console output is compared.
+type textOracle struct {
+	Oracle
+	tb    string
+	top   string
+	input string
+	// pin makes the next check take the bucket of the failure it sees.
+	pin bool
+	mu  sync.Mutex
+}
+
+func parseTextOracle(spec string, withTb bool) (Oracle, error) {
+	o, err := parseOracle(spec)
+	if err != nil {
+		return o, err
+	}
+	switch o.Kind {
+	case "equiv", "reference":
+		return o, fmt.Errorf("oracle %s needs a generated case; use reduce", o.Kind)
+	case "crash":
+		if len(o.Tools) == 0 {
+			o.Tools = defaultFrontends
+		}
+		if _, err := parseBackends(strings.Join(o.Tools, ",")); err != nil {
+			return o, err
+		}
+	}
+	if o.Kind != "reject" && !withTb && containsString(o.Tools, "cxxrtl") {
+		return o, errors.New("cxxrtl needs a C++ testbench; reduce with -test")
+	}
+	return o, nil
+}
+
+// job describes the candidate in dir. Without a testbench the file is
+// elaborated with an empty one.
+func (t *textOracle) job(dir, name string) SimJob {
+	job := SimJob{Dir: dir, DesignFile: filepath.Join(dir, name), TbTop: t.top}
+	if t.tb != "" {
+		job.TbFile = filepath.Join(dir, t.tb)
+		return job
+	}
+	job.TbFile = filepath.Join(dir, "empty_tb.v")
+	_ = os.WriteFile(job.TbFile, nil, 0o644)
+	if job.TbTop == "" {
+		data, _ := os.ReadFile(job.DesignFile)
+		job.TbTop = topModule(string(data))
+	}
+	return job
+}
+
+func (t *textOracle) holds(dir, name string) bool {
+	job := t.job(dir, name)
+	switch t.Kind {
+	case "pair":
+		a, err := t.simulate(t.Tools[0], job)
+		if err != nil {
+			return false
+		}
+		b, err := t.simulate(t.Tools[1], job)
+		if err != nil {
+			return false
+		}
+		return !outputsMatch(a, b, false)
+	case "crash":
+		for _, tool := range t.Tools {
+			_, err := t.simulate(tool, job)
+			var toolErr *ToolError
+			if !errors.As(err, &toolErr) {
+				continue
+			}
+			if _, rejected := rejection(toolErr); rejected {
+				continue
+			}
+			if t.keeps(crashSignature(toolErr).Bucket()) {
+				return true
+			}
+		}
+		return false
+	case "reject":
+		for i, tool := range t.Tools {
+			err := runFrontend(tool, job)
+			if i > 0 {
+				if err != nil {
+					return false
+				}
+				continue
+			}
+			var toolErr *ToolError
+			if !errors.As(err, &toolErr) {
+				return false
+			}
+			msg, ok := rejection(toolErr)
+			if !ok || !t.keeps((Signature{Kind: "rejection", Tool: tool, Phase: PhaseFrontend, Message: msg}).Bucket()) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// keeps reports whether a failure in bucket is the one being reduced.
+func (t *textOracle) keeps(bucket string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pin && t.Bucket == "" {
+		t.Bucket = bucket
+	}
+	return t.Bucket == "" || bucket == t.Bucket
+}
+
+// simulate runs job on the named simulator and returns output.txt, or
+// without a testbench what the simulation printed.
+func (t *textOracle) simulate(name string, job SimJob) ([]byte, error) {
+	if t.tb != "" {
+		return simulateNamed(name, job, t.input)
+	}
+	sim, err := NewSimulator(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := sim.Compile(job); err != nil {
+		return nil, err
+	}
+	log := runLog(sim)
+	offset := int64(0)
+	if info, err := os.Stat(log); err == nil {
+		offset = info.Size()
+	}
+	if err := sim.Run(t.input); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		return nil, err
+	}
+	return printedLines(data[min(offset, int64(len(data))):]), nil
+}
+
+// printedLines drops what a simulator prints on its own when the design
+// finishes.
+func printedLines(data []byte) []byte {
+	var sb strings.Builder
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.Contains(line, "$finish") || strings.Contains(line, "$stop") ||
+			strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "VCD info") {
+			continue
+		}
+		sb.WriteString(line + "\n")
+	}
+	return []byte(sb.String())
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pieces renders what each cut deletes, or what remains after it.
+func pieces(text string, cuts []cut, remains bool) []string {
+	var out []string
+	for _, c := range cuts {
+		if remains {
+			out = append(out, applyCuts(text, []cut{c}))
+			continue
+		}
+		var parts []string
+		for _, s := range c {
+			parts = append(parts, text[s.start:s.end])
+		}
+		out = append(out, strings.Join(parts, "|"))
+	}
+	return out
+}
+
+func TestApplyCuts(t *testing.T) {
+	tests := []struct {
+		text string
+		cuts []cut
+		want string
+	}{
+		{"abcdef", nil, "abcdef"},
+		{"abcdef", []cut{{{1, 3}}}, "adef"},
+		{"abcdef", []cut{{{0, 1}, {5, 6}}}, "bcde"},
+		// overlapping cuts delete the union
+		{"abcdef", []cut{{{1, 3}}, {{2, 4}, {5, 6}}}, "ae"},
+		{"abcdef", []cut{{{0, 6}}}, ""},
+	}
+	for _, tt := range tests {
+		if got := applyCuts(tt.text, tt.cuts); got != tt.want {
+			t.Errorf("applyCuts(%q, %v) = %q, want %q", tt.text, tt.cuts, got, tt.want)
+		}
+	}
+}
+
+func TestLineCuts(t *testing.T) {
+	text := "a\n\n  \nb c\nd"
+	got := pieces(text, lineCuts(text), false)
+	want := []string{"a\n", "b c\n", "d"}
+	if strings.Join(got, "") != strings.Join(want, "") || len(got) != len(want) {
+		t.Errorf("lineCuts = %q, want %q", got, want)
+	}
+}
+
+func TestTokenCuts(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"assign x = 8'sb1010 >>> y; // c", []string{"assign", "x", "=", "8'sb1010", ">>>", "y", ";", "// c"}},
+		{"a<=b<<<2'hf ?'h1:c", []string{"a", "<=", "b", "<<<", "2'hf", "?", "'h1", ":", "c"}},
+		// ? is a digit of a based number, as in casez items
+		{"4'b1?0? :", []string{"4'b1?0?", ":"}},
+		{"$display(\"a \\\" b\"); /* x\ny */ `define", []string{"$display", "(", "\"a \\\" b\"", ")", ";", "/* x\ny */", "`define"}},
+		{"\\esc+name  x", []string{"\\esc+name", "x"}},
+	}
+	for _, tt := range tests {
+		got := pieces(tt.text, tokenCuts(tt.text), false)
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("tokenCuts(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBlockCuts(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{
+			"module m; begin x; end endmodule",
+			[]string{"", "module m;  endmodule", "module m;  x;  endmodule"},
+		},
+		{
+			// only the parentheses can go, or what they hold with them
+			"assign y = (a + b);",
+			[]string{"assign y = ;", "assign y = a + b;"},
+		},
+		{
+			"case (s) 1: x; endcase",
+			[]string{"", "case  1: x; endcase", "case s 1: x; endcase"},
+		},
+		{
+			// endmodule is not end
+			"begin endmodule",
+			nil,
+		},
+		{
+			"assign y = {a[1], b};",
+			[]string{"assign y = ;", "assign y = {a, b};"},
+		},
+	}
+	for _, tt := range tests {
+		got := pieces(tt.text, blockCuts(tt.text), true)
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("blockCuts(%q) leaves %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func newTestTextReducer(t *testing.T, text string, test func(dir string) bool) *textReducer {
+	return &textReducer{
+		name:    "test.v",
+		text:    text,
+		test:    test,
+		jobs:    2,
+		work:    t.TempDir(),
+		results: map[[sha256.Size]byte]bool{},
+	}
+}
+
+func TestTextReduce(t *testing.T) {
+	text := `module m(input a, output y);
+  wire x = a;
+  assign y = x ^ y;
+  always @(*) begin
+    $display("hi");
+  end
+endmodule
+`
+	r := newTestTextReducer(t, text, func(dir string) bool {
+		data, err := os.ReadFile(filepath.Join(dir, "test.v"))
+		return err == nil && strings.Contains(string(data), "x ^ y")
+	})
+	if ok, err := r.start(); err != nil || !ok {
+		t.Fatalf("start: %v, %v", ok, err)
+	}
+	if err := r.reduce(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(r.text); got != "x ^ y" {
+		t.Errorf("reduced to %q", r.text)
+	}
+}
+
+func TestTextReduceWriteError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestTextReducer(t, "module m; endmodule\n", func(string) bool { return true })
+	r.work = file
+	if ok, err := r.start(); err == nil || ok {
+		t.Errorf("start: %v, %v; want an error", ok, err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const voteFileName = "vote.txt"
+
+// LineVote is the verdict on one differing output line. Minority is empty
+// when no value was printed by more tools than every other value.
+type LineVote struct {
+	Line     int
+	Values   map[string]string
+	Majority []string
+	Minority []string
+}
+
+// Vote compares the outputs of several tools line by line. A tool outvoted
+// on a line is suspected for it; Suspect is the tool outvoted on the most
+// lines, or "" when nobody was outvoted or tools tie.
+type Vote struct {
+	Tools   []string
+	Lines   []LineVote
+	Counts  map[string]int
+	Suspect string
+}
+
+// voteOutputs votes line by line. With fourState a record holding X or Z
+// abstains, so a 4-state simulator is not outvoted for its X.
+func voteOutputs(tools []string, outputs [][]byte, fourState bool) *Vote {
+	lines := make([][]string, len(outputs))
+	n := 0
+	for i, out := range outputs {
+		lines[i] = strings.Split(string(out), "\n")
+		n = max(n, len(lines[i]))
+	}
+
+	v := &Vote{Tools: tools, Counts: map[string]int{}}
+	for l := 0; l < n; l++ {
+		lv := LineVote{Line: l + 1, Values: map[string]string{}}
+		groups := map[string][]string{}
+		var order []string
+		for i, tool := range tools {
+			value := "<missing>"
+			if l < len(lines[i]) {
+				value = lines[i][l]
+			}
+			lv.Values[tool] = value
+			if fourState && hasUnknown(value) {
+				continue
+			}
+			if _, ok := groups[value]; !ok {
+				order = append(order, value)
+			}
+			groups[value] = append(groups[value], tool)
+		}
+		if len(groups) <= 1 {
+			continue
+		}
+		best, tie := order[0], false
+		for _, value := range order[1:] {
+			switch {
+			case len(groups[value]) > len(groups[best]):
+				best, tie = value, false
+			case len(groups[value]) == len(groups[best]):
+				tie = true
+			}
+		}
+		if !tie {
+			lv.Majority = groups[best]
+			for _, value := range order {
+				if value != best {
+					lv.Minority = append(lv.Minority, groups[value]...)
+				}
+			}
+			for _, tool := range lv.Minority {
+				v.Counts[tool]++
+			}
+		}
+		v.Lines = append(v.Lines, lv)
+	}
+
+	top := 0
+	for _, tool := range tools {
+		switch c := v.Counts[tool]; {
+		case c > top:
+			top, v.Suspect = c, tool
+		case c == top && c > 0:
+			v.Suspect = ""
+		}
+	}
+	return v
+}
+
+func hasUnknown(line string) bool {
+	rec, ok := parseRecord(line)
+	return ok && strings.ContainsAny(rec.Value, "xXzZ")
+}
+
+func (v *Vote) String() string {
+	var sb strings.Builder
+	suspect := v.Suspect
+	if suspect == "" {
+		suspect = "undecided"
+	}
+	fmt.Fprintf(&sb, "suspect: %s\nvoters: %s\n", suspect, strings.Join(v.Tools, ", "))
+	for _, tool := range v.Tools {
+		if v.Counts[tool] > 0 {
+			fmt.Fprintf(&sb, "%s outvoted on %d of %d differing lines\n", tool, v.Counts[tool], len(v.Lines))
+		}
+	}
+	for _, lv := range v.Lines {
+		fmt.Fprintf(&sb, "\nLine %d:", lv.Line)
+		if len(lv.Minority) == 0 {
+			sb.WriteString(" no majority")
+		} else {
+			fmt.Fprintf(&sb, " minority %s", strings.Join(lv.Minority, ", "))
+		}
+		sb.WriteString("\n")
+		for _, tool := range v.Tools {
+			fmt.Fprintf(&sb, "  %s: %s\n", tool, lv.Values[tool])
+		}
+	}
+	return sb.String()
+}
+
+// voteOnCase lets the simulators, and the reference evaluator when the case
+// has one, vote on a reported mismatch. It writes vote.txt into dir and
+// returns the suspected tool, or "" without a clear minority. Two voters
+// can only tie, so nothing is written for them.
+func voteOnCase(tc *TestCase, dir string, sims []string, outputs [][]byte) string {
+	tools := append([]string(nil), sims...)
+	outs := append([][]byte(nil), outputs...)
+	if tc.Expected != "" {
+		tools = append(tools, "reference")
+		outs = append(outs, []byte(tc.Expected))
+	}
+	if len(tools) < 3 {
+		return ""
+	}
+	v := voteOutputs(tools, outs, tc.XInputs)
+	_ = os.WriteFile(filepath.Join(dir, voteFileName), []byte(v.String()), 0o644)
+	return v.Suspect
+}
+
+func suspectDetail(suspect string) string {
+	if suspect == "" {
+		return "suspect: undecided"
+	}
+	return "suspect: " + suspect
+}
+
+// bugDirName names a mismatch directory, tagged with the suspected tool.
+func bugDirName(curTimeStr, suspect string) string {
+	name := "bug_" + curTimeStr + "_" + GetRandomFileName("", "", "")
+	if suspect != "" {
+		name += "_" + suspect
+	}
+	return name
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func outRecords(values ...string) []byte {
+	var sb strings.Builder
+	for i, value := range values {
+		fmt.Fprintf(&sb, "cycle=%d signal=out0 width=4 signed=0 value=%s\n", i, value)
+	}
+	return []byte(sb.String())
+}
+
+func TestVoteOutputs(t *testing.T) {
+	tools := []string{"iverilog", "verilator", "cxxrtl"}
+	tests := []struct {
+		name      string
+		tools     []string
+		outputs   [][]byte
+		fourState bool
+		suspect   string
+		lines     int
+		minority  string
+	}{
+		{"clear minority", tools, [][]byte{outRecords("1", "2"), outRecords("1", "2"), outRecords("1", "3")}, false, "cxxrtl", 1, "cxxrtl"},
+		{"outvoted on more lines", tools, [][]byte{outRecords("5", "2"), outRecords("1", "3"), outRecords("1", "3")}, false, "iverilog", 2, "iverilog"},
+		{"two against two", []string{"a", "b", "c", "d"},
+			[][]byte{outRecords("1"), outRecords("1"), outRecords("2"), outRecords("2")}, false, "", 1, ""},
+		{"three values", tools, [][]byte{outRecords("1"), outRecords("2"), outRecords("3")}, false, "", 1, ""},
+		{"tools outvoted equally often", tools, [][]byte{outRecords("1", "2"), outRecords("4", "2"), outRecords("1", "3")}, false, "", 2, "verilator"},
+		{"X abstains", tools, [][]byte{outRecords("x"), outRecords("1"), outRecords("1")}, true, "", 0, ""},
+		{"X outvoted in two-state", tools, [][]byte{outRecords("x"), outRecords("1"), outRecords("1")}, false, "iverilog", 1, "iverilog"},
+		{"Z abstains, the rest disagree", tools, [][]byte{outRecords("z"), outRecords("1"), outRecords("2")}, true, "", 1, ""},
+	}
+	for _, tt := range tests {
+		v := voteOutputs(tt.tools, tt.outputs, tt.fourState)
+		if v.Suspect != tt.suspect || len(v.Lines) != tt.lines {
+			t.Errorf("%s: suspect %q on %d lines, want %q on %d", tt.name, v.Suspect, len(v.Lines), tt.suspect, tt.lines)
+			continue
+		}
+		if tt.lines > 0 {
+			if got := strings.Join(v.Lines[0].Minority, ","); got != tt.minority {
+				t.Errorf("%s: minority of the first line %q, want %q", tt.name, got, tt.minority)
+			}
+		}
+	}
+}
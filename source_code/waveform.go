@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// waveformDiffFileName compares the VCD dumps of a reported case.
+const waveformDiffFileName = "waveform_diff.txt"
+
+// maxListedSignals bounds the signal lists of a waveform report.
+const maxListedSignals = 16
+
+// Waveform is a parsed VCD dump. Signals are named by their path below the
+// uut instance, so the dumps of different simulators line up; times are in
+// femtoseconds.
+type Waveform struct {
+	Signals map[string]*WaveSignal
+}
+
+// WaveSignal holds the value changes of one signal, as binary strings of
+// Width digits, most significant first.
+type WaveSignal struct {
+	Name    string
+	Width   int
+	Changes []WaveChange
+}
+
+type WaveChange struct {
+	Time  uint64
+	Value string
+}
+
+// valueAt returns the value of s at time t, or "" before its first change.
+func (s *WaveSignal) valueAt(t uint64) string {
+	i := sort.Search(len(s.Changes), func(i int) bool { return s.Changes[i].Time > t })
+	if i == 0 {
+		return ""
+	}
+	return s.Changes[i-1].Value
+}
+
+var timeUnits = map[string]uint64{
+	"s":  1e15,
+	"ms": 1e12,
+	"us": 1e9,
+	"ns": 1e6,
+	"ps": 1e3,
+	"fs": 1,
+}
+
+func readWaveform(path string) (*Waveform, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	w, err := parseVCD(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+// parseVCD reads the declarations and value changes of a VCD file. Real
+// and string values are skipped.
+func parseVCD(r *bufio.Reader) (*Waveform, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	scanner.Split(bufio.ScanWords)
+	next := func() (string, bool) {
+		if !scanner.Scan() {
+			return "", false
+		}
+		return scanner.Text(), true
+	}
+	// block returns the tokens up to the next $end
+	block := func() []string {
+		var tokens []string
+		for tok, ok := next(); ok && tok != "$end"; tok, ok = next() {
+			tokens = append(tokens, tok)
+		}
+		return tokens
+	}
+
+	w := &Waveform{Signals: map[string]*WaveSignal{}}
+	ids := map[string][]*WaveSignal{}
+	var scopes []string
+	unit := uint64(1)
+	var now uint64
+	change := func(id, value string) {
+		for _, s := range ids[id] {
+			s.Changes = append(s.Changes, WaveChange{Time: now, Value: extendValue(value, s.Width)})
+		}
+	}
+
+	for tok, ok := next(); ok; tok, ok = next() {
+		switch {
+		case tok == "$timescale":
+			scale := strings.Join(block(), "")
+			digits := strings.TrimRight(scale, "munpfs")
+			n, err := strconv.ParseUint(digits, 10, 64)
+			factor, known := timeUnits[scale[len(digits):]]
+			if err != nil || !known {
+				return nil, fmt.Errorf("bad timescale %q", scale)
+			}
+			unit = n * factor
+		case tok == "$scope":
+			if fields := block(); len(fields) >= 2 {
+				scopes = append(scopes, fields[1])
+			}
+		case tok == "$upscope":
+			block()
+			if len(scopes) > 0 {
+				scopes = scopes[:len(scopes)-1]
+			}
+		case tok == "$var":
+			fields := block()
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("bad $var %q", strings.Join(fields, " "))
+			}
+			width, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad $var width %q", fields[1])
+			}
+			name := waveName(scopes, fields[3])
+			s, ok := w.Signals[name]
+			if !ok {
+				s = &WaveSignal{Name: name, Width: width}
+				w.Signals[name] = s
+			}
+			ids[fields[2]] = append(ids[fields[2]], s)
+		case tok == "$comment", tok == "$date", tok == "$version":
+			block()
+		case strings.HasPrefix(tok, "$"):
+			// $enddefinitions, $dumpvars, $end and friends only frame the
+			// value changes
+		case tok[0] == '#':
+			t, err := strconv.ParseUint(tok[1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad time %q", tok)
+			}
+			now = t * unit
+		case tok[0] == 'b' || tok[0] == 'B':
+			id, ok := next()
+			if !ok {
+				return nil, fmt.Errorf("value %q without identifier", tok)
+			}
+			change(id, strings.ToLower(tok[1:]))
+		case tok[0] == 'r' || tok[0] == 'R' || tok[0] == 's' || tok[0] == 'S':
+			next()
+		default:
+			change(tok[1:], strings.ToLower(tok[:1]))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// waveName drops the scopes down to and including the uut instance:
+// Icarus dumps tb_dut_module.uut.wire_1, Verilator TOP.tb_dut_module.uut.wire_1
+// and CXXRTL wire_1.
+func waveName(scopes []string, ref string) string {
+	start := 0
+	for i, scope := range scopes {
+		if scope == "uut" {
+			start = i + 1
+		}
+	}
+	return strings.Join(append(append([]string(nil), scopes[start:]...), ref), ".")
+}
+
+// extendValue widens a VCD vector to width digits; a leading x or z is
+// extended, anything else with zeros.
+func extendValue(value string, width int) string {
+	if len(value) >= width {
+		return value[len(value)-width:]
+	}
+	pad := "0"
+	if value != "" && unknownDigit(value[0]) {
+		pad = value[:1]
+	}
+	return strings.Repeat(pad, width-len(value)) + value
+}
+
+// compatibleBits reports whether two binary values agree on every bit known
+// on both sides.
+func compatibleBits(a, b string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] && !unknownDigit(a[i]) && !unknownDigit(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// The testbenches read input vector i at firstVector + i*vectorPeriod (see
+// GenerateTb; the CXXRTL one samples at the same times).
+const (
+	firstVector  = 8000 * 1e6
+	vectorPeriod = 4000 * 1e6
+)
+
+// formatTime prints a time in femtoseconds in ns, or a finer unit that
+// divides it, with the cycle of the output records it falls in.
+func formatTime(t uint64) string {
+	s := fmt.Sprintf("%d fs", t)
+	for _, unit := range []string{"ns", "ps"} {
+		if f := timeUnits[unit]; t%f == 0 {
+			s = fmt.Sprintf("%d %s", t/f, unit)
+			break
+		}
+	}
+	if t >= firstVector {
+		s += fmt.Sprintf(" (cycle %d)", (t-firstVector)/vectorPeriod)
+	}
+	return s
+}
+
+func listSignals(names []string) string {
+	if len(names) > maxListedSignals {
+		return fmt.Sprintf("%s, ... %d more", strings.Join(names[:maxListedSignals], ", "), len(names)-maxListedSignals)
+	}
+	return strings.Join(names, ", ")
+}
+
+// diffWaveforms compares the signals both dumps have. A signal diverges at
+// the first time both sides hold a value and a bit known on both differs;
+// X and Z match anything, and values within one time step are settled
+// before comparing.
+func diffWaveforms(leftLabel string, left *Waveform, rightLabel string, right *Waveform) string {
+	type divergence struct {
+		name        string
+		time        uint64
+		left, right string
+	}
+	var divergences []divergence
+	var leftOnly, rightOnly []string
+	for name, l := range left.Signals {
+		r, ok := right.Signals[name]
+		if !ok {
+			leftOnly = append(leftOnly, name)
+			continue
+		}
+		if l.Width != r.Width {
+			continue
+		}
+		var times []uint64
+		for _, c := range l.Changes {
+			times = append(times, c.Time)
+		}
+		for _, c := range r.Changes {
+			times = append(times, c.Time)
+		}
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		for _, t := range times {
+			lv, rv := l.valueAt(t), r.valueAt(t)
+			if lv != "" && rv != "" && !compatibleBits(lv, rv) {
+				divergences = append(divergences, divergence{name, t, lv, rv})
+				break
+			}
+		}
+	}
+	for name := range right.Signals {
+		if _, ok := left.Signals[name]; !ok {
+			rightOnly = append(rightOnly, name)
+		}
+	}
+	sort.Slice(divergences, func(i, j int) bool {
+		if divergences[i].time != divergences[j].time {
+			return divergences[i].time < divergences[j].time
+		}
+		return divergences[i].name < divergences[j].name
+	})
+	sort.Strings(leftOnly)
+	sort.Strings(rightOnly)
+
+	var sb strings.Builder
+	if len(divergences) == 0 {
+		sb.WriteString("waveforms agree\n")
+	} else {
+		first := divergences[0].time
+		var names []string
+		for _, d := range divergences {
+			if d.time == first {
+				names = append(names, d.name)
+			}
+		}
+		fmt.Fprintf(&sb, "first divergence at %s: %s\n", formatTime(first), listSignals(names))
+		for _, d := range divergences {
+			fmt.Fprintf(&sb, "  %s: from %s, %s=%s %s=%s\n", d.name, formatTime(d.time), leftLabel, d.left, rightLabel, d.right)
+		}
+	}
+	if len(leftOnly) > 0 {
+		fmt.Fprintf(&sb, "only in %s: %s\n", leftLabel, listSignals(leftOnly))
+	}
+	if len(rightOnly) > 0 {
+		fmt.Fprintf(&sb, "only in %s: %s\n", rightLabel, listSignals(rightOnly))
+	}
+	return sb.String()
+}
+
+// dumpWaveforms reruns job with VCD tracing on every simulator in sims,
+// saves the dumps as <tool>.vcd in dst and writes waveform_diff.txt, which
+// compares each dump with the first one. Tool failures here are only noted.
+func (f *Fuzzer) dumpWaveforms(job SimJob, input string, sims []string, dst string) {
+	job.Tag = "vcd"
+	job.Trace = true
+	var sb strings.Builder
+	var labels []string
+	var waves []*Waveform
+	for _, name := range sims {
+		sim, err := NewSimulator(name)
+		if err == nil {
+			_, err = runSimulator(sim, job, input)
+		}
+		var w *Waveform
+		if err == nil {
+			w, err = readWaveform(sim.Waveform())
+		}
+		if err != nil {
+			fmt.Fprintf(&sb, "%s: no waveform: %v\n", name, err)
+			continue
+		}
+		_ = copyFile(sim.Waveform(), filepath.Join(dst, name+".vcd"))
+		labels = append(labels, name)
+		waves = append(waves, w)
+	}
+	for i := 1; i < len(waves); i++ {
+		fmt.Fprintf(&sb, "\n==== %s vs %s ====\n%s", labels[0], labels[i],
+			diffWaveforms(labels[0], waves[0], labels[i], waves[i]))
+	}
+	_ = os.WriteFile(filepath.Join(dst, waveformDiffFileName), []byte(sb.String()), 0o644)
+}
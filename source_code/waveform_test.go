@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Dumps of one case as each simulator writes them: Icarus below the
+// testbench, Verilator below TOP as well, CXXRTL without scopes and in ns.
+// Icarus changes in0 twice in the step at 8000 ns.
+const (
+	icarusVCD = `$date today $end
+$version Icarus Verilog $end
+$timescale 1ps $end
+$scope module tb_dut_module $end
+$scope module uut $end
+$var wire 1 ! clk $end
+$var wire 4 " in0 [3:0] $end
+$var wire 4 # out [3:0] $end
+$upscope $end
+$upscope $end
+$enddefinitions $end
+#0
+$dumpvars
+0!
+bx "
+bx #
+$end
+#8000000
+1!
+b11 "
+b0 "
+b101 #
+#12000000
+0!
+b110 #
+`
+	verilatorVCD = `$version Generated by VerilatedVcd $end
+$timescale 1ps $end
+ $scope module TOP $end
+  $scope module tb_dut_module $end
+   $scope module uut $end
+    $var wire  1 # clk $end
+    $var wire  4 % in0 [3:0] $end
+    $var wire  4 & out [3:0] $end
+   $upscope $end
+  $upscope $end
+ $upscope $end
+$enddefinitions $end
+#0
+0#
+b0000 %
+b0000 &
+#8000000
+1#
+b0101 &
+#12000000
+0#
+b0111 &
+`
+	cxxrtlVCD = `$timescale 1 ns $end
+$var wire 1 ! clk $end
+$var wire 4 " in0 $end
+$var wire 4 # out $end
+$var wire 4 & n1 $end
+$enddefinitions $end
+#0
+0!
+b0 "
+b0 #
+#8000
+1!
+b0 "
+b101 #
+#12000
+0!
+b110 #
+`
+)
+
+func mustParseVCD(t *testing.T, text string) *Waveform {
+	t.Helper()
+	w, err := parseVCD(bufio.NewReader(strings.NewReader(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestParseVCDTimescale(t *testing.T) {
+	tests := []struct {
+		scale string
+		unit  uint64
+	}{
+		{"1ps", 1e3},
+		{"1 ps", 1e3},
+		{"10 ns", 1e7},
+		{"100us", 1e11},
+		{"1 s", 1e15},
+		{"1fs", 1},
+	}
+	for _, tt := range tests {
+		w, err := parseVCD(bufio.NewReader(strings.NewReader("$timescale " + tt.scale + " $end\n" +
+			"$var wire 1 ! a $end\n$enddefinitions $end\n#3\n1!\n")))
+		if err != nil {
+			t.Errorf("%s: %v", tt.scale, err)
+			continue
+		}
+		if got := w.Signals["a"].Changes[0].Time; got != 3*tt.unit {
+			t.Errorf("%s: #3 is at %d fs, want %d", tt.scale, got, 3*tt.unit)
+		}
+	}
+	for _, scale := range []string{"1 xs", "ns", "1.5 ns"} {
+		if _, err := parseVCD(bufio.NewReader(strings.NewReader("$timescale " + scale + " $end\n"))); err == nil {
+			t.Errorf("%s: want an error", scale)
+		}
+	}
+}
+
+func TestParseVCDNames(t *testing.T) {
+	for name, text := range map[string]string{"iverilog": icarusVCD, "verilator": verilatorVCD, "cxxrtl": cxxrtlVCD} {
+		w := mustParseVCD(t, text)
+		var names []string
+		for n := range w.Signals {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		want := "clk,in0,out"
+		if name == "cxxrtl" {
+			want = "clk,in0,n1,out"
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("%s: signals %s, want %s", name, got, want)
+		}
+		if out := w.Signals["out"]; out.Width != 4 || out.Changes[0].Time != 0 {
+			t.Errorf("%s: out is %+v", name, out)
+		}
+	}
+
+	// scopes below uut are kept
+	w := mustParseVCD(t, "$scope module tb $end $scope module uut $end $scope begin blk $end\n"+
+		"$var reg 2 ! r $end $upscope $end $upscope $end $upscope $end $enddefinitions $end #0 b1 !\n")
+	if s := w.Signals["blk.r"]; s == nil || s.Changes[0].Value != "01" {
+		t.Errorf("blk.r: got %+v", w.Signals)
+	}
+}
+
+func TestExtendValue(t *testing.T) {
+	tests := []struct {
+		value string
+		width int
+		want  string
+	}{
+		{"101", 5, "00101"},
+		{"x1", 4, "xxx1"},
+		{"z", 3, "zzz"},
+		{"1x", 4, "001x"},
+		{"0", 1, "0"},
+		{"11010", 3, "010"},
+	}
+	for _, tt := range tests {
+		if got := extendValue(tt.value, tt.width); got != tt.want {
+			t.Errorf("extendValue(%q, %d) = %q, want %q", tt.value, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestDiffWaveforms(t *testing.T) {
+	icarus, verilator, cxxrtl := mustParseVCD(t, icarusVCD), mustParseVCD(t, verilatorVCD), mustParseVCD(t, cxxrtlVCD)
+	tests := []struct {
+		name        string
+		left, right *Waveform
+		want        string
+	}{
+		// out is X in Icarus at 0, and in0 settles to 0 at 8000 ns
+		{"iverilog vs cxxrtl", icarus, cxxrtl, "waveforms agree\nonly in right: n1\n"},
+		{"iverilog vs verilator", icarus, verilator, "first divergence at 12000 ns (cycle 1): out\n" +
+			"  out: from 12000 ns (cycle 1), left=0110 right=0111\n"},
+		{"verilator vs cxxrtl", verilator, cxxrtl, "first divergence at 12000 ns (cycle 1): out\n" +
+			"  out: from 12000 ns (cycle 1), left=0111 right=0110\n" +
+			"only in right: n1\n"},
+	}
+	for _, tt := range tests {
+		if got := diffWaveforms("left", tt.left, "right", tt.right); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	tests := []struct {
+		t    uint64
+		want string
+	}{
+		{0, "0 ns"},
+		{1500, "1500 fs"},
+		{2500e3, "2500 ps"},
+		{8000e6, "8000 ns (cycle 0)"},
+		{16001e6, "16001 ns (cycle 2)"},
+	}
+	for _, tt := range tests {
+		if got := formatTime(tt.t); got != tt.want {
+			t.Errorf("formatTime(%d) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
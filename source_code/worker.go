@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const workerPollInterval = 5 * time.Second
+
+// Worker runs the cases a coordinator leases to it and sends back the
+// results, the bug directories and its counters. Its own log/, tmp/ and
+// bug/ trees stay local as in a normal run.
+type Worker struct {
+	name     string
+	url      string
+	token    string
+	client   *http.Client
+	campaign *Campaign
+
+	mu       sync.Mutex
+	fuzzers  map[string]*Fuzzer
+	uploaded map[string]bool
+}
+
+// RunWorker implements `VeriEQ worker`.
+func RunWorker(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	coordinator := fs.String("coordinator", "http://127.0.0.1:7700", "Coordinator URL")
+	threads := fs.Int("threads", 30, "Number of threads")
+	configPath := fs.String("config", "", "Path to config file")
+	token := fs.String("token", "", "Token the coordinator was started with")
+	hostname, _ := os.Hostname()
+	name := fs.String("name", fmt.Sprintf("%s-%d", hostname, os.Getpid()), "Worker name, unique within the campaign")
+	compileLimit := fs.Duration("compile-timeout", compileTimeout, "Default limit for elaboration and C++ builds")
+	runLimit := fs.Duration("run-timeout", runTimeout, "Default limit for one simulation run")
+	keep := fs.Int("bucket-keep", bucketKeep, "Cases saved per signature bucket (0 = all)")
+	fpRules := fs.String("fp-rules", fpRulesPath, "False-positive rules, re-read when changed")
+	_ = fs.Parse(args)
+
+	cfg, err := LoadToolConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Config load warning: %v\n", err)
+	}
+	toolConfig = cfg
+	compileTimeout = *compileLimit
+	runTimeout = *runLimit
+	bucketKeep = *keep
+	fpRulesPath = *fpRules
+	if err := toolConfig.validateTimeouts(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if filepath.Base(*name) != *name || !filepath.IsLocal(*name) {
+		fmt.Fprintf(os.Stderr, "bad worker name %q\n", *name)
+		os.Exit(1)
+	}
+
+	campaign := NewCampaign(0, 0, 0)
+	campaign.HandleSignals()
+	eventLog, err = OpenEventLog(campaign.LogDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Event log: %v\n", err)
+	}
+	w := &Worker{
+		name:     *name,
+		url:      strings.TrimRight(*coordinator, "/"),
+		token:    *token,
+		client:   &http.Client{Timeout: time.Minute},
+		campaign: campaign,
+		fuzzers:  map[string]*Fuzzer{},
+		uploaded: map[string]bool{},
+	}
+	PrettyRunHeader("worker "+w.name, 0, *threads)
+	PrettyInfo("worker", "coordinator "+w.url)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop()
+		}()
+	}
+	wg.Wait()
+	campaign.finish("worker "+w.name, w.allFuzzers()...)
+}
+
+// loop leases one case at a time until the coordinator reports the campaign
+// over, the worker is stopped or the coordinator stays unreachable.
+func (w *Worker) loop() {
+	failures := 0
+	for !w.campaign.Stopping() {
+		lease, err := w.lease()
+		if err != nil {
+			failures++
+			if failures >= 10 {
+				PrettyErr("worker", err.Error())
+				w.campaign.Stop(StopReasonCoordinator)
+				return
+			}
+			w.sleep(workerPollInterval)
+			continue
+		}
+		failures = 0
+		if lease == nil {
+			w.campaign.Stop(StopReasonCoordinator)
+			return
+		}
+		if len(lease.Cases) == 0 {
+			w.sleep(workerPollInterval)
+			continue
+		}
+
+		done := CompleteRequest{Worker: w.name, Run: w.campaign.ID, Lease: lease.ID}
+		for _, a := range lease.Cases {
+			f := w.fuzzer(lease, a)
+			found, elapsed := runTargetCase(f, a.Fuzzer, a.Seed, lease.Count)
+			done.Results = append(done.Results, CaseResult{Fuzzer: a.Fuzzer, Seed: a.Seed, Found: found, Seconds: elapsed.Seconds()})
+			w.uploadBundles(f.CrashDir, a)
+		}
+		done.Summary = w.campaign.Summary("worker " + w.name)
+		if err := w.post("/complete", done, nil); err != nil {
+			PrettyErr("worker", err.Error())
+		}
+	}
+}
+
+func (w *Worker) sleep(d time.Duration) {
+	select {
+	case <-w.campaign.Context().Done():
+	case <-time.After(d):
+	}
+}
+
+// fuzzer returns the worker's Fuzzer for a target, set up with the
+// campaign settings of the first lease for it; they do not change during a
+// campaign.
+func (w *Worker) fuzzer(lease *Lease, a Assignment) *Fuzzer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, ok := w.fuzzers[a.Fuzzer]
+	if !ok {
+		f = newFuzzer(w.campaign.ID, lease.DiffSim, a.Backends)
+		f.GenOptions = lease.GenOptions
+		f.Reference = lease.Reference
+		f.Waveform = lease.Waveform
+		f.Frontends = lease.Frontends
+		w.fuzzers[a.Fuzzer] = f
+	}
+	return f
+}
+
+func (w *Worker) allFuzzers() []*Fuzzer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var fuzzers []*Fuzzer
+	for _, name := range sortedKeys(w.fuzzers) {
+		fuzzers = append(fuzzers, w.fuzzers[name])
+	}
+	return fuzzers
+}
+
+func (w *Worker) lease() (*Lease, error) {
+	var lease Lease
+	status, err := w.postStatus("/lease", LeaseRequest{Worker: w.name, Slots: 1}, &lease)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNoContent {
+		return nil, nil
+	}
+	return &lease, nil
+}
+
+// uploadBundles sends every bug directory of case a that is not uploaded
+// yet. Directories are matched by their case.json, so bundles written
+// concurrently by other cases are left alone.
+func (w *Worker) uploadBundles(crashDir string, a Assignment) {
+	_ = filepath.Walk(crashDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != caseFileName {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		tc, err := LoadTestCase(path)
+		if err != nil || tc.Seed != a.Seed || tc.Fuzzer != a.Fuzzer {
+			return nil
+		}
+		w.mu.Lock()
+		done := w.uploaded[dir]
+		w.uploaded[dir] = true
+		w.mu.Unlock()
+		if done {
+			return nil
+		}
+		rel, err := filepath.Rel(crashDir, dir)
+		if err != nil {
+			return nil
+		}
+		if err := w.uploadBundle(dir, rel, tc); err != nil {
+			PrettyErr("worker", "upload "+rel+": "+err.Error())
+		}
+		return nil
+	})
+}
+
+func (w *Worker) uploadBundle(dir, rel string, tc *TestCase) error {
+	var body bytes.Buffer
+	if err := writeBundle(&body, dir); err != nil {
+		return err
+	}
+	q := url.Values{}
+	q.Set("worker", w.name)
+	q.Set("path", filepath.ToSlash(rel))
+	q.Set("fuzzer", tc.Fuzzer)
+	q.Set("seed", fmt.Sprint(tc.Seed))
+	req, err := http.NewRequest(http.MethodPost, w.url+"/bundle?"+q.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	_, err = w.do(req, nil)
+	return err
+}
+
+func (w *Worker) post(path string, in, out any) error {
+	_, err := w.postStatus(path, in, out)
+	return err
+}
+
+func (w *Worker) postStatus(path string, in, out any) (int, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.url+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return w.do(req, out)
+}
+
+func (w *Worker) do(req *http.Request, out any) (int, error) {
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("%s: %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}